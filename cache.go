@@ -1,13 +1,22 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"time"
 
 	"github.com/trinhminhtriet/git-author/internal/cache"
 	cacheBackends "github.com/trinhminhtriet/git-author/internal/cache/backends"
+	"github.com/trinhminhtriet/git-author/internal/concurrent"
+	"github.com/trinhminhtriet/git-author/internal/format"
 	"github.com/trinhminhtriet/git-author/internal/git"
+	"github.com/trinhminhtriet/git-author/internal/pretty"
+	"github.com/trinhminhtriet/git-author/internal/tally"
 )
 
 func warnFail(cb cache.Backend, err error) cache.Cache {
@@ -19,36 +28,585 @@ func warnFail(cb cache.Backend, err error) cache.Cache {
 }
 
 func getCache() cache.Cache {
+	return repoCache(false)
+}
+
+// Returns the cache for the repository we are in, or a no-op cache if caching
+// is disabled or fails.
+//
+// If wait is true, opening the cache waits for any other git-author process
+// writing to it to finish. Otherwise the cache is opened read-only when another
+// process is writing to it.
+func repoCache(wait bool) cache.Cache {
 	var fallback cache.Backend = cacheBackends.NoopBackend{}
 
 	if !cache.IsCachingEnabled() {
 		return cache.NewCache(fallback)
 	}
 
-	cacheStorageDir, err := cache.CacheStorageDir(
-		cacheBackends.GobBackendName,
-	)
+	backend, err := repoCacheBackend(wait)
 	if err != nil {
 		return warnFail(fallback, err)
 	}
 
+	recordCacheUse(backend)
+
+	logger().Debug("cache initialized", "backend", backend.Name())
+	return cache.NewCache(backend)
+}
+
+// Marks the cache for this repository as just used, and evicts the caches of
+// other repositories if GIT_WHO_CACHE_SIZE is exceeded. Failing to do so only
+// costs us disk space, so errors are logged rather than returned.
+func recordCacheUse(backend cache.Backend) {
+	var dir string
+	switch b := backend.(type) {
+	case *cacheBackends.GobBackend:
+		dir = b.Dir
+	case *cacheBackends.IndexedBackend:
+		dir = b.Dir
+	default:
+		return
+	}
+
+	budget, err := cache.CacheBudget()
+	if err != nil {
+		logger().Warn(err.Error())
+		return
+	}
+
+	root, err := cache.CacheRootDir()
+	if err != nil {
+		logger().Warn(err.Error())
+		return
+	}
+
+	evicted, err := cacheBackends.UseRepoCache(root, dir, budget, time.Now())
+	if err != nil {
+		logger().Warn(err.Error())
+		return
+	}
+
+	if len(evicted) > 0 {
+		logger().Debug("evicted caches over budget", "dirs", evicted)
+	}
+}
+
+// Returns the name of the backend to store commits with, which can be chosen
+// with GIT_WHO_CACHE_BACKEND.
+func cacheBackendName() (string, error) {
+	name := os.Getenv("GIT_WHO_CACHE_BACKEND")
+
+	switch name {
+	case "":
+		return cacheBackends.GobBackendName, nil
+	case cacheBackends.GobBackendName, cacheBackends.IndexedBackendName:
+		return name, nil
+	default:
+		return "", fmt.Errorf(
+			"unknown cache backend \"%s\" in GIT_WHO_CACHE_BACKEND",
+			name,
+		)
+	}
+}
+
+// Returns the backend storing commits for the repository we are in. Nothing is
+// created on disk.
+//
+// If wait is true, opening the backend waits for the lock on the cache.
+func repoCacheBackend(wait bool) (cache.Backend, error) {
+	name, err := cacheBackendName()
+	if err != nil {
+		return nil, err
+	}
+
+	cacheStorageDir, err := cache.CacheStorageDir(name)
+	if err != nil {
+		return nil, err
+	}
+
 	gitRootPath, err := git.GetRoot()
 	if err != nil {
-		return warnFail(fallback, err)
+		return nil, err
+	}
+
+	dirname := cacheBackends.RepoCacheDir(cacheStorageDir, gitRootPath)
+
+	switch name {
+	case cacheBackends.IndexedBackendName:
+		filename, err := cacheBackends.IndexedCacheFilename(gitRootPath)
+		if err != nil {
+			return nil, err
+		}
+
+		return &cacheBackends.IndexedBackend{
+			Dir:  dirname,
+			Path: filepath.Join(dirname, filename),
+			Wait: wait,
+		}, nil
+	default:
+		filename, err := cacheBackends.GobCacheFilename(gitRootPath)
+		if err != nil {
+			return nil, err
+		}
+
+		return &cacheBackends.GobBackend{
+			Dir:  dirname,
+			Path: filepath.Join(dirname, filename),
+			Wait: wait,
+		}, nil
+	}
+}
+
+// Opens the cache for this repository, runs f, and closes the cache again.
+//
+// If wait is true, waits for any other process writing to the cache to finish.
+// Otherwise f may see the cache as of the last time it was written.
+func withRepoCache(wait bool, f func(c *cache.Cache) error) (err error) {
+	backend, err := repoCacheBackend(wait)
+	if err != nil {
+		return err
 	}
 
-	dirname := cacheBackends.GobCacheDir(cacheStorageDir, gitRootPath)
-	err = os.MkdirAll(dirname, 0o700)
+	c := cache.NewCache(backend)
+
+	err = c.Open()
 	if err != nil {
-		return warnFail(fallback, err)
+		return err
 	}
+	defer func() {
+		closeErr := c.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	return f(&c)
+}
+
+func cacheStatus() (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("error running \"cache status\": %w", err)
+		}
+	}()
 
-	filename, err := cacheBackends.GobCacheFilename(gitRootPath)
+	gitRootPath, err := git.GetRoot()
 	if err != nil {
-		return warnFail(fallback, err)
+		return err
+	}
+
+	stateHash, err := cache.RepoStateHash(gitRootPath)
+	if err != nil {
+		return err
+	}
+
+	var stats cache.Stats
+	var backend string
+	err = withRepoCache(false, func(c *cache.Cache) error {
+		backend = c.Name()
+		stats, err = c.Stats()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("backend:    %s\n", backend)
+	fmt.Printf("path:       %s\n", stats.Path)
+	fmt.Printf("size:       %s\n", format.Bytes(stats.Size))
+	fmt.Printf("commits:    %s\n", format.Number(stats.Commits))
+	fmt.Printf("tallies:    %s\n", format.Number(stats.Aggregates))
+	fmt.Printf("state hash: %s\n", stateHash)
+
+	budget, err := cache.CacheBudget()
+	if err != nil {
+		return err
+	}
+
+	if budget > 0 {
+		fmt.Printf("budget:     %s\n", format.Bytes(budget))
+	}
+
+	if !cache.IsCachingEnabled() {
+		fmt.Println("caching is disabled by GIT_WHO_DISABLE_CACHE")
+	}
+
+	return nil
+}
+
+func cacheClear(allRepos bool) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("error running \"cache clear\": %w", err)
+		}
+	}()
+
+	logger().Debug("called cacheClear()", "allRepos", allRepos)
+
+	if allRepos {
+		for _, name := range []string{
+			cacheBackends.GobBackendName,
+			cacheBackends.IndexedBackendName,
+		} {
+			cacheStorageDir, err := cache.CacheStorageDir(name)
+			if err != nil {
+				return err
+			}
+
+			err = os.RemoveAll(cacheStorageDir)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	backend, err := repoCacheBackend(false)
+	if err != nil {
+		return err
+	}
+
+	return backend.Clear()
+}
+
+// Drops cached commits that are not reachable from any ref.
+func cachePrune() (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("error running \"cache prune\": %w", err)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reachable, err := git.RevList(ctx, []string{"--all"}, nil, git.LogFilters{})
+	if err != nil {
+		return err
+	}
+
+	var removed int
+	err = withRepoCache(true, func(c *cache.Cache) error {
+		removed, err = c.Prune(reachable)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("pruned %s commits\n", format.Number(removed))
+	return nil
+}
+
+// Checks the cache for damaged or duplicate entries, and drops them if repair is
+// true.
+func cacheVerify(repair bool) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("error running \"cache verify\": %w", err)
+		}
+	}()
+
+	logger().Debug("called cacheVerify()", "repair", repair)
+
+	var report cache.VerifyReport
+	err = withRepoCache(repair, func(c *cache.Cache) error {
+		report, err = c.Verify(repair)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("checked %s commits\n", format.Number(report.Commits))
+	for _, problem := range report.Problems {
+		fmt.Printf("  %s\n", problem)
+	}
+
+	if report.Discarded == 0 {
+		fmt.Println("no problems found")
+	} else if repair {
+		fmt.Printf(
+			"dropped %s damaged entries\n",
+			format.Number(report.Discarded),
+		)
+	} else {
+		return fmt.Errorf(
+			"found %s damaged entries; "+
+				"run \"git-author cache verify -repair\" to drop them",
+			format.Number(report.Discarded),
+		)
+	}
+
+	return nil
+}
+
+// Diffs and caches every commit in revs that isn't cached yet, so that later
+// runs can read them from the cache.
+func cacheWarm(revs []string) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("error running \"cache warm\": %w", err)
+		}
+	}()
+
+	logger().Debug("called cacheWarm()", "revs", revs)
+
+	if !cache.IsCachingEnabled() {
+		return errors.New("caching is disabled by GIT_WHO_DISABLE_CACHE")
+	}
+
+	countCached := func() (n int, err error) {
+		err = withRepoCache(true, func(c *cache.Cache) error {
+			stats, err := c.Stats()
+			n = stats.Commits
+			return err
+		})
+		return n, err
+	}
+
+	before, err := countCached()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	excluder, err := newPathExcluder(ctx, rangeTip(revs))
+	if err != nil {
+		return err
+	}
+	defer excluder.Close()
+
+	// The tally itself is thrown away. The concurrent tally caches every commit
+	// it has to diff along the way, and saves the tally in the cache too, with
+	// the same options as "git-author -l" uses by default.
+	opts := tally.TallyOpts{
+		Mode:        tally.LinesMode,
+		Key:         func(c git.Commit) string { return c.AuthorName },
+		KeyName:     "name",
+		ExcludePath: excluder.IsExcluded,
+	}
+	_, err = concurrent.TallyCommitsByPath(
+		ctx,
+		revs,
+		nil,
+		git.LogFilters{},
+		opts,
+		repoCache(true),
+		pretty.AllowDynamic(os.Stdout),
+	)
+	if err != nil {
+		return err
+	}
+
+	after, err := countCached()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("cached %s new commits\n", format.Number(max(after-before, 0)))
+	return nil
+}
+
+// Writes the cached commits reachable from any ref to a bundle at path, which
+// can be imported into another checkout of this repository.
+func cacheExport(path string) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("error running \"cache export\": %w", err)
+		}
+	}()
+
+	logger().Debug("called cacheExport()", "path", path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	gitRootPath, err := git.GetRoot()
+	if err != nil {
+		return err
+	}
+
+	stateHash, err := cache.RepoStateHash(gitRootPath)
+	if err != nil {
+		return err
+	}
+
+	reachable, err := git.RevList(ctx, []string{"--all"}, nil, git.LogFilters{})
+	if err != nil {
+		return err
+	}
+
+	bundle := cache.Bundle{
+		FormatVersion: cache.FormatVersion,
+		StateHash:     stateHash,
+		Commits:       []git.Commit{},
+	}
+
+	err = withRepoCache(false, func(c *cache.Cache) error {
+		result, err := c.Get(reachable)
+		if err != nil {
+			return err
+		}
+
+		for commit, err := range result.Commits {
+			if err != nil {
+				return err
+			}
+
+			bundle.Commits = append(bundle.Commits, commit)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = cache.WriteBundle(f, bundle)
+	if err != nil {
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf(
+		"exported %s commits to %s\n",
+		format.Number(len(bundle.Commits)),
+		path,
+	)
+	return nil
+}
+
+// Adds the commits in the bundle at path to the cache. Commits are only added
+// if they are reachable from a ref in this repository and not cached already.
+func cacheImport(path string) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("error running \"cache import\": %w", err)
+		}
+	}()
+
+	logger().Debug("called cacheImport()", "path", path)
+
+	if !cache.IsCachingEnabled() {
+		return errors.New("caching is disabled by GIT_WHO_DISABLE_CACHE")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close() // Don't care about error closing when reading
+
+	bundle, err := cache.ReadBundle(f)
+	if err != nil {
+		return err
+	}
+
+	if bundle.FormatVersion != cache.FormatVersion {
+		return fmt.Errorf(
+			"bundle has cache format version %d but this git-author uses %d",
+			bundle.FormatVersion,
+			cache.FormatVersion,
+		)
+	}
+
+	gitRootPath, err := git.GetRoot()
+	if err != nil {
+		return err
+	}
+
+	stateHash, err := cache.RepoStateHash(gitRootPath)
+	if err != nil {
+		return err
+	}
+
+	if bundle.StateHash != stateHash {
+		return fmt.Errorf(
+			"bundle has state hash %s but this repository has %s; "+
+				"check the mailmap and diff.renames match where it was exported",
+			bundle.StateHash,
+			stateHash,
+		)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reachable, err := git.RevList(ctx, []string{"--all"}, nil, git.LogFilters{})
+	if err != nil {
+		return err
+	}
+
+	isReachable := map[string]bool{}
+	for _, rev := range reachable {
+		isReachable[rev] = true
+	}
+
+	candidates := map[string]git.Commit{}
+	for _, commit := range bundle.Commits {
+		if isReachable[commit.Hash] {
+			candidates[commit.Hash] = commit
+		}
+	}
+	missing := len(bundle.Commits) - len(candidates)
+
+	var added int
+	err = withRepoCache(true, func(c *cache.Cache) error {
+		result, err := c.Get(slices.Collect(maps.Keys(candidates)))
+		if err != nil {
+			return err
+		}
+
+		for commit, err := range result.Commits {
+			if err != nil {
+				return err
+			}
+
+			delete(candidates, commit.Hash)
+		}
+
+		// Add in the order they were exported
+		commits := []git.Commit{}
+		for _, commit := range bundle.Commits {
+			if _, ok := candidates[commit.Hash]; ok {
+				commits = append(commits, commit)
+				delete(candidates, commit.Hash)
+			}
+		}
+
+		added = len(commits)
+		if added == 0 {
+			return nil
+		}
+
+		return c.Add(commits)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("imported %s new commits\n", format.Number(added))
+	if missing > 0 {
+		fmt.Printf(
+			"skipped %s commits not reachable from any ref in this repository\n",
+			format.Number(missing),
+		)
 	}
 
-	p := filepath.Join(dirname, filename)
-	logger().Debug("cache initialized", "path", p)
-	return cache.NewCache(&cacheBackends.GobBackend{Path: p, Dir: dirname})
+	return nil
 }
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/trinhminhtriet/git-author/internal/format"
+	"github.com/trinhminhtriet/git-author/internal/git"
+	"github.com/trinhminhtriet/git-author/internal/pretty"
+	"github.com/trinhminhtriet/git-author/internal/tally"
+)
+
+type compareOutputLine struct {
+	indent     string
+	path       string
+	annotation string
+	changed    bool
+	showLine   bool
+	showTally  bool
+	dimTally   bool
+	dimPath    bool
+}
+
+// A node whose top owner changed between the two compared ranges.
+type compareRecord struct {
+	Path       string     `json:"path"`
+	InWorkTree bool       `json:"in_work_tree"`
+	Before     *jsonTally `json:"before"`
+	After      *jsonTally `json:"after"`
+	Delta      *int       `json:"delta,omitempty"`
+}
+
+// Builds a tree for each of the two ranges and prints them merged into one,
+// showing how the ownership of each path moved from the first range to the
+// second.
+func treeCompare(
+	ctx context.Context,
+	revs []string,
+	compareRevs []string,
+	pathspecs []string,
+	filters git.LogFilters,
+	tallyOpts tally.TallyOpts,
+	wtreeset map[string]bool,
+	prefix string,
+	opts printTreeOpts,
+	showEmail bool,
+	outputFormat string,
+) error {
+	var trees [2]*tally.TreeNode
+	for i, r := range [][]string{revs, compareRevs} {
+		root, err := tallyTree(
+			ctx,
+			"",
+			r,
+			pathspecs,
+			filters,
+			tallyOpts,
+			wtreeset,
+			prefix,
+		)
+		if err == tally.EmptyTreeErr {
+			logger().Debug("Tree was empty.", "revs", r)
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		trees[i] = root.Rank(tallyOpts.Mode)
+	}
+
+	if trees[0] == nil && trees[1] == nil {
+		logger().Debug("Both trees were empty.")
+		return nil
+	}
+
+	root := tally.CompareTrees(trees[0], trees[1])
+
+	switch outputFormat {
+	case "csv":
+		return writeCompareCsv(root, opts, showEmail)
+	case "json":
+		return writeCompareJSON(root, opts)
+	default:
+		lines := toCompareLines(
+			root,
+			".",
+			0,
+			"",
+			[]bool{},
+			opts,
+			showEmail,
+			[]compareOutputLine{},
+		)
+		printCompareTree(opts.renderer, lines)
+		return opts.renderer.Flush()
+	}
+}
+
+// Recursively descend tree, turning compared tree nodes into output lines.
+//
+// Works just like toLines(), except that a node's annotation is shown when
+// either of its owners differs from its parent's.
+func toCompareLines(
+	node *tally.CompareNode,
+	path string,
+	depth int,
+	lastOwners string,
+	isFinalChild []bool,
+	opts printTreeOpts,
+	showEmail bool,
+	lines []compareOutputLine,
+) []compareOutputLine {
+	if path == tally.NoDiffPathname {
+		return lines
+	}
+
+	if depth > opts.maxDepth {
+		return lines
+	}
+
+	if depth < opts.maxDepth && len(node.Children) == 1 {
+		// Path ellision
+		for k, v := range node.Children {
+			lines = toCompareLines(
+				v,
+				filepath.Join(path, k),
+				depth+1,
+				lastOwners,
+				isFinalChild,
+				opts,
+				showEmail,
+				lines,
+			)
+		}
+		return lines
+	}
+
+	var line compareOutputLine
+	line.indent = treeIndent(isFinalChild, opts.renderer.Glyphs)
+
+	line.path = path
+	if len(node.Children) > 0 {
+		// Have a directory
+		line.path = path + string(os.PathSeparator)
+	}
+
+	line.annotation = fmtCompareAnnotation(node, opts, showEmail)
+	line.changed = node.OwnerChanged(opts.key)
+	line.showLine = node.InWorkTree || opts.showHidden
+	line.dimTally = len(node.Children) == 0 && !line.changed
+	line.dimPath = !node.InWorkTree
+
+	owners := compareOwners(node, opts)
+	line.showTally = opts.showHidden ||
+		owners != lastOwners ||
+		line.changed ||
+		len(node.Children) > 0
+
+	lines = append(lines, line)
+
+	childPaths := sortChildPaths(
+		node.Children,
+		func(child *tally.CompareNode) bool { return len(child.Children) > 0 },
+	)
+
+	// Find last non-hidden child
+	finalChildIndex := 0
+	for i, p := range childPaths {
+		child := node.Children[p]
+		if child.InWorkTree || opts.showHidden {
+			finalChildIndex = i
+		}
+	}
+
+	for i, p := range childPaths {
+		child := node.Children[p]
+		lines = toCompareLines(
+			child,
+			p,
+			depth+1,
+			owners,
+			append(isFinalChild, i == finalChildIndex),
+			opts,
+			showEmail,
+			lines,
+		)
+	}
+
+	return lines
+}
+
+// Identifies the pair of owners of a node so we can tell when it changes.
+func compareOwners(node *tally.CompareNode, opts printTreeOpts) string {
+	var before, after string
+	if node.HasBefore {
+		before = opts.key(node.Before)
+	}
+	if node.HasAfter {
+		after = opts.key(node.After)
+	}
+
+	return before + "\x00" + after
+}
+
+func fmtCompareAnnotation(
+	node *tally.CompareNode,
+	opts printTreeOpts,
+	showEmail bool,
+) string {
+	before := "-"
+	if node.HasBefore {
+		before = fmt.Sprintf(
+			"%s %s",
+			fmtTreeAuthor(node.Before, showEmail, defaultAuthorWidth),
+			fmtTallyMetric(node.Before, opts),
+		)
+	}
+
+	after := "-"
+	if node.HasAfter {
+		after = fmt.Sprintf(
+			"%s %s",
+			fmtTreeAuthor(node.After, showEmail, defaultAuthorWidth),
+			fmtTallyMetric(node.After, opts),
+		)
+	}
+
+	annotation := fmt.Sprintf(
+		"%s %s %s",
+		before,
+		opts.renderer.Glyphs.Arrow,
+		after,
+	)
+	if delta, ok := metricDelta(node, opts.mode); ok {
+		annotation += " " + fmtDelta(delta)
+	}
+
+	return annotation
+}
+
+// Change in the metric of the top author between the two ranges.
+//
+// Only makes sense for the modes that count something.
+func metricDelta(node *tally.CompareNode, mode tally.TallyMode) (int, bool) {
+	if mode == tally.LastModifiedMode || mode == tally.FirstModifiedMode {
+		return 0, false
+	}
+
+	var before, after int64
+	if node.HasBefore {
+		before = node.Before.SortKey(mode)
+	}
+	if node.HasAfter {
+		after = node.After.SortKey(mode)
+	}
+
+	return int(after - before), true
+}
+
+func fmtDelta(delta int) string {
+	if delta < 0 {
+		return fmt.Sprintf("[-%s]", format.Number(-delta))
+	}
+
+	return fmt.Sprintf("[+%s]", format.Number(delta))
+}
+
+func printCompareTree(r *pretty.Renderer, lines []compareOutputLine) {
+	longest := 0
+	for _, line := range lines {
+		indentLen := utf8.RuneCountInString(line.indent)
+		pathLen := utf8.RuneCountInString(line.path)
+		if indentLen+pathLen > longest {
+			longest = indentLen + pathLen
+		}
+	}
+
+	tallyStart := longest + 4 // Use at least 4 "." to separate path from tally
+
+	for _, line := range lines {
+		if !line.showLine {
+			continue
+		}
+
+		path := line.path
+		if line.dimPath {
+			path = r.Dim(line.path)
+		}
+
+		if !line.showTally {
+			r.Printf("%s%s\n", line.indent, path)
+			continue
+		}
+
+		indentLen := utf8.RuneCountInString(line.indent)
+		pathLen := utf8.RuneCountInString(line.path)
+		separator := strings.Repeat(".", tallyStart-indentLen-pathLen)
+
+		marker := ""
+		if line.changed {
+			marker = " *"
+		}
+
+		if line.dimTally {
+			r.Printf(
+				"%s%s%s\n",
+				line.indent,
+				path,
+				r.Dim(separator+line.annotation+marker),
+			)
+		} else {
+			r.Printf(
+				"%s%s%s%s%s\n",
+				line.indent,
+				path,
+				r.Dim(separator),
+				line.annotation,
+				marker,
+			)
+		}
+	}
+}
+
+// Recursively descend tree, collecting nodes whose owner changed.
+func changedNodes(
+	node *tally.CompareNode,
+	path string,
+	depth int,
+	opts printTreeOpts,
+	records []compareRecord,
+) []compareRecord {
+	if filepath.Base(path) == tally.NoDiffPathname || depth > opts.maxDepth {
+		return records
+	}
+
+	if !node.InWorkTree && !opts.showHidden {
+		return records
+	}
+
+	if len(node.Children) > 0 && path != "" {
+		path += string(os.PathSeparator)
+	}
+
+	if node.OwnerChanged(opts.key) {
+		before := toJSONTally(node.Before, true)
+		after := toJSONTally(node.After, true)
+		record := compareRecord{
+			Path:       path,
+			InWorkTree: node.InWorkTree,
+			Before:     &before,
+			After:      &after,
+		}
+
+		if delta, ok := metricDelta(node, opts.mode); ok {
+			record.Delta = &delta
+		}
+
+		if record.Path == "" {
+			record.Path = "." + string(os.PathSeparator)
+		}
+
+		records = append(records, record)
+	}
+
+	childPaths := sortChildPaths(
+		node.Children,
+		func(child *tally.CompareNode) bool { return len(child.Children) > 0 },
+	)
+	for _, p := range childPaths {
+		records = changedNodes(
+			node.Children[p],
+			path+p,
+			depth+1,
+			opts,
+			records,
+		)
+	}
+
+	return records
+}
+
+func writeCompareCsv(
+	root *tally.CompareNode,
+	opts printTreeOpts,
+	showEmail bool,
+) error {
+	w := csv.NewWriter(os.Stdout)
+
+	metricHeader := compareMetricHeader(opts.mode)
+
+	// Write header
+	columnHeaders := []string{"path", "before author"}
+	if showEmail {
+		columnHeaders = append(columnHeaders, "before email")
+	}
+	columnHeaders = append(columnHeaders, "before "+metricHeader, "after author")
+	if showEmail {
+		columnHeaders = append(columnHeaders, "after email")
+	}
+	columnHeaders = append(columnHeaders, "after "+metricHeader, "delta")
+	w.Write(columnHeaders)
+
+	records := changedNodes(root, "", 0, opts, []compareRecord{})
+	for _, r := range records {
+		row := []string{r.Path, r.Before.AuthorName}
+		if showEmail {
+			row = append(row, r.Before.AuthorEmail)
+		}
+		row = append(
+			row,
+			compareMetricValue(*r.Before, opts.mode),
+			r.After.AuthorName,
+		)
+		if showEmail {
+			row = append(row, r.After.AuthorEmail)
+		}
+		row = append(row, compareMetricValue(*r.After, opts.mode))
+
+		if r.Delta != nil {
+			row = append(row, strconv.Itoa(*r.Delta))
+		} else {
+			row = append(row, "")
+		}
+
+		if err := w.Write(row); err != nil {
+			return fmt.Errorf("error writing CSV record to stdout: %w", err)
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("error flushing CSV writer: %w", err)
+	}
+
+	return nil
+}
+
+func compareMetricHeader(mode tally.TallyMode) string {
+	switch mode {
+	case tally.CommitMode:
+		return "commits"
+	case tally.FilesMode:
+		return "files"
+	case tally.LinesMode:
+		return "lines"
+	case tally.LastModifiedMode:
+		return "last commit time"
+	case tally.FirstModifiedMode:
+		return "first commit time"
+	default:
+		panic("unrecognized mode in switch")
+	}
+}
+
+func compareMetricValue(t jsonTally, mode tally.TallyMode) string {
+	switch mode {
+	case tally.CommitMode:
+		return strconv.Itoa(t.Commits)
+	case tally.FilesMode:
+		return strconv.Itoa(t.FileCount)
+	case tally.LinesMode:
+		return strconv.Itoa(t.LinesAdded + t.LinesRemoved)
+	case tally.LastModifiedMode:
+		return t.LastCommitTime.Format(time.RFC3339)
+	case tally.FirstModifiedMode:
+		return t.FirstCommitTime.Format(time.RFC3339)
+	default:
+		panic("unrecognized mode in switch")
+	}
+}
+
+func writeCompareJSON(root *tally.CompareNode, opts printTreeOpts) error {
+	records := changedNodes(root, "", 0, opts, []compareRecord{})
+
+	return writeJSON(jsonCompare{
+		Version: jsonSchemaVersion,
+		Mode:    modeName(opts.mode),
+		Changes: records,
+	})
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/trinhminhtriet/git-author/internal/git"
+	"github.com/trinhminhtriet/git-author/internal/pretty"
+	"github.com/trinhminhtriet/git-author/internal/repotest"
+	"github.com/trinhminhtriet/git-author/internal/tally"
+)
+
+func TestFmtDelta(t *testing.T) {
+	tests := []struct {
+		delta int
+		exp   string
+	}{
+		{0, "[+0]"},
+		{3, "[+3]"},
+		{-3, "[-3]"},
+		{12345, "[+12,345]"},
+		{-12345, "[-12,345]"},
+	}
+
+	for _, test := range tests {
+		if got := fmtDelta(test.delta); got != test.exp {
+			t.Errorf("fmtDelta(%d) = %q, expected %q", test.delta, got, test.exp)
+		}
+	}
+}
+
+func TestMetricDelta(t *testing.T) {
+	before := tally.FinalTally{
+		Commits:      2,
+		LinesAdded:   10,
+		LinesRemoved: 5,
+		FileCount:    3,
+	}
+	after := tally.FinalTally{Commits: 5, LinesAdded: 4, FileCount: 3}
+	both := tally.CompareNode{
+		Before:    before,
+		After:     after,
+		HasBefore: true,
+		HasAfter:  true,
+	}
+
+	tests := []struct {
+		name  string
+		node  tally.CompareNode
+		mode  tally.TallyMode
+		exp   int
+		expOk bool
+	}{
+		{
+			name:  "commits",
+			node:  both,
+			mode:  tally.CommitMode,
+			exp:   3,
+			expOk: true,
+		},
+		{
+			name:  "lines",
+			node:  both,
+			mode:  tally.LinesMode,
+			exp:   -11,
+			expOk: true,
+		},
+		{
+			name:  "files",
+			node:  both,
+			mode:  tally.FilesMode,
+			exp:   0,
+			expOk: true,
+		},
+		{
+			name:  "added_later",
+			node:  tally.CompareNode{After: after, HasAfter: true},
+			mode:  tally.CommitMode,
+			exp:   5,
+			expOk: true,
+		},
+		{
+			name:  "removed_later",
+			node:  tally.CompareNode{Before: before, HasBefore: true},
+			mode:  tally.CommitMode,
+			exp:   -2,
+			expOk: true,
+		},
+		{
+			name: "last_modified",
+			node: both,
+			mode: tally.LastModifiedMode,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			delta, ok := metricDelta(&test.node, test.mode)
+			if ok != test.expOk || delta != test.exp {
+				t.Errorf(
+					"expected delta %d (%v), got %d (%v)",
+					test.exp,
+					test.expOk,
+					delta,
+					ok,
+				)
+			}
+		})
+	}
+}
+
+// Makes a repository where Alice adds x.go and then deletes it, and Bob later
+// adds it back along with new.go. HEAD~2 ends Alice's range.
+func newCompareRepo(t *testing.T) {
+	t.Setenv("GIT_WHO_DISABLE_CACHE", "1")
+
+	day := func(n int) time.Time {
+		return time.Date(2024, 1, n, 12, 0, 0, 0, time.UTC)
+	}
+
+	repotest.NewRepo(t, []repotest.Commit{
+		{
+			Name:  "Alice",
+			Email: "alice@mail.com",
+			Date:  day(1),
+			Files: map[string]string{"a.go": "a\n", "x.go": "x\n"},
+		},
+		{
+			Name:  "Alice",
+			Email: "alice@mail.com",
+			Date:  day(2),
+			Files: map[string]string{"a.go": "a\nb\n", "x.go": ""},
+		},
+		{
+			Name:  "Bob",
+			Email: "bob@mail.com",
+			Date:  day(3),
+			Files: map[string]string{"x.go": "x\ny\n", "new.go": "n\n"},
+		},
+		{
+			Name:  "Bob",
+			Email: "bob@mail.com",
+			Date:  day(4),
+			Files: map[string]string{"a.go": "a\nb\nc\n"},
+		},
+	})
+}
+
+// Runs tree --compare HEAD~2..HEAD HEAD~2 and returns what it prints.
+func runTreeCompare(t *testing.T, outputFormat string, at string) string {
+	compareRevs, _, err := git.ParseArgs([]string{"HEAD~2..HEAD"})
+	if err != nil {
+		t.Fatalf("could not parse compare range: %v", err)
+	}
+
+	var text strings.Builder
+	renderer := pretty.NewRenderer(&text, false, true, 0)
+
+	out := captureStdout(t, func() error {
+		return tree(
+			[]string{"HEAD~2"},
+			[]string{},
+			tally.CommitMode,
+			0,
+			false,
+			false,
+			false,
+			false,
+			false,
+			nil,
+			false,
+			compareRevs,
+			at,
+			"",
+			"",
+			outputFormat,
+			nil,
+			renderer,
+			"",
+			"",
+			[]string{},
+			[]string{},
+		)
+	})
+
+	return text.String() + out
+}
+
+func TestTreeCompareShowsPathsAddedLater(t *testing.T) {
+	newCompareRepo(t)
+
+	// Paths only in the later range are shown, with no owner before
+	text := runTreeCompare(t, "text", "")
+	if !strings.Contains(text, "new.go") {
+		t.Errorf("expected new.go in output:\n%s", text)
+	}
+	for _, line := range strings.Split(text, "\n") {
+		isNew := strings.Contains(line, "- -> Bob (1) [+1]")
+		if strings.Contains(line, "new.go") && !isNew {
+			t.Errorf("expected new.go to be annotated as new, got %q", line)
+		}
+	}
+
+	// x.go changed hands, so it is listed even though Alice deleted it by the
+	// end of her range
+	csv := runTreeCompare(t, "csv", "")
+	expected := strings.Join([]string{
+		"path,before author,before commits,after author,after commits,delta",
+		"./,Alice,2,Bob,2,0",
+		"a.go,Alice,2,Bob,1,-1",
+		"x.go,Alice,2,Bob,1,-1",
+		"",
+	}, "\n")
+	if diff := cmp.Diff(expected, csv); diff != "" {
+		t.Errorf("CSV output is wrong:\n%s", diff)
+	}
+
+	var changes jsonCompare
+	err := json.Unmarshal([]byte(runTreeCompare(t, "json", "")), &changes)
+	if err != nil {
+		t.Fatalf("could not parse JSON output: %v", err)
+	}
+
+	paths := []string{}
+	for _, change := range changes.Changes {
+		if !change.InWorkTree {
+			t.Errorf("expected %s to be in the work tree", change.Path)
+		}
+		paths = append(paths, change.Path)
+	}
+	if diff := cmp.Diff([]string{"./", "a.go", "x.go"}, paths); diff != "" {
+		t.Errorf("JSON changes are wrong:\n%s", diff)
+	}
+
+	// Asking for the earlier tip leaves out what was added later
+	csv = runTreeCompare(t, "csv", "HEAD~2")
+	if strings.Contains(csv, "x.go") {
+		t.Errorf("expected x.go to be left out with --at HEAD~2:\n%s", csv)
+	}
+
+	text = runTreeCompare(t, "text", "HEAD~2")
+	if strings.Contains(text, "new.go") {
+		t.Errorf("expected new.go to be hidden with --at HEAD~2:\n%s", text)
+	}
+}
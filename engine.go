@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"os"
+	"time"
+
+	"github.com/trinhminhtriet/git-author/internal/concurrent"
+	"github.com/trinhminhtriet/git-author/internal/git"
+	"github.com/trinhminhtriet/git-author/internal/pretty"
+	"github.com/trinhminhtriet/git-author/internal/tally"
+)
+
+// Every subcommand gets its tallies from the functions in this file.
+//
+// Whenever commits have to be diffed, they go through the concurrent tally,
+// which reads what it can from the cache (unless caching is disabled) and
+// diffs the rest with one worker per CPU, or a single worker if there is only
+// one. Commits are only read in a single pass when there is nothing to cache:
+// when they come from a saved log (--from), or when no diffs are needed.
+
+// Tallies commits by author and path.
+func tallyByPath(
+	ctx context.Context,
+	fromPath string,
+	revs []string,
+	pathspecs []string,
+	filters git.LogFilters,
+	tallyOpts tally.TallyOpts,
+) (tally.TalliesByPath, error) {
+	if fromPath != "" {
+		return tallySerial(
+			ctx,
+			fromPath,
+			revs,
+			pathspecs,
+			filters,
+			true,
+			func(commits iter.Seq2[git.Commit, error]) (tally.TalliesByPath, error) {
+				return tally.TallyCommitsByPath(commits, tallyOpts)
+			},
+		)
+	}
+
+	return concurrent.TallyCommitsByPath(
+		ctx,
+		revs,
+		pathspecs,
+		filters,
+		tallyOpts,
+		getCache(),
+		pretty.AllowDynamic(os.Stdout),
+	)
+}
+
+// Tallies commits by author.
+func tallyAuthors(
+	ctx context.Context,
+	fromPath string,
+	revs []string,
+	pathspecs []string,
+	filters git.LogFilters,
+	tallyOpts tally.TallyOpts,
+) (map[string]tally.Tally, error) {
+	if !tallyOpts.IsDiffMode() {
+		// This is fast in the no-diff case even if we don't parallelize it
+		return tallySerial(
+			ctx,
+			fromPath,
+			revs,
+			pathspecs,
+			filters,
+			false,
+			func(commits iter.Seq2[git.Commit, error]) (map[string]tally.Tally, error) {
+				return tally.TallyCommits(commits, tallyOpts)
+			},
+		)
+	}
+
+	talliesByPath, err := tallyByPath(
+		ctx,
+		fromPath,
+		revs,
+		pathspecs,
+		filters,
+		tallyOpts,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return talliesByPath.Reduce(), nil
+}
+
+// Tallies the given commits into a file tree.
+func tallyTree(
+	ctx context.Context,
+	fromPath string,
+	revs []string,
+	pathspecs []string,
+	filters git.LogFilters,
+	tallyOpts tally.TallyOpts,
+	wtreeset map[string]bool,
+	prefix string,
+) (*tally.TreeNode, error) {
+	talliesByPath, err := tallyByPath(
+		ctx,
+		fromPath,
+		revs,
+		pathspecs,
+		filters,
+		tallyOpts,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return tally.TallyCommitsTreeFromPaths(talliesByPath, wtreeset, prefix)
+}
+
+// Tallies commits into time buckets ending at end, or at the last commit if
+// end is the zero time.
+func tallyTimeline(
+	ctx context.Context,
+	fromPath string,
+	revs []string,
+	pathspecs []string,
+	filters git.LogFilters,
+	tallyOpts tally.TallyOpts,
+	end time.Time,
+) ([]tally.TimeBucket, error) {
+	if fromPath != "" || !tallyOpts.IsDiffMode() {
+		return tallySerial(
+			ctx,
+			fromPath,
+			revs,
+			pathspecs,
+			filters,
+			tallyOpts.IsDiffMode(),
+			func(commits iter.Seq2[git.Commit, error]) ([]tally.TimeBucket, error) {
+				return tally.TallyCommitsTimeline(commits, tallyOpts, end)
+			},
+		)
+	}
+
+	return concurrent.TallyCommitsTimeline(
+		ctx,
+		revs,
+		pathspecs,
+		filters,
+		tallyOpts,
+		end,
+		getCache(),
+		pretty.AllowDynamic(os.Stdout),
+	)
+}
+
+// Tallies commits by author and path and into time buckets ending at end, or at
+// the last commit if end is the zero time. Both tallies are made from the same
+// pass over the commits.
+func tallyByPathAndTimeline(
+	ctx context.Context,
+	revs []string,
+	pathspecs []string,
+	filters git.LogFilters,
+	tallyOpts tally.TallyOpts,
+	end time.Time,
+) (tally.TalliesByPath, []tally.TimeBucket, error) {
+	return concurrent.TallyCommitsByPathAndTimeline(
+		ctx,
+		revs,
+		pathspecs,
+		filters,
+		tallyOpts,
+		end,
+		getCache(),
+		pretty.AllowDynamic(os.Stdout),
+	)
+}
+
+// Reads the commits in a single pass and tallies them with f, without the
+// cache.
+func tallySerial[T any](
+	ctx context.Context,
+	fromPath string,
+	revs []string,
+	pathspecs []string,
+	filters git.LogFilters,
+	populateDiffs bool,
+	f func(commits iter.Seq2[git.Commit, error]) (T, error),
+) (T, error) {
+	var none T
+
+	commits, closer, err := logCommits(
+		ctx,
+		fromPath,
+		revs,
+		pathspecs,
+		filters,
+		populateDiffs,
+	)
+	if err != nil {
+		return none, err
+	}
+
+	result, err := f(commits)
+	if err != nil {
+		return none, fmt.Errorf("failed to tally commits: %w", err)
+	}
+
+	err = closer()
+	if err != nil {
+		return none, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/trinhminhtriet/git-author/internal/cache"
+	"github.com/trinhminhtriet/git-author/internal/git"
+	"github.com/trinhminhtriet/git-author/internal/repotest"
+	"github.com/trinhminhtriet/git-author/internal/tally"
+)
+
+const engineCommitCount = 30
+
+// Makes a small repository and points the cache at a fresh directory.
+func newEngineRepo(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("GIT_WHO_DISABLE_CACHE", "")
+	t.Setenv("GIT_WHO_CACHE_BACKEND", "")
+
+	authors := []string{"Alice", "Bob", "Carol"}
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	commits := []repotest.Commit{}
+	for i := range engineCommitCount {
+		author := authors[i%len(authors)]
+		commits = append(commits, repotest.Commit{
+			Name:  author,
+			Email: strings.ToLower(author) + "@mail.com",
+			Date:  start.Add(time.Duration(i) * 24 * time.Hour),
+			Files: map[string]string{
+				fmt.Sprintf("file%d.txt", i%4): strings.Repeat("x\n", i+1),
+			},
+		})
+	}
+
+	repotest.NewRepo(t, commits)
+}
+
+// Saves the log of the repository the way dump does, for reading with --from.
+func saveLog(t *testing.T) string {
+	subprocess, err := git.RunLog(
+		context.Background(),
+		[]string{"HEAD"},
+		nil,
+		git.LogFilters{},
+		true,
+	)
+	if err != nil {
+		t.Fatalf("could not run git log: %v", err)
+	}
+
+	var saved strings.Builder
+	for line, err := range subprocess.StdoutLogLines() {
+		if err != nil {
+			t.Fatalf("could not read git log: %v", err)
+		}
+
+		fmt.Fprintln(&saved, strings.ReplaceAll(line, "\x00", "^@"))
+	}
+
+	if err := subprocess.Wait(); err != nil {
+		t.Fatalf("git log failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "saved.log")
+	if err := os.WriteFile(path, []byte(saved.String()), 0o644); err != nil {
+		t.Fatalf("could not write saved log: %v", err)
+	}
+
+	return path
+}
+
+func cachedCommitCount(t *testing.T) int {
+	var stats cache.Stats
+	err := withRepoCache(true, func(c *cache.Cache) error {
+		var err error
+		stats, err = c.Stats()
+		return err
+	})
+	if err != nil {
+		t.Fatalf("reading cache stats failed with error: %v", err)
+	}
+
+	return stats.Commits
+}
+
+func engineOpts(mode tally.TallyMode) tally.TallyOpts {
+	return tally.TallyOpts{
+		Mode:    mode,
+		Key:     func(c git.Commit) string { return c.AuthorName },
+		KeyName: "name",
+	}
+}
+
+// Final tallies sorted by name, so that ties don't affect the order.
+func sortedByName(tallies map[string]tally.Tally) []tally.FinalTally {
+	final := tally.Rank(tallies, tally.CommitMode)
+	slices.SortFunc(final, func(a, b tally.FinalTally) int {
+		return strings.Compare(a.AuthorName, b.AuthorName)
+	})
+	return final
+}
+
+func TestEngineCachesOnlyWhenDiffing(t *testing.T) {
+	newEngineRepo(t)
+	ctx := context.Background()
+	revs := []string{"HEAD"}
+
+	// Counting commits needs no diffs, so nothing is worth caching
+	byCommits, err := tallyAuthors(
+		ctx,
+		"",
+		revs,
+		nil,
+		git.LogFilters{},
+		engineOpts(tally.CommitMode),
+	)
+	if err != nil {
+		t.Fatalf("tally failed with error: %v", err)
+	}
+
+	if n := cachedCommitCount(t); n != 0 {
+		t.Errorf("expected no commits cached without diffs, got %d", n)
+	}
+
+	// Counting lines goes through the cache
+	byLines, err := tallyAuthors(
+		ctx,
+		"",
+		revs,
+		nil,
+		git.LogFilters{},
+		engineOpts(tally.LinesMode),
+	)
+	if err != nil {
+		t.Fatalf("tally failed with error: %v", err)
+	}
+
+	if n := cachedCommitCount(t); n != engineCommitCount {
+		t.Errorf("expected %d commits cached, got %d", engineCommitCount, n)
+	}
+
+	// Both routes agree on what they both count
+	commitsOnly := func(tallies []tally.FinalTally) []tally.FinalTally {
+		out := []tally.FinalTally{}
+		for _, t := range tallies {
+			out = append(out, tally.FinalTally{
+				AuthorName:      t.AuthorName,
+				AuthorEmail:     t.AuthorEmail,
+				Commits:         t.Commits,
+				FirstCommitTime: t.FirstCommitTime,
+				LastCommitTime:  t.LastCommitTime,
+			})
+		}
+		return out
+	}
+
+	diff := cmp.Diff(
+		commitsOnly(sortedByName(byCommits)),
+		commitsOnly(sortedByName(byLines)),
+	)
+	if diff != "" {
+		t.Errorf("commit counts differ between routes:\n%s", diff)
+	}
+}
+
+func TestEngineMatchesWithAndWithoutCache(t *testing.T) {
+	newEngineRepo(t)
+	ctx := context.Background()
+	revs := []string{"HEAD"}
+	opts := engineOpts(tally.LinesMode)
+
+	run := func() (map[string]tally.Tally, []tally.TimeBucket) {
+		byAuthor, err := tallyAuthors(ctx, "", revs, nil, git.LogFilters{}, opts)
+		if err != nil {
+			t.Fatalf("tally failed with error: %v", err)
+		}
+
+		buckets, err := tallyTimeline(
+			ctx,
+			"",
+			revs,
+			nil,
+			git.LogFilters{},
+			opts,
+			time.Time{},
+		)
+		if err != nil {
+			t.Fatalf("timeline failed with error: %v", err)
+		}
+
+		return byAuthor, buckets
+	}
+
+	bucketTotals := func(buckets []tally.TimeBucket) []string {
+		totals := []string{}
+		for _, bucket := range buckets {
+			bucket = bucket.Rank(opts.Mode)
+			totals = append(totals, fmt.Sprintf(
+				"%s: %d",
+				bucket.Name,
+				bucket.TotalValue(opts.Mode),
+			))
+		}
+		return totals
+	}
+
+	t.Setenv("GIT_WHO_DISABLE_CACHE", "1")
+	expectedByAuthor, expectedBuckets := run()
+
+	t.Setenv("GIT_WHO_DISABLE_CACHE", "")
+	for _, name := range []string{"cold", "warm"} {
+		byAuthor, buckets := run()
+
+		diff := cmp.Diff(sortedByName(expectedByAuthor), sortedByName(byAuthor))
+		if diff != "" {
+			t.Errorf("%s cache tally is wrong:\n%s", name, diff)
+		}
+
+		diff = cmp.Diff(bucketTotals(expectedBuckets), bucketTotals(buckets))
+		if diff != "" {
+			t.Errorf("%s cache timeline is wrong:\n%s", name, diff)
+		}
+	}
+}
+
+func TestEngineReadsSavedLog(t *testing.T) {
+	newEngineRepo(t)
+	ctx := context.Background()
+	revs := []string{"HEAD"}
+	opts := engineOpts(tally.LinesMode)
+
+	savedPath := saveLog(t)
+
+	fromSaved, err := tallyByPath(ctx, savedPath, revs, nil, git.LogFilters{}, opts)
+	if err != nil {
+		t.Fatalf("tally of saved log failed with error: %v", err)
+	}
+
+	// Commits read from a saved log are not cached
+	if n := cachedCommitCount(t); n != 0 {
+		t.Errorf("expected no commits cached from saved log, got %d", n)
+	}
+
+	fromRepo, err := tallyByPath(ctx, "", revs, nil, git.LogFilters{}, opts)
+	if err != nil {
+		t.Fatalf("tally failed with error: %v", err)
+	}
+
+	diff := cmp.Diff(
+		sortedByName(fromRepo.Reduce()),
+		sortedByName(fromSaved.Reduce()),
+	)
+	if diff != "" {
+		t.Errorf("saved log tally differs from repository tally:\n%s", diff)
+	}
+}
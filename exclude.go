@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/trinhminhtriet/git-author/internal/git"
+)
+
+const excludeAttr = "git-author.exclude"
+
+// Attributes we look at to decide whether a path is hand-written. The
+// "linguist-*" attributes are the ones GitHub uses to hide files from diffs and
+// language stats.
+var excludeAttrs = []string{
+	"linguist-generated",
+	"linguist-vendored",
+	"diff",
+	"binary",
+	excludeAttr,
+}
+
+// Lockfiles are excluded even if not marked in .gitattributes.
+var lockfiles = map[string]bool{
+	"Cargo.lock":          true,
+	"Gemfile.lock":        true,
+	"Package.resolved":    true,
+	"Pipfile.lock":        true,
+	"Podfile.lock":        true,
+	"bun.lockb":           true,
+	"composer.lock":       true,
+	"flake.lock":          true,
+	"go.sum":              true,
+	"mix.lock":            true,
+	"npm-shrinkwrap.json": true,
+	"package-lock.json":   true,
+	"packages.lock.json":  true,
+	"pdm.lock":            true,
+	"pnpm-lock.yaml":      true,
+	"poetry.lock":         true,
+	"pubspec.lock":        true,
+	"uv.lock":             true,
+	"yarn.lock":           true,
+}
+
+// Decides which paths don't count toward line and file metrics because they
+// are generated, vendored, binary, or otherwise not written by hand.
+//
+// Each path is only checked once; results are remembered.
+type pathExcluder struct {
+	checker  *git.AttrChecker
+	excluded map[string]bool
+	mu       sync.Mutex
+}
+
+// Reads attributes as they are in the given revision, the tip being analysed.
+func newPathExcluder(ctx context.Context, rev string) (*pathExcluder, error) {
+	checker, err := git.NewAttrChecker(ctx, excludeAttrs, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pathExcluder{
+		checker:  checker,
+		excluded: map[string]bool{},
+	}, nil
+}
+
+// Returns an excluder that only knows about lockfiles, for when we don't have
+// a repository to read attributes from.
+func newLockfileExcluder() *pathExcluder {
+	return &pathExcluder{excluded: map[string]bool{}}
+}
+
+func (e *pathExcluder) IsExcluded(path string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if excluded, ok := e.excluded[path]; ok {
+		return excluded
+	}
+
+	excluded := lockfiles[filepath.Base(path)]
+
+	if e.checker != nil {
+		attrs, err := e.checker.Check(path)
+		if err != nil {
+			logger().Warn(fmt.Sprintf("failed to check gitattributes: %v", err))
+			logger().Warn("only excluding lockfiles from now on")
+			e.checker = nil
+		} else {
+			excluded = isExcludedByAttrs(attrs, excluded)
+		}
+	}
+
+	e.excluded[path] = excluded
+	return excluded
+}
+
+func (e *pathExcluder) Close() error {
+	if e.checker == nil {
+		return nil
+	}
+
+	return e.checker.Close()
+}
+
+// Applies the attributes of a path to the default decision.
+//
+// Setting linguist-generated, linguist-vendored, or git-author.exclude to false
+// (or unsetting git-author.exclude) forces a path to be counted.
+func isExcludedByAttrs(attrs map[string]string, excluded bool) bool {
+	isTrue := func(v string) bool { return v == git.AttrSet || v == "true" }
+	isFalse := func(v string) bool { return v == git.AttrUnset || v == "false" }
+
+	for _, attr := range []string{"linguist-generated", "linguist-vendored"} {
+		if isTrue(attrs[attr]) {
+			excluded = true
+		} else if attrs[attr] == "false" {
+			excluded = false
+		}
+	}
+
+	if attrs["diff"] == git.AttrUnset || attrs["binary"] == git.AttrSet {
+		excluded = true
+	}
+
+	if isTrue(attrs[excludeAttr]) {
+		excluded = true
+	} else if isFalse(attrs[excludeAttr]) {
+		excluded = false
+	}
+
+	return excluded
+}
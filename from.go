@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"strings"
+
+	"github.com/trinhminhtriet/git-author/internal/git"
+)
+
+// Max length of a line in a saved log. Paths can be long.
+const maxSavedLineLength = 1024 * 1024
+
+// Returns an iterator over the commits saved in a file by "dump" or by "parse
+// --format ndjson", so we can tally commits without the repository. Pass "-"
+// to read from stdin.
+//
+// Only file diffs matching the pathspecs are kept, and commits with no
+// matching file diffs are skipped, like git log would do.
+func savedCommits(path string, pathspecs []string) (
+	iter.Seq2[git.Commit, error],
+	func() error,
+	error,
+) {
+	var f *os.File
+	if path == "-" {
+		f = os.Stdin
+	} else {
+		var err error
+		f, err = os.Open(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not open saved log: %w", err)
+		}
+	}
+
+	r := bufio.NewReader(f)
+
+	isNDJSON, err := startsWithJSON(r)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("could not read saved log: %w", err)
+	}
+
+	var commits iter.Seq2[git.Commit, error]
+	if isNDJSON {
+		commits = ndjsonCommits(r)
+	} else {
+		commits = git.ParseCommits(savedLines(r))
+	}
+
+	if len(pathspecs) > 0 {
+		commits = skipEmptyCommits(git.LimitDiffsByPathspec(commits, pathspecs))
+	}
+
+	closer := func() error {
+		if f == os.Stdin {
+			return nil
+		}
+
+		return f.Close()
+	}
+
+	return commits, closer, nil
+}
+
+// Peeks at the first non-whitespace character to tell NDJSON apart from git
+// log output, which always starts with a commit hash.
+func startsWithJSON(r *bufio.Reader) (bool, error) {
+	for n := 1; ; n++ {
+		b, err := r.Peek(n)
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		trimmed := bytes.TrimLeft(b, " \t\r\n")
+		if len(trimmed) > 0 {
+			return trimmed[0] == '{', nil
+		}
+	}
+}
+
+func savedLines(r io.Reader) iter.Seq2[string, error] {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSavedLineLength)
+
+	return func(yield func(string, error) bool) {
+		for scanner.Scan() {
+			if !yield(scanner.Text(), nil) {
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			yield("", fmt.Errorf("error reading saved log: %w", err))
+		}
+	}
+}
+
+func ndjsonCommits(r io.Reader) iter.Seq2[git.Commit, error] {
+	dec := json.NewDecoder(r)
+
+	return func(yield func(git.Commit, error) bool) {
+		for {
+			var commit jsonCommit
+			err := dec.Decode(&commit)
+			if errors.Is(err, io.EOF) {
+				return
+			} else if err != nil {
+				yield(
+					git.Commit{},
+					fmt.Errorf("error reading saved commits: %w", err),
+				)
+				return
+			}
+
+			if !yield(fromJSONCommit(commit), nil) {
+				return
+			}
+		}
+	}
+}
+
+func skipEmptyCommits(
+	commits iter.Seq2[git.Commit, error],
+) iter.Seq2[git.Commit, error] {
+	return func(yield func(git.Commit, error) bool) {
+		for commit, err := range commits {
+			if err == nil && len(commit.FileDiffs) == 0 {
+				continue
+			}
+
+			if !yield(commit, err) {
+				return
+			}
+		}
+	}
+}
+
+// Reads a list of the files in the working tree, as printed by git ls-files,
+// with paths separated by newlines or by NULs (with -z).
+func savedFileList(path string) (map[string]bool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read file list: %w", err)
+	}
+
+	sep := "\n"
+	if bytes.IndexByte(b, 0) >= 0 {
+		sep = "\x00"
+	}
+
+	files := map[string]bool{}
+	for _, line := range strings.Split(string(b), sep) {
+		line = strings.TrimSuffix(line, "\r")
+		if line != "" {
+			files[line] = true
+		}
+	}
+
+	return files, nil
+}
+
+// Like git.ParseArgs(), but with --from there is no repository to resolve
+// revisions in, so all arguments are pathspecs.
+func parseLogArgs(args []string, fromPath string) ([]string, []string, error) {
+	if fromPath == "" {
+		return git.ParseArgs(args)
+	}
+
+	if len(args) > 0 && args[0] == "--" {
+		return nil, args[1:], nil
+	}
+
+	return nil, args, nil
+}
+
+// Returns the commits to tally, read from the saved log at fromPath if given
+// or from git log otherwise.
+func logCommits(
+	ctx context.Context,
+	fromPath string,
+	revs []string,
+	pathspecs []string,
+	filters git.LogFilters,
+	populateDiffs bool,
+) (iter.Seq2[git.Commit, error], func() error, error) {
+	if fromPath != "" {
+		return savedCommits(fromPath, pathspecs)
+	}
+
+	return git.CommitsWithOpts(ctx, revs, pathspecs, filters, populateDiffs)
+}
+
+// Like newPathExcluder(), but only excludes lockfiles when reading a saved
+// log, since there may be no repository to check attributes in.
+func excluderFor(
+	ctx context.Context,
+	fromPath string,
+	rev string,
+) (*pathExcluder, error) {
+	if fromPath != "" {
+		return newLockfileExcluder(), nil
+	}
+
+	return newPathExcluder(ctx, rev)
+}
@@ -6,10 +6,10 @@ require (
 	github.com/bmatcuk/doublestar/v4 v4.9.1
 	github.com/google/go-cmp v0.6.0
 	github.com/mattn/go-runewidth v0.0.19
+	golang.org/x/sys v0.36.0
 	golang.org/x/term v0.35.0
 )
 
 require (
 	github.com/clipperhouse/uax29/v2 v2.2.0 // indirect
-	golang.org/x/sys v0.36.0 // indirect
 )
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Returns what f writes to stdout.
+func captureStdout(t *testing.T, f func() error) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("could not create pipe: %v", err)
+	}
+
+	saved := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = saved }()
+
+	out := make(chan string)
+	go func() {
+		var b strings.Builder
+		io.Copy(&b, r)
+		out <- b.String()
+	}()
+
+	err = f()
+	w.Close()
+	captured := <-out
+	r.Close()
+
+	if err != nil {
+		t.Fatalf("writing output failed with error: %v", err)
+	}
+
+	return captured
+}
+
+// Splits output into lines, leaving out the newline at the end.
+func outputLines(out string) []string {
+	if out == "" {
+		return []string{}
+	}
+
+	return strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+}
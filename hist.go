@@ -2,14 +2,17 @@ package main
 
 import (
 	"context"
+	"encoding/csv"
 	"fmt"
 	"math"
 	"os"
-	"runtime"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
-	"github.com/trinhminhtriet/git-author/internal/concurrent"
+	runewidth "github.com/mattn/go-runewidth"
+
 	"github.com/trinhminhtriet/git-author/internal/format"
 	"github.com/trinhminhtriet/git-author/internal/git"
 	"github.com/trinhminhtriet/git-author/internal/pretty"
@@ -21,9 +24,16 @@ const barWidth = 36
 func hist(
 	revs []string,
 	pathspecs []string,
+	fromPath string,
 	mode tally.TallyMode,
 	showEmail bool,
 	countMerges bool,
+	includeGenerated bool,
+	outputFormat string,
+	tmpl *template.Template,
+	renderer *pretty.Renderer,
+	chartWidth int,
+	chartHeight int,
 	since string,
 	until string,
 	authors []string,
@@ -41,12 +51,24 @@ func hist(
 		revs,
 		"pathspecs",
 		pathspecs,
+		"fromPath",
+		fromPath,
 		"mode",
 		mode,
 		"showEmail",
 		showEmail,
 		"countMerges",
 		countMerges,
+		"includeGenerated",
+		includeGenerated,
+		"outputFormat",
+		outputFormat,
+		"template",
+		tmpl != nil,
+		"chartWidth",
+		chartWidth,
+		"chartHeight",
+		chartHeight,
 		"since",
 		since,
 		"until",
@@ -63,11 +85,22 @@ func hist(
 	tallyOpts := tally.TallyOpts{Mode: mode, CountMerges: countMerges}
 	if showEmail {
 		tallyOpts.Key = func(c git.Commit) string { return c.AuthorEmail }
+		tallyOpts.KeyName = "email"
 	} else {
 		tallyOpts.Key = func(c git.Commit) string { return c.AuthorName }
+		tallyOpts.KeyName = "name"
+	}
+
+	if !includeGenerated && tallyOpts.IsDiffMode() {
+		excluder, err := excluderFor(ctx, fromPath, rangeTip(revs))
+		if err != nil {
+			return err
+		}
+		defer excluder.Close()
+
+		tallyOpts.ExcludePath = excluder.IsExcluded
 	}
 
-	populateDiffs := tallyOpts.IsDiffMode()
 	filters := git.LogFilters{
 		Since:    since,
 		Until:    until,
@@ -76,51 +109,22 @@ func hist(
 	}
 
 	var end time.Time // Default is zero time, meaning use last commit
-	if len(revs) == 1 && revs[0] == "HEAD" && len(until) == 0 {
+	if fromPath == "" && len(revs) == 1 && revs[0] == "HEAD" && len(until) == 0 {
 		// If no revs or --until given, end timeline at current time
 		end = time.Now()
 	}
 
-	var buckets []tally.TimeBucket
-	if populateDiffs && runtime.GOMAXPROCS(0) > 1 {
-		buckets, err = concurrent.TallyCommitsTimeline(
-			ctx,
-			revs,
-			pathspecs,
-			filters,
-			tallyOpts,
-			end,
-			getCache(),
-			pretty.AllowDynamic(os.Stdout),
-		)
-		if err != nil {
-			return err
-		}
-	} else {
-		commits, closer, err := git.CommitsWithOpts(
-			ctx,
-			revs,
-			pathspecs,
-			filters,
-			populateDiffs,
-		)
-		if err != nil {
-			return err
-		}
-
-		buckets, err = tally.TallyCommitsTimeline(
-			commits,
-			tallyOpts,
-			end,
-		)
-		if err != nil {
-			return err
-		}
-
-		err = closer()
-		if err != nil {
-			return err
-		}
+	buckets, err := tallyTimeline(
+		ctx,
+		fromPath,
+		revs,
+		pathspecs,
+		filters,
+		tallyOpts,
+		end,
+	)
+	if err != nil {
+		return err
 	}
 
 	// -- Pick winner in each bucket --
@@ -128,34 +132,177 @@ func hist(
 		buckets[i] = bucket.Rank(mode)
 	}
 
+	if tmpl != nil {
+		return writeHistTemplate(tmpl, buckets, mode)
+	}
+
+	switch outputFormat {
+	case "csv":
+		return writeHistCsv(buckets, tallyOpts, showEmail)
+	case "json":
+		return writeHistJSON(buckets, mode)
+	case "svg":
+		return writeHistSVG(os.Stdout, buckets, svgChartOpts{
+			width:     chartWidth,
+			height:    chartHeight,
+			mode:      mode,
+			showEmail: showEmail,
+		})
+	}
+
 	// -- Draw bar plot --
-	maxVal := barWidth
+	if outputFormat == "markdown" {
+		maxVal := plotMaxVal(buckets, mode, barWidth)
+		writeHistMarkdown(buckets, maxVal, mode, showEmail)
+		return nil
+	}
+
+	drawPlot(renderer, buckets, mode, showEmail)
+	return renderer.Flush()
+}
+
+// Writes one row per author in each bucket. Buckets without commits have no
+// rows.
+func writeHistCsv(
+	buckets []tally.TimeBucket,
+	opts tally.TallyOpts,
+	showEmail bool,
+) error {
+	w := csv.NewWriter(os.Stdout)
+
+	// Write header
+	columnHeaders := []string{"bucket", "bucket start", "bucket end", "name"}
+	if showEmail {
+		columnHeaders = append(columnHeaders, "email")
+	}
+
+	columnHeaders = append(columnHeaders, "commits")
+
+	if opts.IsDiffMode() {
+		columnHeaders = append(
+			columnHeaders,
+			"lines added",
+			"lines removed",
+			"files",
+		)
+	}
+
+	w.Write(columnHeaders)
+
+	for _, bucket := range buckets {
+		for _, t := range bucket.Authors(opts.Mode) {
+			record := []string{
+				bucket.Name,
+				bucket.Time.Format(time.RFC3339),
+				bucket.End.Format(time.RFC3339),
+				t.AuthorName,
+			}
+
+			if showEmail {
+				record = append(record, t.AuthorEmail)
+			}
+
+			record = append(record, strconv.Itoa(t.Commits))
+
+			if opts.IsDiffMode() {
+				record = append(
+					record,
+					strconv.Itoa(t.LinesAdded),
+					strconv.Itoa(t.LinesRemoved),
+					strconv.Itoa(t.FileCount),
+				)
+			}
+
+			if err := w.Write(record); err != nil {
+				return fmt.Errorf("error writing CSV record to stdout: %w", err)
+			}
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("error flushing CSV writer: %w", err)
+	}
+
+	return nil
+}
+
+// Returns the value that a bar of the given width stands for. Values are never
+// scaled up, so small values are not exaggerated.
+func plotMaxVal(buckets []tally.TimeBucket, mode tally.TallyMode, width int) int {
+	maxVal := width
 	for _, bucket := range buckets {
 		if bucket.TotalValue(mode) > maxVal {
 			maxVal = bucket.TotalValue(mode)
 		}
 	}
 
-	drawPlot(buckets, maxVal, mode, showEmail)
-	return nil
+	return maxVal
+}
+
+// Bars are never drawn narrower than this, even in narrow terminals.
+const minBarWidth = 10
+
+// Picks the width of the bars and of the authors so that the plot fits in the
+// terminal.
+func layoutPlot(
+	r *pretty.Renderer,
+	buckets []tally.TimeBucket,
+	mode tally.TallyMode,
+	showEmail bool,
+) (plotWidth int, authorWidth int) {
+	if r.Width == 0 {
+		return barWidth, defaultAuthorWidth
+	}
+
+	nameWidth := 0
+	metricWidth := 0
+	longestAuthor := 0
+	for _, bucket := range buckets {
+		nameWidth = max(nameWidth, runewidth.StringWidth(bucket.Name))
+
+		if bucket.Value(mode) > 0 {
+			metricWidth = max(
+				metricWidth,
+				visibleLen(fmtHistMetric(r, bucket.Tally, mode)),
+			)
+			longestAuthor = max(
+				longestAuthor,
+				runewidth.StringWidth(
+					fmtTreeAuthor(bucket.Tally, showEmail, math.MaxInt),
+				),
+			)
+		}
+	}
+
+	// Name, axis, gap after the bar, and space before the metric
+	available := r.Width - nameWidth - 3 - 2 - 1 - metricWidth
+
+	authorWidth = min(longestAuthor, available-minBarWidth)
+	authorWidth = max(authorWidth, minAuthorAbbrevWidth)
+	plotWidth = max(available-authorWidth, minBarWidth)
+	return plotWidth, authorWidth
 }
 
 func drawPlot(
+	r *pretty.Renderer,
 	buckets []tally.TimeBucket,
-	maxVal int,
 	mode tally.TallyMode,
 	showEmail bool,
 ) {
+	plotWidth, authorWidth := layoutPlot(r, buckets, mode, showEmail)
+	maxVal := plotMaxVal(buckets, mode, plotWidth)
+
 	var lastAuthor string
 	for _, bucket := range buckets {
 		value := bucket.Value(mode)
 		clampedValue := int(math.Ceil(
-			(float64(value) / float64(maxVal)) * float64(barWidth),
+			(float64(value) / float64(maxVal)) * float64(plotWidth),
 		))
 
 		total := bucket.TotalValue(mode)
 		clampedTotal := int(math.Ceil(
-			(float64(total) / float64(maxVal)) * float64(barWidth),
+			(float64(total) / float64(maxVal)) * float64(plotWidth),
 		))
 
 		valueBar := strings.Repeat("#", clampedValue)
@@ -163,71 +310,64 @@ func drawPlot(
 
 		if value > 0 {
 			tallyPart := fmtHistTally(
+				r,
 				bucket.Tally,
 				mode,
 				showEmail,
 				bucket.Tally.AuthorName == lastAuthor,
+				authorWidth,
 			)
-			fmt.Printf(
-				"%s ┤ %s%s%-*s%s  %s\n",
+			r.Printf(
+				"%s %s %s%s  %s\n",
 				bucket.Name,
+				r.Glyphs.Axis,
 				valueBar,
-				pretty.Dim,
-				barWidth-clampedValue,
-				totalBar,
-				pretty.Reset,
+				r.Dim(fmt.Sprintf("%-*s", plotWidth-clampedValue, totalBar)),
 				tallyPart,
 			)
 
 			lastAuthor = bucket.Tally.AuthorName
 		} else {
-			fmt.Printf("%s ┤ \n", bucket.Name)
+			r.Printf("%s %s \n", bucket.Name, r.Glyphs.Axis)
 		}
 	}
 }
 
 func fmtHistTally(
+	r *pretty.Renderer,
 	t tally.FinalTally,
 	mode tally.TallyMode,
 	showEmail bool,
 	fade bool,
+	authorWidth int,
+) string {
+	metric := fmtHistMetric(r, t, mode)
+	author := fmtTreeAuthor(t, showEmail, authorWidth)
+
+	if fade {
+		return r.Dim(fmt.Sprintf("%s %s", author, metric))
+	} else {
+		return fmt.Sprintf("%s %s", author, metric)
+	}
+}
+
+func fmtHistMetric(
+	r *pretty.Renderer,
+	t tally.FinalTally,
+	mode tally.TallyMode,
 ) string {
-	var metric string
 	switch mode {
 	case tally.CommitMode:
-		metric = fmt.Sprintf("(%s)", format.Number(t.Commits))
+		return fmt.Sprintf("(%s)", format.Number(t.Commits))
 	case tally.FilesMode:
-		metric = fmt.Sprintf("(%s)", format.Number(t.FileCount))
+		return fmt.Sprintf("(%s)", format.Number(t.FileCount))
 	case tally.LinesMode:
-		metric = fmt.Sprintf(
-			"(%s%s%s / %s%s%s)",
-			pretty.Green,
-			format.Number(t.LinesAdded),
-			pretty.DefaultColor,
-			pretty.Red,
-			format.Number(t.LinesRemoved),
-			pretty.DefaultColor,
+		return fmt.Sprintf(
+			"(%s / %s)",
+			r.Green(format.Number(t.LinesAdded)),
+			r.Red(format.Number(t.LinesRemoved)),
 		)
 	default:
 		panic("unrecognized tally mode in switch")
 	}
-
-	var author string
-	if showEmail {
-		author = format.Abbrev(format.GitEmail(t.AuthorEmail), 25)
-	} else {
-		author = format.Abbrev(t.AuthorName, 25)
-	}
-
-	if fade {
-		return fmt.Sprintf(
-			"%s%s %s%s",
-			pretty.Dim,
-			author,
-			metric,
-			pretty.Reset,
-		)
-	} else {
-		return fmt.Sprintf("%s %s", author, metric)
-	}
 }
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-runewidth"
+
+	"github.com/trinhminhtriet/git-author/internal/git"
+	"github.com/trinhminhtriet/git-author/internal/pretty"
+	"github.com/trinhminhtriet/git-author/internal/tally"
+	"github.com/trinhminhtriet/git-author/internal/utils/iterutils"
+)
+
+func histBuckets(t *testing.T, mode tally.TallyMode) []tally.TimeBucket {
+	commit := func(hash string, author string, day int) git.Commit {
+		return git.Commit{
+			Hash:       hash,
+			ShortHash:  hash[:7],
+			AuthorName: author,
+			Date:       time.Date(2025, 1, day, 12, 0, 0, 0, time.UTC),
+			FileDiffs: []git.FileDiff{
+				{Path: "foo.txt", LinesAdded: 1},
+			},
+		}
+	}
+
+	commits := []git.Commit{
+		commit("1e9ea7662b1001d860471a4cece5e2f1de8062fb", "Alice", 1),
+		commit("2e9ea7662b1001d860471a4cece5e2f1de8062fb", "Alice", 1),
+		commit("3e9ea7662b1001d860471a4cece5e2f1de8062fb", longAuthor, 3),
+	}
+
+	opts := tally.TallyOpts{
+		Mode: mode,
+		Key:  func(c git.Commit) string { return c.AuthorName },
+	}
+	buckets, err := tally.TallyCommitsTimeline(
+		iterutils.WithoutErrors(slices.Values(commits)),
+		opts,
+		time.Time{},
+	)
+	if err != nil {
+		t.Fatalf("TallyCommitsTimeline() returned error: %v", err)
+	}
+	for i, bucket := range buckets {
+		buckets[i] = bucket.Rank(mode)
+	}
+
+	return buckets
+}
+
+func TestLayoutPlot(t *testing.T) {
+	buckets := histBuckets(t, tally.CommitMode)
+
+	// Bucket names take 10 columns, the axis and gaps 6, and the metric 3,
+	// leaving 48 for the bar and the author at a width of 67
+	tests := []struct {
+		name           string
+		width          int
+		expPlotWidth   int
+		expAuthorWidth int
+	}{
+		{"unlimited", 0, barWidth, defaultAuthorWidth},
+		{"wide", 200, 143, 38},
+		{"exact", 67, minBarWidth, 38},
+		{"truncated", 66, minBarWidth, 37},
+		{"narrow", 30, minBarWidth, minAuthorAbbrevWidth},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := pretty.NewRenderer(&strings.Builder{}, false, true, test.width)
+			plotWidth, authorWidth := layoutPlot(
+				r,
+				buckets,
+				tally.CommitMode,
+				false,
+			)
+
+			if plotWidth != test.expPlotWidth {
+				t.Errorf(
+					"expected plot width %d, got %d",
+					test.expPlotWidth,
+					plotWidth,
+				)
+			}
+			if authorWidth != test.expAuthorWidth {
+				t.Errorf(
+					"expected author width %d, got %d",
+					test.expAuthorWidth,
+					authorWidth,
+				)
+			}
+		})
+	}
+}
+
+func TestDrawPlotWidth(t *testing.T) {
+	buckets := histBuckets(t, tally.CommitMode)
+
+	tests := []struct {
+		name         string
+		width        int
+		expTruncated bool
+	}{
+		{"wide", 200, false},
+		{"exact", 67, false},
+		{"truncated", 66, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out strings.Builder
+			r := pretty.NewRenderer(&out, false, true, test.width)
+			drawPlot(r, buckets, tally.CommitMode, false)
+			if err := r.Flush(); err != nil {
+				t.Fatalf("Flush() returned error: %v", err)
+			}
+
+			lines := outputLines(out.String())
+			if len(lines) != 3 {
+				t.Fatalf("expected 3 lines, got:\n%s", out.String())
+			}
+
+			for _, line := range lines {
+				if w := runewidth.StringWidth(line); w > test.width {
+					t.Errorf("line is %d wide, expected at most %d: %q",
+						w, test.width, line)
+				}
+			}
+
+			truncated := !strings.Contains(lines[2], longAuthor+" (1)")
+			if truncated != test.expTruncated {
+				t.Errorf(
+					"expected author truncated: %v, got line %q",
+					test.expTruncated,
+					lines[2],
+				)
+			}
+			if test.expTruncated && !strings.Contains(lines[2], "…") {
+				t.Errorf("expected truncated author to end in …: %q", lines[2])
+			}
+		})
+	}
+}
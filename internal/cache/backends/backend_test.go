@@ -0,0 +1,467 @@
+package backends_test
+
+import (
+	"iter"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/trinhminhtriet/git-author/internal/cache"
+	"github.com/trinhminhtriet/git-author/internal/git"
+	"github.com/trinhminhtriet/git-author/internal/utils/iterutils"
+)
+
+// Tests shared by every backend. Each backend's test file runs them with a
+// function that creates the backend under test.
+
+// Returns a backend keeping its cache in dir. Backends returned for the same
+// dir share the cache on disk.
+type newBackendFunc func(dir string) cache.Backend
+
+// Implemented by backends that lock the cache while it is open.
+type lockingBackend interface {
+	cache.Backend
+	ReadOnly() bool
+}
+
+// Runs the tests that apply to every backend.
+func testBackend(t *testing.T, newBackend newBackendFunc) {
+	t.Run("AddGetClear", func(t *testing.T) { testAddGetClear(t, newBackend) })
+	t.Run("AddGetAddGet", func(t *testing.T) { testAddGetAddGet(t, newBackend) })
+	t.Run("StatsPrune", func(t *testing.T) { testStatsPrune(t, newBackend) })
+	t.Run("ReadOnlyWhileLocked", func(t *testing.T) {
+		testReadOnlyWhileLocked(t, newBackend)
+	})
+}
+
+// Runs the tests for backends that store aggregates.
+func testAggregateBackend(t *testing.T, newBackend newBackendFunc) {
+	t.Run("Aggregates", func(t *testing.T) { testAggregates(t, newBackend) })
+}
+
+func CacheDir(t *testing.T) string {
+	dirname := filepath.Join(t.TempDir(), "backend", "test-1234")
+	err := os.MkdirAll(dirname, 0o700)
+	if err != nil {
+		t.Fatalf("could not create cache dir: %v", err)
+	}
+
+	return dirname
+}
+
+func testAddGetClear(t *testing.T, newBackend newBackendFunc) {
+	c := newBackend(CacheDir(t))
+
+	err := c.Open()
+	if err != nil {
+		t.Fatalf("could not open cache: %v", err)
+	}
+	defer func() {
+		err = c.Close()
+		if err != nil {
+			t.Fatalf("could not close cache: %v", err)
+		}
+	}()
+
+	commit := git.Commit{
+		ShortHash:   "9e9ea7662b1",
+		Hash:        "9e9ea7662b1001d860471a4cece5e2f1de8062fb",
+		AuthorName:  "John",
+		AuthorEmail: "john@doe.local",
+		Date: time.Date(
+			2025, 1, 31, 16, 35, 26, 0, time.UTC,
+		),
+		FileDiffs: []git.FileDiff{
+			{
+				Path:         "foo/bar.txt",
+				LinesAdded:   3,
+				LinesRemoved: 5,
+			},
+		},
+	}
+
+	// -- Add --
+	err = c.Add([]git.Commit{commit})
+	if err != nil {
+		t.Fatalf("add commits to cache failed with error: %v", err)
+	}
+
+	// -- Get --
+	revs := []string{commit.Hash}
+	result, err := c.Get(revs)
+	if err != nil {
+		t.Fatalf("get commits from cache failed with error: %v", err)
+	}
+
+	next, stop := iter.Pull2(result.Commits)
+	defer stop()
+
+	cachedCommit, err, ok := next()
+	if err != nil {
+		t.Fatalf("error iterating cached commits: %v", err)
+	}
+
+	if !ok {
+		t.Fatal("not enough commits in result")
+	}
+
+	if diff := cmp.Diff(commit, cachedCommit); diff != "" {
+		t.Errorf("commit is wrong:\n%s", diff)
+	}
+
+	// -- Clear --
+	err = c.Clear()
+	if err != nil {
+		t.Fatalf("clearing cache failed with error: %v", err)
+	}
+
+	result, err = c.Get(revs)
+	if err != nil {
+		t.Fatalf(
+			"get commits from cache after clear failed with error: %v",
+			err,
+		)
+	}
+
+	commits, err := iterutils.Collect(result.Commits)
+	if err != nil {
+		t.Fatalf("error collecting commits: %v", err)
+	}
+
+	if len(commits) > 0 {
+		t.Errorf("cache result after clear should have been empty")
+	}
+}
+
+func testAddGetAddGet(t *testing.T, newBackend newBackendFunc) {
+	c := newBackend(CacheDir(t))
+
+	err := c.Open()
+	if err != nil {
+		t.Fatalf("could not open cache: %v", err)
+	}
+	defer func() {
+		err = c.Close()
+		if err != nil {
+			t.Fatalf("could not close cache: %v", err)
+		}
+	}()
+
+	commitOne := git.Commit{
+		ShortHash:   "1e9ea7662b1",
+		Hash:        "1e9ea7662b1001d860471a4cece5e2f1de8062fb",
+		AuthorName:  "John",
+		AuthorEmail: "john@doe.local",
+		Date: time.Date(
+			2025, 1, 30, 16, 35, 26, 0, time.UTC,
+		),
+		FileDiffs: []git.FileDiff{
+			{
+				Path:         "foo/bar.txt",
+				LinesAdded:   3,
+				LinesRemoved: 5,
+			},
+		},
+	}
+	commitTwo := git.Commit{
+		ShortHash:   "2e9ea7662b1",
+		Hash:        "2e9ea7662b1001d860471a4cece5e2f1de8062fb",
+		AuthorName:  "John",
+		AuthorEmail: "john@doe.local",
+		Date: time.Date(
+			2025, 1, 31, 16, 35, 26, 0, time.UTC,
+		),
+		FileDiffs: []git.FileDiff{
+			{
+				Path:         "foo/bim.txt",
+				LinesAdded:   4,
+				LinesRemoved: 0,
+			},
+		},
+	}
+	revs := []string{commitOne.Hash, commitTwo.Hash}
+
+	err = c.Add([]git.Commit{commitOne})
+	if err != nil {
+		t.Fatalf("add commits to cache failed with error: %v", err)
+	}
+
+	result, err := c.Get(revs)
+	if err != nil {
+		t.Fatalf("get commits from cache failed with error: %v", err)
+	}
+
+	commits, err := iterutils.Collect(result.Commits)
+	if err != nil {
+		t.Fatalf("error collecting commits: %v", err)
+	}
+
+	if len(commits) != 1 {
+		t.Errorf(
+			"expected to get one commit from cache, but got %d",
+			len(commits),
+		)
+	}
+
+	err = c.Add([]git.Commit{commitTwo})
+	if err != nil {
+		t.Fatalf("add commits to cache failed with error: %v", err)
+	}
+
+	result, err = c.Get(revs)
+	if err != nil {
+		t.Fatalf("get commits from cache failed with error: %v", err)
+	}
+
+	commits, err = iterutils.Collect(result.Commits)
+	if err != nil {
+		t.Fatalf("error collecting commits: %v", err)
+	}
+
+	if len(commits) != 2 {
+		t.Errorf(
+			"expected to get two commits from cache, but got %d",
+			len(commits),
+		)
+	}
+}
+
+func testStatsPrune(t *testing.T, newBackend newBackendFunc) {
+	c := cache.NewCache(newBackend(CacheDir(t)))
+
+	err := c.Open()
+	if err != nil {
+		t.Fatalf("could not open cache: %v", err)
+	}
+	defer func() {
+		err = c.Close()
+		if err != nil {
+			t.Fatalf("could not close cache: %v", err)
+		}
+	}()
+
+	commitOne := git.Commit{
+		ShortHash:   "1e9ea7662b1",
+		Hash:        "1e9ea7662b1001d860471a4cece5e2f1de8062fb",
+		AuthorName:  "John",
+		AuthorEmail: "john@doe.local",
+	}
+	commitTwo := git.Commit{
+		ShortHash:   "2e9ea7662b1",
+		Hash:        "2e9ea7662b1001d860471a4cece5e2f1de8062fb",
+		AuthorName:  "John",
+		AuthorEmail: "john@doe.local",
+	}
+
+	err = c.Add([]git.Commit{commitOne})
+	if err != nil {
+		t.Fatalf("add commits to cache failed with error: %v", err)
+	}
+	err = c.Add([]git.Commit{commitTwo})
+	if err != nil {
+		t.Fatalf("add commits to cache failed with error: %v", err)
+	}
+
+	stats, err := c.Stats()
+	if err != nil {
+		t.Fatalf("reading cache stats failed with error: %v", err)
+	}
+
+	if stats.Commits != 2 {
+		t.Errorf("expected 2 commits in cache, but got %d", stats.Commits)
+	}
+
+	removed, err := c.Prune([]string{commitTwo.Hash})
+	if err != nil {
+		t.Fatalf("pruning cache failed with error: %v", err)
+	}
+
+	if removed != 1 {
+		t.Errorf("expected prune to remove 1 commit, but removed %d", removed)
+	}
+
+	result, err := c.Get([]string{commitOne.Hash, commitTwo.Hash})
+	if err != nil {
+		t.Fatalf("get commits from cache failed with error: %v", err)
+	}
+
+	commits, err := iterutils.Collect(result.Commits)
+	if err != nil {
+		t.Fatalf("error collecting commits: %v", err)
+	}
+
+	if diff := cmp.Diff([]git.Commit{commitTwo}, commits); diff != "" {
+		t.Errorf("pruned cache is wrong:\n%s", diff)
+	}
+}
+
+func testReadOnlyWhileLocked(t *testing.T, newBackend newBackendFunc) {
+	dir := CacheDir(t)
+	if _, ok := newBackend(dir).(lockingBackend); !ok {
+		t.Skip("backend does not lock the cache")
+	}
+
+	commitOne := git.Commit{
+		ShortHash: "1e9ea7662b1",
+		Hash:      "1e9ea7662b1001d860471a4cece5e2f1de8062fb",
+	}
+	commitTwo := git.Commit{
+		ShortHash: "2e9ea7662b1",
+		Hash:      "2e9ea7662b1001d860471a4cece5e2f1de8062fb",
+	}
+	commitThree := git.Commit{
+		ShortHash: "3e9ea7662b1",
+		Hash:      "3e9ea7662b1001d860471a4cece5e2f1de8062fb",
+	}
+	revs := []string{commitOne.Hash, commitTwo.Hash, commitThree.Hash}
+
+	get := func(c cache.Backend) []git.Commit {
+		result, err := c.Get(revs)
+		if err != nil {
+			t.Fatalf("get commits from cache failed with error: %v", err)
+		}
+
+		commits, err := iterutils.Collect(result.Commits)
+		if err != nil {
+			t.Fatalf("error collecting commits: %v", err)
+		}
+
+		return commits
+	}
+
+	// Write a first commit and close so that it is compacted on disk
+	writer := newBackend(dir).(lockingBackend)
+	if err := writer.Open(); err != nil {
+		t.Fatalf("could not open cache: %v", err)
+	}
+	if err := writer.Add([]git.Commit{commitOne}); err != nil {
+		t.Fatalf("add commits to cache failed with error: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("could not close cache: %v", err)
+	}
+
+	// Hold the lock while a second cache is opened
+	writer = newBackend(dir).(lockingBackend)
+	if err := writer.Open(); err != nil {
+		t.Fatalf("could not open cache: %v", err)
+	}
+
+	reader := newBackend(dir).(lockingBackend)
+	if err := reader.Open(); err != nil {
+		t.Fatalf("could not open cache read-only: %v", err)
+	}
+
+	if writer.ReadOnly() || !reader.ReadOnly() {
+		t.Fatalf(
+			"expected only second cache to be read-only, got %v and %v",
+			writer.ReadOnly(),
+			reader.ReadOnly(),
+		)
+	}
+
+	if diff := cmp.Diff([]git.Commit{commitOne}, get(reader)); diff != "" {
+		t.Errorf("read-only cache is wrong:\n%s", diff)
+	}
+
+	if err := reader.Add([]git.Commit{commitTwo}); err != nil {
+		t.Fatalf("add commits to read-only cache failed with error: %v", err)
+	}
+	if err := writer.Add([]git.Commit{commitThree}); err != nil {
+		t.Fatalf("add commits to cache failed with error: %v", err)
+	}
+
+	if err := reader.Close(); err != nil {
+		t.Fatalf("could not close read-only cache: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("could not close cache: %v", err)
+	}
+
+	// Only the writer's commits were kept, and the lock was released
+	c := newBackend(dir).(lockingBackend)
+	if err := c.Open(); err != nil {
+		t.Fatalf("could not open cache: %v", err)
+	}
+	defer c.Close()
+
+	if c.ReadOnly() {
+		t.Errorf("expected cache to be writable after lock was released")
+	}
+
+	expected := []git.Commit{commitOne, commitThree}
+	if diff := cmp.Diff(expected, get(c)); diff != "" {
+		t.Errorf("cache is wrong:\n%s", diff)
+	}
+}
+
+func testAggregates(t *testing.T, newBackend newBackendFunc) {
+	c := newBackend(CacheDir(t))
+
+	err := c.Open()
+	if err != nil {
+		t.Fatalf("could not open cache: %v", err)
+	}
+
+	_, ok, err := c.GetAggregate("by-path")
+	if err != nil {
+		t.Fatalf("get aggregate from cache failed with error: %v", err)
+	}
+	if ok {
+		t.Errorf("found aggregate in empty cache")
+	}
+
+	aggregate := cache.Aggregate{
+		Tip:      "9e9ea7662b1001d860471a4cece5e2f1de8062fb",
+		Excluded: map[string]bool{"go.sum": true, "main.go": false},
+		Tally:    []byte("tally"),
+	}
+
+	err = c.SetAggregate("by-path", aggregate)
+	if err != nil {
+		t.Fatalf("set aggregate in cache failed with error: %v", err)
+	}
+
+	err = c.Close()
+	if err != nil {
+		t.Fatalf("could not close cache: %v", err)
+	}
+
+	// Aggregates should survive closing the cache
+	err = c.Open()
+	if err != nil {
+		t.Fatalf("could not open cache: %v", err)
+	}
+	defer c.Close()
+
+	saved, ok, err := c.GetAggregate("by-path")
+	if err != nil {
+		t.Fatalf("get aggregate from cache failed with error: %v", err)
+	}
+	if !ok {
+		t.Fatalf("aggregate not found in cache")
+	}
+
+	if diff := cmp.Diff(aggregate, saved); diff != "" {
+		t.Errorf("aggregate is wrong:\n%s", diff)
+	}
+
+	_, ok, err = c.GetAggregate("by-date")
+	if err != nil {
+		t.Fatalf("get aggregate from cache failed with error: %v", err)
+	}
+	if ok {
+		t.Errorf("found aggregate under the wrong key")
+	}
+
+	stats, err := c.Stats()
+	if err != nil {
+		t.Fatalf("reading cache stats failed with error: %v", err)
+	}
+	if stats.Aggregates != 1 {
+		t.Errorf("expected 1 aggregate in cache, but got %d", stats.Aggregates)
+	}
+}
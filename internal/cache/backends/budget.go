@@ -0,0 +1,298 @@
+package backends
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Records when the cache of each repository was last used, so that the least
+// recently used caches can be evicted once the caches of all repositories
+// together take up more space than the budget allows.
+//
+// The manifest is stored as JSON in the root cache directory, next to the
+// directory of each backend. Repositories are identified by the path of their
+// cache directory relative to the root, e.g. "gob/git-author-1a2b3c4d".
+type Manifest struct {
+	LastUsed map[string]time.Time `json:"lastUsed"`
+}
+
+const manifestFilename = "manifest.json"
+
+// Taken while the manifest is read and written
+const manifestLockFilename = "manifest.lock"
+
+// The size and last use of a repository's cache.
+type repoUsage struct {
+	name     string // Relative to the root cache directory
+	dir      string
+	size     int64
+	lastUsed time.Time
+}
+
+// Records that the cache in repoDir, a directory for one repository under
+// root, was used at now.
+//
+// If budget is greater than zero and the caches of all repositories take up
+// more than budget bytes, the least recently used caches are cleared until they
+// fit. The cache in repoDir is never cleared, nor is any cache another process
+// has open for writing. Returns the directories of the caches cleared.
+func UseRepoCache(
+	root string,
+	repoDir string,
+	budget int64,
+	now time.Time,
+) (_ []string, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to update cache manifest: %w", err)
+		}
+	}()
+
+	name, err := filepath.Rel(root, repoDir)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(root, 0o700)
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := acquireLock(filepath.Join(root, manifestLockFilename), true)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		unlockErr := releaseLock(lock)
+		if err == nil {
+			err = unlockErr
+		}
+	}()
+
+	manifest, err := readManifest(root)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest.LastUsed[name] = now
+
+	evicted := []string{}
+	if budget > 0 {
+		evicted, err = evict(root, &manifest, name, budget)
+		if err != nil {
+			return evicted, err
+		}
+	}
+
+	return evicted, writeManifest(root, manifest)
+}
+
+// Clears least recently used caches until all of them fit within budget.
+// Caches missing from the manifest count as last used when their directory
+// was last modified.
+func evict(
+	root string,
+	manifest *Manifest,
+	current string,
+	budget int64,
+) (_ []string, err error) {
+	dirs, err := filepath.Glob(filepath.Join(root, "*", "*"))
+	if err != nil {
+		panic(err) // Bad pattern
+	}
+
+	usages := []repoUsage{}
+	var total int64
+
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			continue
+		}
+
+		name, err := filepath.Rel(root, dir)
+		if err != nil {
+			return nil, err
+		}
+
+		size, err := dirSize(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		lastUsed, ok := manifest.LastUsed[name]
+		if !ok {
+			lastUsed = info.ModTime()
+		}
+
+		total += size
+		usages = append(usages, repoUsage{
+			name:     name,
+			dir:      dir,
+			size:     size,
+			lastUsed: lastUsed,
+		})
+	}
+
+	// Forget caches that were deleted
+	for name := range manifest.LastUsed {
+		found := slices.ContainsFunc(usages, func(u repoUsage) bool {
+			return u.name == name
+		})
+		if !found && name != current {
+			delete(manifest.LastUsed, name)
+		}
+	}
+
+	slices.SortFunc(usages, func(a repoUsage, b repoUsage) int {
+		return a.lastUsed.Compare(b.lastUsed)
+	})
+
+	evicted := []string{}
+	for _, usage := range usages {
+		if total <= budget {
+			break
+		}
+
+		if usage.name == current || usage.size == 0 {
+			continue
+		}
+
+		ok, err := evictRepoDir(usage.dir)
+		if err != nil {
+			return evicted, err
+		}
+
+		if !ok {
+			logger().Debug("cache is in use; not evicting it", "dir", usage.dir)
+			continue
+		}
+
+		logger().Debug(
+			"evicted cache",
+			"dir",
+			usage.dir,
+			"size",
+			usage.size,
+			"lastUsed",
+			usage.lastUsed,
+		)
+
+		total -= usage.size
+		evicted = append(evicted, usage.dir)
+		delete(manifest.LastUsed, usage.name)
+	}
+
+	if total > budget {
+		logger().Debug("caches still exceed budget", "total", total, "budget", budget)
+	}
+
+	return evicted, nil
+}
+
+// Deletes everything in dir but the lock file, unless another process holds
+// the lock. Returns false if it does.
+func evictRepoDir(dir string) (_ bool, err error) {
+	lock, err := acquireLock(filepath.Join(dir, lockFilename), false)
+	if err != nil || lock == nil {
+		return false, err
+	}
+	defer func() {
+		unlockErr := releaseLock(lock)
+		if err == nil {
+			err = unlockErr
+		}
+	}()
+
+	return true, removeAllButLock(dir)
+}
+
+// Returns the total size of the files under dir in bytes.
+func dirSize(dir string) (int64, error) {
+	var size int64
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil // Deleted while we were walking
+		} else if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		size += info.Size()
+		return nil
+	})
+
+	return size, err
+}
+
+func readManifest(root string) (Manifest, error) {
+	manifest := Manifest{LastUsed: map[string]time.Time{}}
+
+	data, err := os.ReadFile(filepath.Join(root, manifestFilename))
+	if errors.Is(err, fs.ErrNotExist) {
+		return manifest, nil
+	} else if err != nil {
+		return manifest, err
+	}
+
+	err = json.Unmarshal(data, &manifest)
+	if err != nil || manifest.LastUsed == nil {
+		// Only costs us the order in which caches are evicted
+		logger().Warn("cache manifest is unreadable; starting a new one")
+		return Manifest{LastUsed: map[string]time.Time{}}, nil
+	}
+
+	return manifest, nil
+}
+
+// Replaces the manifest atomically, so that it is never seen half-written.
+func writeManifest(root string, manifest Manifest) (err error) {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(root, manifestFilename+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		f.Close()
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+
+	_, err = f.Write(data)
+	if err != nil {
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), filepath.Join(root, manifestFilename))
+}
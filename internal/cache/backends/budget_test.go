@@ -0,0 +1,248 @@
+package backends_test
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/trinhminhtriet/git-author/internal/cache"
+	"github.com/trinhminhtriet/git-author/internal/cache/backends"
+	"github.com/trinhminhtriet/git-author/internal/git"
+	"github.com/trinhminhtriet/git-author/internal/utils/iterutils"
+)
+
+type budgetRepo struct {
+	dir     string
+	backend func() cache.Backend
+	revs    []string
+}
+
+// Creates a cache for one repository under root, holding a few commits.
+func newBudgetRepo(t *testing.T, root string, kind string, name string) budgetRepo {
+	dir := filepath.Join(root, kind, name)
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		t.Fatalf("could not create cache dir: %v", err)
+	}
+
+	repo := budgetRepo{dir: dir}
+	switch kind {
+	case backends.IndexedBackendName:
+		repo.backend = func() cache.Backend {
+			return &backends.IndexedBackend{
+				Dir:  dir,
+				Path: filepath.Join(dir, "commits"),
+			}
+		}
+	default:
+		repo.backend = func() cache.Backend {
+			return &backends.GobBackend{
+				Dir:  dir,
+				Path: filepath.Join(dir, "commits.gob"),
+			}
+		}
+	}
+
+	commits := []git.Commit{}
+	for i := range 20 {
+		hash := fmt.Sprintf("%x", sha1.Sum(fmt.Appendf(nil, "%s-%d", name, i)))
+		commits = append(commits, git.Commit{
+			ShortHash: hash[:11],
+			Hash:      hash,
+			FileDiffs: []git.FileDiff{
+				{Path: fmt.Sprintf("%s/file%d.txt", name, i), LinesAdded: i},
+			},
+		})
+		repo.revs = append(repo.revs, hash)
+	}
+
+	b := repo.backend()
+	if err := b.Open(); err != nil {
+		t.Fatalf("could not open cache: %v", err)
+	}
+	if err := b.Add(commits); err != nil {
+		t.Fatalf("add commits to cache failed with error: %v", err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatalf("could not close cache: %v", err)
+	}
+
+	return repo
+}
+
+// Returns the number of commits still in the repository's cache.
+func (r budgetRepo) count(t *testing.T) int {
+	b := r.backend()
+	if err := b.Open(); err != nil {
+		t.Fatalf("could not open cache: %v", err)
+	}
+	defer func() {
+		if err := b.Close(); err != nil {
+			t.Fatalf("could not close cache: %v", err)
+		}
+	}()
+
+	result, err := b.Get(r.revs)
+	if err != nil {
+		t.Fatalf("get commits from cache failed with error: %v", err)
+	}
+
+	commits, err := iterutils.Collect(result.Commits)
+	if err != nil {
+		t.Fatalf("error collecting commits: %v", err)
+	}
+
+	return len(commits)
+}
+
+// Returns the space taken up by the repositories' caches, leaving out the
+// manifest.
+func totalSize(t *testing.T, repos []budgetRepo) int64 {
+	var size int64
+	for _, repo := range repos {
+		err := filepath.WalkDir(repo.dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+
+			size += info.Size()
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("could not measure cache size: %v", err)
+		}
+	}
+
+	return size
+}
+
+// Sets up four repository caches across both backends, used one hour apart in
+// order. The last one is the current repository.
+func setupBudgetRepos(t *testing.T) (string, []budgetRepo, time.Time) {
+	root := t.TempDir()
+	repos := []budgetRepo{
+		newBudgetRepo(t, root, backends.GobBackendName, "oldest"),
+		newBudgetRepo(t, root, backends.IndexedBackendName, "older"),
+		newBudgetRepo(t, root, backends.GobBackendName, "newer"),
+		newBudgetRepo(t, root, backends.IndexedBackendName, "current"),
+	}
+
+	now := time.Date(2025, 1, 31, 16, 0, 0, 0, time.UTC)
+	for i, repo := range repos[:len(repos)-1] {
+		usedAt := now.Add(time.Duration(i-len(repos)) * time.Hour)
+		evicted, err := backends.UseRepoCache(root, repo.dir, 0, usedAt)
+		if err != nil {
+			t.Fatalf("could not record cache use: %v", err)
+		}
+		if len(evicted) > 0 {
+			t.Fatalf("evicted %v without a budget", evicted)
+		}
+	}
+
+	return root, repos, now
+}
+
+func TestUseRepoCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	root, repos, now := setupBudgetRepos(t)
+	current := repos[len(repos)-1]
+
+	// Just over budget, so only the least recently used cache goes
+	budget := totalSize(t, repos) - 1
+	evicted, err := backends.UseRepoCache(root, current.dir, budget, now)
+	if err != nil {
+		t.Fatalf("could not record cache use: %v", err)
+	}
+
+	if !slices.Equal(evicted, []string{repos[0].dir}) {
+		t.Errorf("expected only %s to be evicted, got %v", repos[0].dir, evicted)
+	}
+
+	for i, want := range []int{0, 20, 20, 20} {
+		if got := repos[i].count(t); got != want {
+			t.Errorf("expected %d commits in %s, got %d", want, repos[i].dir, got)
+		}
+	}
+
+	// Far over budget, so everything but the current cache goes
+	evicted, err = backends.UseRepoCache(root, current.dir, 1, now)
+	if err != nil {
+		t.Fatalf("could not record cache use: %v", err)
+	}
+
+	if !slices.Equal(evicted, []string{repos[1].dir, repos[2].dir}) {
+		t.Errorf("expected older caches to be evicted, got %v", evicted)
+	}
+
+	for i, want := range []int{0, 0, 0, 20} {
+		if got := repos[i].count(t); got != want {
+			t.Errorf("expected %d commits in %s, got %d", want, repos[i].dir, got)
+		}
+	}
+}
+
+func TestUseRepoCacheSkipsLockedCache(t *testing.T) {
+	root, repos, now := setupBudgetRepos(t)
+	current := repos[len(repos)-1]
+
+	// Another process is writing to the least recently used cache
+	writer := repos[0].backend()
+	if err := writer.Open(); err != nil {
+		t.Fatalf("could not open cache: %v", err)
+	}
+
+	evicted, err := backends.UseRepoCache(root, current.dir, 1, now)
+	if err != nil {
+		t.Fatalf("could not record cache use: %v", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatalf("could not close cache: %v", err)
+	}
+
+	if !slices.Equal(evicted, []string{repos[1].dir, repos[2].dir}) {
+		t.Errorf("expected unlocked caches to be evicted, got %v", evicted)
+	}
+
+	for i, want := range []int{20, 0, 0, 20} {
+		if got := repos[i].count(t); got != want {
+			t.Errorf("expected %d commits in %s, got %d", want, repos[i].dir, got)
+		}
+	}
+}
+
+func TestUseRepoCacheWithoutManifest(t *testing.T) {
+	root, repos, now := setupBudgetRepos(t)
+	current := repos[len(repos)-1]
+
+	// Caches we have no record of are evicted in order of modification time
+	err := os.Remove(filepath.Join(root, "manifest.json"))
+	if err != nil {
+		t.Fatalf("could not remove manifest: %v", err)
+	}
+
+	for i, repo := range repos[:len(repos)-1] {
+		mtime := now.Add(time.Duration(len(repos)-i) * -time.Hour)
+		if err := os.Chtimes(repo.dir, mtime, mtime); err != nil {
+			t.Fatalf("could not set modification time: %v", err)
+		}
+	}
+
+	evicted, err := backends.UseRepoCache(root, current.dir, totalSize(t, repos)-1, now)
+	if err != nil {
+		t.Fatalf("could not record cache use: %v", err)
+	}
+
+	if !slices.Equal(evicted, []string{repos[0].dir}) {
+		t.Errorf("expected only %s to be evicted, got %v", repos[0].dir, evicted)
+	}
+}
@@ -0,0 +1,278 @@
+package backends
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"iter"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/trinhminhtriet/git-author/internal/cache"
+)
+
+// Helpers shared by the backends that keep one directory of files per repo.
+
+const lockFilename = "lock"
+
+// Returns the directory in which to store the cache for the repo at
+// gitRootPath.
+func RepoCacheDir(prefix string, gitRootPath string) string {
+	// Filename includes hash of path to repo so we don't collide with other
+	// git-author caches for other repos.
+	h := fnv.New32()
+	h.Write([]byte(gitRootPath))
+
+	base := filepath.Base(gitRootPath)
+	dirname := fmt.Sprintf("%s-%x", base, h.Sum32())
+	repoDir := filepath.Join(prefix, dirname)
+	return repoDir
+}
+
+// Deletes every file in dir except aggregateDir and those in keep, along with
+// any temporary files left behind in aggregateDir.
+//
+// These are caches written for an older repo state or cache format version, or
+// files left behind by a process that didn't close the cache.
+func removeStale(dir string, aggregateDir string, keep ...string) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		panic(err) // Bad pattern
+	}
+
+	tmpMatches, err := filepath.Glob(filepath.Join(aggregateDir, "*.tmp"))
+	if err != nil {
+		panic(err) // Bad pattern
+	}
+	matches = append(matches, tmpMatches...)
+
+	for _, match := range matches {
+		if match == aggregateDir || slices.Contains(keep, match) {
+			continue
+		}
+
+		logger().Debug("discarding stale cache file", "path", match)
+
+		err := os.RemoveAll(match)
+		if err != nil {
+			logger().Warn(
+				fmt.Sprintf("failed to delete old cache file: %v", err),
+			)
+		}
+	}
+}
+
+// Deletes everything in dir but the lock file.
+func removeAllButLock(dir string) error {
+	matches, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		panic(err) // Bad pattern
+	}
+
+	for _, match := range matches {
+		if filepath.Base(match) == lockFilename {
+			continue
+		}
+
+		err = os.RemoveAll(match)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Both backends store Gob-encoded data in frames. Each frame is prefixed with
+// two four-byte values: the number of bytes in the frame, and their CRC-32C
+// checksum. The checksum lets us find frames that were only partly written, or
+// were damaged on disk, and drop just those instead of the whole cache.
+
+const framePrefixSize = 8
+
+// Largest frame we will write or read
+const maxFrameSize = 0x7FFF_FFFF
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	errCorruptFrame   = errors.New("cache frame does not match its checksum")
+	errTruncatedFrame = errors.New("cache frame is truncated")
+)
+
+// Appends data to buf as a frame.
+func appendFrame(buf []byte, data []byte) ([]byte, error) {
+	if len(data) > maxFrameSize {
+		return buf, errors.New(
+			"cannot add more than 2,147,483,647 bytes to cache at once", // lol
+		)
+	}
+
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(data)))
+	buf = binary.LittleEndian.AppendUint32(buf, crc32.Checksum(data, crcTable))
+	return append(buf, data...), nil
+}
+
+// Checks the data in a frame against the prefix it was written with.
+func checkFrame(prefix []byte, data []byte) error {
+	size := binary.LittleEndian.Uint32(prefix)
+	sum := binary.LittleEndian.Uint32(prefix[4:])
+
+	if int64(size) != int64(len(data)) {
+		return errTruncatedFrame
+	}
+
+	if crc32.Checksum(data, crcTable) != sum {
+		return errCorruptFrame
+	}
+
+	return nil
+}
+
+type frame struct {
+	offset int64 // Position of the prefix
+	data   []byte
+}
+
+// Reads each frame in turn, yielding the data in it along with the offset of
+// the frame's prefix.
+//
+// Frames that don't match their checksum yield errCorruptFrame, after which
+// we carry on with the next frame. A frame cut short by the end of the file
+// yields errTruncatedFrame and ends the sequence. Any other error ends it too.
+func readFrames(r io.Reader) iter.Seq2[frame, error] {
+	return func(yield func(frame, error) bool) {
+		var offset int64
+		prefix := make([]byte, framePrefixSize)
+
+		for {
+			// -- Find length of next frame in bytes --
+			n, err := io.ReadFull(r, prefix)
+			if err == io.EOF {
+				return
+			} else if err == io.ErrUnexpectedEOF {
+				yield(frame{offset: offset}, errTruncatedFrame)
+				return
+			} else if err != nil {
+				yield(frame{offset: offset}, err)
+				return
+			}
+
+			size := int64(binary.LittleEndian.Uint32(prefix))
+			if size > maxFrameSize {
+				// We can't tell where the next frame starts
+				yield(frame{offset: offset}, errTruncatedFrame)
+				return
+			}
+
+			// -- Read the frame --
+			data, err := io.ReadAll(io.LimitReader(r, size))
+			if err != nil {
+				yield(frame{offset: offset}, err)
+				return
+			}
+
+			f := frame{offset: offset, data: data}
+			offset += int64(n) + int64(len(data))
+
+			err = checkFrame(prefix, data)
+			if errors.Is(err, errTruncatedFrame) {
+				yield(f, err)
+				return
+			}
+
+			if !yield(f, err) {
+				return
+			}
+		}
+	}
+}
+
+// The key is saved with the aggregate in case two keys hash to the same file.
+type savedAggregate struct {
+	Key       string
+	Aggregate cache.Aggregate
+}
+
+func aggregatePath(dir string, key string) string {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return filepath.Join(dir, fmt.Sprintf("%x.gob", h.Sum64()))
+}
+
+func readAggregate(dir string, key string) (_ cache.Aggregate, _ bool, err error) {
+	var saved savedAggregate
+
+	f, err := os.Open(aggregatePath(dir, key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return saved.Aggregate, false, nil
+	} else if err != nil {
+		return saved.Aggregate, false, err
+	}
+	defer f.Close() // Don't care about error closing when reading
+
+	err = gob.NewDecoder(bufio.NewReader(f)).Decode(&saved)
+	if err != nil {
+		return saved.Aggregate, false, err
+	}
+
+	if saved.Key != key {
+		return cache.Aggregate{}, false, nil
+	}
+
+	return saved.Aggregate, true, nil
+}
+
+// Replaces any aggregate saved under the same key. Written atomically, so that
+// read-only caches in other processes see either the old or the new one.
+func writeAggregate(dir string, key string, a cache.Aggregate) (err error) {
+	err = os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(dir, "*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		f.Close()
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+
+	w := bufio.NewWriter(f)
+	err = gob.NewEncoder(w).Encode(savedAggregate{Key: key, Aggregate: a})
+	if err != nil {
+		return err
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), aggregatePath(dir, key))
+}
+
+func countAggregates(dir string) int {
+	aggregates, err := filepath.Glob(filepath.Join(dir, "*.gob"))
+	if err != nil {
+		panic(err) // Bad pattern
+	}
+
+	return len(aggregates)
+}
@@ -4,13 +4,12 @@ import (
 	"bufio"
 	"bytes"
 	"compress/gzip"
-	"encoding/binary"
 	"encoding/gob"
 	"errors"
 	"fmt"
-	"hash/fnv"
 	"io"
 	"io/fs"
+	"iter"
 	"os"
 	"path/filepath"
 
@@ -21,11 +20,11 @@ import (
 // Stores commits on disk at a particular filepath.
 //
 // Commits are stored in Gob format. The file stored on disk is a series of
-// Gob-encoded arrays, each prefixed with a four-byte value indicating the
-// number of bytes in the next array. This framing creates redundancy (since
-// the Gob type metadata is repeated for each array) but allows us to append to
-// the file on disk instead of replacing the whole file when we want to cache
-// new commits.
+// frames, each holding a Gob-encoded array of commits. This framing creates
+// redundancy (since the Gob type metadata is repeated for each array) but
+// allows us to append to the file on disk instead of replacing the whole file
+// when we want to cache new commits. It also means a frame that was only partly
+// written, or damaged on disk, can be dropped without losing the others.
 //
 // The Gob backend produces a cache file roughly half the size of the JSON
 // backend on disk. It's also SIGNIFICANTLY faster to read the cache from disk
@@ -33,11 +32,25 @@ import (
 //
 // We also gzip the file when we're done using it to keep it even smaller on
 // disk.
+//
+// Only one process at a time may write to the cache. Open() takes an advisory
+// lock on a file in Dir that is held until Close(). If another process already
+// holds the lock, the cache is opened read-only instead: commits are read from
+// a private copy and commits added are dropped.
 type GobBackend struct {
 	Dir       string
 	Path      string
+	Wait      bool // Wait for the lock instead of opening read-only
 	wasOpened bool
+	isOpen    bool
 	isDirty   bool
+	readOnly  bool
+	lock      *os.File // Held from Open() to Close() unless read-only
+	workPath  string   // Uncompressed file we read from and append to
+
+	// Set when we read a frame that was corrupt, so that the file is repaired
+	// when the cache is closed
+	needsRepair bool
 }
 
 const GobBackendName string = "gob"
@@ -50,108 +63,239 @@ func (b *GobBackend) compressedPath() string {
 	return b.Path + ".gz"
 }
 
+func (b *GobBackend) lockPath() string {
+	return filepath.Join(b.Dir, lockFilename)
+}
+
+// Aggregates are saved alongside the commits they were tallied from, so they
+// are discarded with them when the repo state changes.
+func (b *GobBackend) aggregateDir() string {
+	return b.Path + ".aggregates"
+}
+
+// True if the cache was opened read-only because another process is writing to
+// it.
+func (b *GobBackend) ReadOnly() bool {
+	return b.readOnly
+}
+
 func (b *GobBackend) Open() (err error) {
 	b.wasOpened = true
+	b.workPath = b.Path
+
+	err = os.MkdirAll(b.Dir, 0o700)
+	if err != nil {
+		return err
+	}
+
+	b.lock, err = acquireLock(b.lockPath(), b.Wait)
+	if err != nil {
+		return err
+	}
+
+	if b.lock == nil {
+		logger().Debug(
+			"cache is locked by another process; opening read-only",
+			"dir",
+			b.Dir,
+		)
 
-	// Uncompress gzipped file to regular location if it exists
+		b.readOnly = true
+
+		f, err := os.CreateTemp("", "git-author-*.gobs")
+		if err != nil {
+			return err
+		}
+		f.Close()
+
+		b.workPath = f.Name()
+	}
+
+	defer func() {
+		if err != nil {
+			b.needsRepair = false // Nothing was read that could be repaired
+			b.release()
+		} else {
+			b.isOpen = true
+		}
+	}()
+
+	// Uncompress gzipped file to our working location if it exists. The
+	// gzipped file is only ever replaced by a rename, so we always see a
+	// complete file even if another process is writing to the cache.
 	f, err := os.Open(b.compressedPath())
 	if errors.Is(err, fs.ErrNotExist) {
+		if b.readOnly {
+			return nil
+		}
+
+		// Left behind by a process that didn't close the cache
+		err = os.RemoveAll(b.workPath)
+		if err != nil {
+			return err
+		}
+
 		return nil
 	} else if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	fout, err := os.OpenFile(b.Path, os.O_WRONLY|os.O_CREATE, 0644)
+	fout, err := os.OpenFile(
+		b.workPath,
+		os.O_WRONLY|os.O_CREATE|os.O_TRUNC,
+		0644,
+	)
 	if err != nil {
 		return err
 	}
 	defer fout.Close()
 
+	// If the gzipped file was damaged, keep what we could uncompress. Any
+	// frame cut short at the end is dropped when the file is repaired. If not
+	// even the header can be read, we start over with an empty cache, which
+	// replaces the damaged file when the cache is closed.
 	zr, err := gzip.NewReader(f)
-	if err != nil {
-		return err
-	}
-
-	w := bufio.NewWriter(fout)
-	_, err = io.Copy(w, zr)
-	if err != nil {
+	if isDamagedGzip(err) || errors.Is(err, io.EOF) {
+		logger().Warn(
+			fmt.Sprintf("cache file is damaged; starting over: %v", err),
+		)
+		b.isDirty = true
+		return nil
+	} else if err != nil {
 		return err
 	}
 
-	err = zr.Close()
-	if err != nil {
-		return err
+	// Copy straight to the file, since a bufio.Writer would hold on to the
+	// error from the reader and return it again when flushed
+	_, err = io.Copy(fout, zr)
+	if isDamagedGzip(err) {
+		logger().Warn(
+			fmt.Sprintf("cache file is damaged; keeping what we can: %v", err),
+		)
+		b.needsRepair = true
+		return nil
 	}
 
-	err = w.Flush()
-	if err != nil {
-		return err
-	}
+	return err
+}
 
-	return nil
+// True if err means the gzipped file is cut short or corrupt.
+func isDamagedGzip(err error) bool {
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, gzip.ErrChecksum) ||
+		errors.Is(err, gzip.ErrHeader)
 }
 
 func (b *GobBackend) Close() (err error) {
-	if b.isDirty {
-		// Compress file and save to gzipped location
-		f, err := os.Open(b.Path)
-		if errors.Is(err, fs.ErrNotExist) {
-			return nil
-		} else if err != nil {
-			return err
-		}
-		defer f.Close()
+	defer b.release()
 
-		fout, err := os.OpenFile(b.compressedPath(), os.O_WRONLY|os.O_CREATE, 0644)
-		if err != nil {
-			return err
-		}
-		defer fout.Close()
+	if b.readOnly || b.lock == nil {
+		return nil // Read-only, or Open() failed
+	}
 
-		r := bufio.NewReader(f)
-		zw, err := gzip.NewWriterLevel(fout, gzip.BestSpeed)
+	if b.needsRepair {
+		_, err = b.Verify(true)
 		if err != nil {
 			return err
 		}
+	}
 
-		_, err = io.Copy(zw, r)
+	if b.isDirty {
+		err = b.compress()
 		if err != nil {
 			return err
 		}
+	}
+
+	// Remove uncompressed file
+	err = os.RemoveAll(b.workPath)
+	if err != nil {
+		return err
+	}
+
+	// Remove any other dangling cache files
+	removeStale(
+		b.Dir,
+		b.aggregateDir(),
+		b.compressedPath(),
+		b.lockPath(),
+	)
+
+	return nil
+}
 
-		err = zw.Close()
+// Compresses the working file and atomically replaces the gzipped file with it.
+func (b *GobBackend) compress() (err error) {
+	f, err := os.Open(b.workPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fout, err := os.CreateTemp(
+		b.Dir,
+		filepath.Base(b.compressedPath())+".*.tmp",
+	)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		fout.Close()
 		if err != nil {
-			return err
+			os.Remove(fout.Name())
 		}
+	}()
+
+	r := bufio.NewReader(f)
+	zw, err := gzip.NewWriterLevel(fout, gzip.BestSpeed)
+	if err != nil {
+		return err
 	}
 
-	// Remove uncompressed file
-	err = os.RemoveAll(b.Path)
+	_, err = io.Copy(zw, r)
 	if err != nil {
 		return err
 	}
 
-	// Remove any other dangling cache files
-	matches, err := filepath.Glob(filepath.Join(b.Dir, "*"))
+	err = zw.Close()
 	if err != nil {
-		panic(err) // Bad pattern
+		return err
 	}
 
-	for _, match := range matches {
-		if match == b.compressedPath() {
-			continue
-		}
+	err = fout.Close()
+	if err != nil {
+		return err
+	}
 
-		err := os.Remove(match)
-		if err != nil {
+	return os.Rename(fout.Name(), b.compressedPath())
+}
+
+// Releases the lock, or removes the private copy of a read-only cache.
+func (b *GobBackend) release() {
+	b.isOpen = false
+
+	if b.readOnly {
+		err := os.Remove(b.workPath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
 			logger().Warn(
-				fmt.Sprintf("failed to delete old cache file: %v", err),
+				fmt.Sprintf("failed to delete temporary cache file: %v", err),
 			)
 		}
+
+		return
 	}
 
-	return nil
+	if b.lock != nil {
+		err := releaseLock(b.lock)
+		if err != nil {
+			logger().Warn(fmt.Sprintf("failed to release cache lock: %v", err))
+		}
+
+		b.lock = nil
+	}
 }
 
 func (b *GobBackend) Get(revs []string) (_ cache.Result, err error) {
@@ -166,7 +310,7 @@ func (b *GobBackend) Get(revs []string) (_ cache.Result, err error) {
 		lookingFor[rev] = true
 	}
 
-	f, err := os.Open(b.Path)
+	f, err := os.Open(b.workPath)
 	if errors.Is(err, fs.ErrNotExist) {
 		return result, nil
 	} else if err != nil {
@@ -181,40 +325,9 @@ func (b *GobBackend) Get(revs []string) (_ cache.Result, err error) {
 	it := func(yield func(git.Commit, error) bool) {
 		defer f.Close() // Don't care about error closing when reading
 
-		for {
-			var commit git.Commit
-
-			// -- Find length of next gob in bytes --
-			prefix := make([]byte, 4)
-			_, err = f.Read(prefix)
-			if err == io.EOF {
-				return
-			} else if err != nil {
-				yield(commit, err)
-				return
-			}
-
-			var size uint32
-			err = binary.Read(
-				bytes.NewReader(prefix),
-				binary.LittleEndian,
-				&size,
-			)
+		for commits, err := range b.readGobs(bufio.NewReader(f)) {
 			if err != nil {
-				yield(commit, err)
-				return
-			}
-
-			// -- Decode next gob --
-			var commits []git.Commit
-
-			data := make([]byte, size)
-			_, err = f.Read(data)
-
-			dec := gob.NewDecoder(bytes.NewReader(data))
-			err = dec.Decode(&commits)
-			if err != nil {
-				yield(commit, err)
+				yield(git.Commit{}, err)
 				return
 			}
 
@@ -247,10 +360,42 @@ func (b *GobBackend) Add(commits []git.Commit) (err error) {
 		panic("cache not yet open. Did you forget to call Open()?")
 	}
 
+	if b.readOnly {
+		logger().Debug(
+			"cache is read-only; not adding commits",
+			"num",
+			len(commits),
+		)
+		return nil
+	}
+
+	if !b.isOpen {
+		logger().Debug(
+			"cache failed to open; not adding commits",
+			"num",
+			len(commits),
+		)
+		return nil
+	}
+
+	// Frames appended after a truncated one would be read as part of it
+	if b.needsRepair {
+		_, err = b.Verify(true)
+		if err != nil {
+			return err
+		}
+	}
+
 	b.isDirty = true
 
+	// The directory is gone if every cache was deleted since we opened this one
+	err = os.MkdirAll(b.Dir, 0o700)
+	if err != nil {
+		return err
+	}
+
 	f, err := os.OpenFile(
-		b.Path,
+		b.workPath,
 		os.O_WRONLY|os.O_APPEND|os.O_CREATE,
 		0644,
 	)
@@ -272,18 +417,12 @@ func (b *GobBackend) Add(commits []git.Commit) (err error) {
 		return err
 	}
 
-	if data.Len() > 0x7FFF_FFFF {
-		return errors.New(
-			"cannot add more than 2,147,483,648 bytes to cache at once", // lol
-		)
-	}
-
-	err = binary.Write(f, binary.LittleEndian, uint32(data.Len()))
+	buf, err := appendFrame(nil, data.Bytes())
 	if err != nil {
 		return err
 	}
 
-	_, err = f.Write(data.Bytes())
+	_, err = f.Write(buf)
 	if err != nil {
 		return err
 	}
@@ -291,25 +430,283 @@ func (b *GobBackend) Add(commits []git.Commit) (err error) {
 	return nil
 }
 
-func (b *GobBackend) Clear() error {
-	err := os.RemoveAll(b.Dir)
+// Deletes everything in Dir but the lock file, waiting for the lock if the
+// cache isn't open. A read-only cache only deletes its private copy.
+func (b *GobBackend) Clear() (err error) {
+	if b.readOnly {
+		return os.RemoveAll(b.workPath)
+	}
+
+	if b.lock == nil {
+		_, err := os.Stat(b.Dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		lock, err := acquireLock(b.lockPath(), true)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			unlockErr := releaseLock(lock)
+			if err == nil {
+				err = unlockErr
+			}
+		}()
+	}
+
+	return removeAllButLock(b.Dir)
+}
+
+// Must be called while the cache is open.
+func (b *GobBackend) Stats() (_ cache.Stats, err error) {
+	if !b.wasOpened {
+		panic("cache not yet open. Did you forget to call Open()?")
+	}
+
+	stats := cache.Stats{Path: b.compressedPath()}
+
+	info, err := os.Stat(b.compressedPath())
+	if err == nil {
+		stats.Size = info.Size()
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return stats, err
+	}
+
+	stats.Aggregates = countAggregates(b.aggregateDir())
+
+	f, err := os.Open(b.workPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return stats, nil
+	} else if err != nil {
+		return stats, err
+	}
+	defer f.Close() // Don't care about error closing when reading
+
+	for commits, err := range b.readGobs(bufio.NewReader(f)) {
+		if err != nil {
+			return stats, err
+		}
+
+		stats.Commits += len(commits)
+	}
+
+	return stats, nil
+}
+
+func (b *GobBackend) GetAggregate(key string) (cache.Aggregate, bool, error) {
+	if !b.wasOpened {
+		panic("cache not yet open. Did you forget to call Open()?")
+	}
+
+	return readAggregate(b.aggregateDir(), key)
+}
+
+// Replaces any aggregate saved under the same key.
+func (b *GobBackend) SetAggregate(key string, a cache.Aggregate) error {
+	if !b.wasOpened {
+		panic("cache not yet open. Did you forget to call Open()?")
+	}
+
+	if b.readOnly {
+		logger().Debug("cache is read-only; not saving aggregate", "tip", a.Tip)
+		return nil
+	}
+
+	return writeAggregate(b.aggregateDir(), key, a)
+}
+
+// Checks every frame in the file, and that no commit is stored twice. If repair
+// is true, the file is rewritten without the frames that are corrupt or the
+// duplicate commits.
+//
+// A read-only cache only repairs its private copy.
+func (b *GobBackend) Verify(repair bool) (_ cache.VerifyReport, err error) {
+	if !b.wasOpened {
+		panic("cache not yet open. Did you forget to call Open()?")
+	}
+
+	report := cache.VerifyReport{Problems: []string{}}
+
+	// If Open() failed, open the cache again just for the check, so that a
+	// repair is made to the file on disk
+	if !b.isOpen {
+		err = b.Open()
+		if err != nil {
+			return report, err
+		}
+		defer func() {
+			closeErr := b.Close()
+			if err == nil {
+				err = closeErr
+			}
+		}()
+	}
+
+	f, err := os.Open(b.workPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return report, nil
+	} else if err != nil {
+		return report, err
+	}
+	defer f.Close() // Don't care about error closing when reading
+
+	// The intact frames are written to a new file as we go, which replaces
+	// the old one if anything was dropped
+	out := io.Discard
+	var fout *os.File
+	if repair {
+		fout, err = os.CreateTemp(
+			filepath.Dir(b.workPath),
+			filepath.Base(b.workPath)+".*.tmp",
+		)
+		if err != nil {
+			return report, err
+		}
+		defer func() {
+			fout.Close()
+			os.Remove(fout.Name()) // Already gone if renamed
+		}()
+
+		out = fout
+	}
+
+	w := bufio.NewWriter(out)
+
+	discard := func(problem string) {
+		report.Discarded += 1
+		report.Problems = append(report.Problems, problem)
+	}
+
+	seen := map[string]bool{}
+	for frame, err := range readFrames(bufio.NewReader(f)) {
+		if errors.Is(err, errCorruptFrame) || errors.Is(err, errTruncatedFrame) {
+			discard(fmt.Sprintf("%v (offset %d)", err, frame.offset))
+			continue
+		} else if err != nil {
+			return report, err
+		}
+
+		var commits []git.Commit
+		err = gob.NewDecoder(bytes.NewReader(frame.data)).Decode(&commits)
+		if err != nil {
+			discard(fmt.Sprintf(
+				"cache frame could not be decoded (offset %d): %v",
+				frame.offset,
+				err,
+			))
+			continue
+		}
+
+		kept := []git.Commit{}
+		for _, c := range commits {
+			if seen[c.Hash] {
+				discard(fmt.Sprintf("duplicate commit in cache: %s", c.Hash))
+				continue
+			}
+
+			seen[c.Hash] = true
+			kept = append(kept, c)
+		}
+		report.Commits += len(kept)
+
+		data := frame.data
+		if len(kept) == 0 {
+			continue
+		} else if len(kept) < len(commits) {
+			var buf bytes.Buffer
+			err = gob.NewEncoder(&buf).Encode(&kept)
+			if err != nil {
+				return report, err
+			}
+
+			data = buf.Bytes()
+		}
+
+		framed, err := appendFrame(nil, data)
+		if err != nil {
+			return report, err
+		}
+
+		_, err = w.Write(framed)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	if !repair {
+		return report, nil
+	}
+
+	if report.Discarded == 0 {
+		// Every frame was intact, but the gzipped file may still be damaged
+		if b.needsRepair && !b.readOnly {
+			b.isDirty = true
+		}
+
+		b.needsRepair = false
+		return report, nil
+	}
+
+	err = w.Flush()
 	if err != nil {
-		return err
+		return report, err
 	}
 
-	return nil
+	err = fout.Close()
+	if err != nil {
+		return report, err
+	}
+
+	err = os.Rename(fout.Name(), b.workPath)
+	if err != nil {
+		return report, err
+	}
+
+	logger().Debug("repaired cache", "discarded", report.Discarded)
+
+	b.needsRepair = false
+	if !b.readOnly {
+		b.isDirty = true
+	}
+
+	return report, nil
 }
 
-func GobCacheDir(prefix string, gitRootPath string) string {
-	// Filename includes hash of path to repo so we don't collide with other
-	// git-author caches for other repos.
-	h := fnv.New32()
-	h.Write([]byte(gitRootPath))
+// Reads each frame, holding a Gob-encoded array of commits, in turn.
+//
+// Frames that are corrupt are skipped, and the file is marked as needing to be
+// repaired.
+func (b *GobBackend) readGobs(r io.Reader) iter.Seq2[[]git.Commit, error] {
+	return func(yield func([]git.Commit, error) bool) {
+		for frame, err := range readFrames(r) {
+			if errors.Is(err, errCorruptFrame) || errors.Is(err, errTruncatedFrame) {
+				logger().Warn(
+					fmt.Sprintf("skipping damaged part of cache: %v", err),
+				)
+				b.needsRepair = true
+				continue
+			} else if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			var commits []git.Commit
 
-	base := filepath.Base(gitRootPath)
-	dirname := fmt.Sprintf("%s-%x", base, h.Sum32())
-	repoDir := filepath.Join(prefix, dirname)
-	return repoDir
+			dec := gob.NewDecoder(bytes.NewReader(frame.data))
+			err = dec.Decode(&commits)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			if !yield(commits, nil) {
+				return
+			}
+		}
+	}
 }
 
 func GobCacheFilename(gitRootPath string) (string, error) {
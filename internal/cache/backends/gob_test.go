@@ -1,210 +1,301 @@
 package backends_test
 
 import (
-	"iter"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
-	"time"
 
 	"github.com/google/go-cmp/cmp"
 
+	"github.com/trinhminhtriet/git-author/internal/cache"
 	"github.com/trinhminhtriet/git-author/internal/cache/backends"
 	"github.com/trinhminhtriet/git-author/internal/git"
 	"github.com/trinhminhtriet/git-author/internal/utils/iterutils"
 )
 
-func CacheDir(t *testing.T) string {
-	dirname := filepath.Join(t.TempDir(), "gob", "test-1234")
-	err := os.MkdirAll(dirname, 0o700)
-	if err != nil {
-		t.Fatalf("could not create cache dir: %v", err)
+func newGobBackend(dir string) cache.Backend {
+	return &backends.GobBackend{
+		Dir:  dir,
+		Path: filepath.Join(dir, "commits.gob"),
 	}
+}
 
-	return dirname
+func TestGobBackend(t *testing.T) {
+	testBackend(t, newGobBackend)
+	testAggregateBackend(t, newGobBackend)
 }
 
-func TestGobAddGetClear(t *testing.T) {
+func TestGobDamagedFrames(t *testing.T) {
 	dir := CacheDir(t)
-	c := backends.GobBackend{
-		Dir:  dir,
-		Path: filepath.Join(dir, "commits.gob"),
-	}
+	path := filepath.Join(dir, "commits.gob")
 
-	err := c.Open()
-	if err != nil {
-		t.Fatalf("could not open cache: %v", err)
+	commitOne := git.Commit{
+		ShortHash: "1e9ea7662b1",
+		Hash:      "1e9ea7662b1001d860471a4cece5e2f1de8062fb",
+	}
+	commitTwo := git.Commit{
+		ShortHash: "2e9ea7662b1",
+		Hash:      "2e9ea7662b1001d860471a4cece5e2f1de8062fb",
 	}
-	defer func() {
-		err = c.Close()
+	commitThree := git.Commit{
+		ShortHash: "3e9ea7662b1",
+		Hash:      "3e9ea7662b1001d860471a4cece5e2f1de8062fb",
+	}
+	revs := []string{commitOne.Hash, commitTwo.Hash, commitThree.Hash}
+
+	get := func(c *backends.GobBackend) []git.Commit {
+		result, err := c.Get(revs)
 		if err != nil {
-			t.Fatalf("could not close cache: %v", err)
+			t.Fatalf("get commits from cache failed with error: %v", err)
 		}
-	}()
 
-	commit := git.Commit{
-		ShortHash:   "9e9ea7662b1",
-		Hash:        "9e9ea7662b1001d860471a4cece5e2f1de8062fb",
-		AuthorName:  "John",
-		AuthorEmail: "john@doe.local",
-		Date: time.Date(
-			2025, 1, 31, 16, 35, 26, 0, time.UTC,
-		),
-		FileDiffs: []git.FileDiff{
-			{
-				Path:         "foo/bar.txt",
-				LinesAdded:   3,
-				LinesRemoved: 5,
-			},
-		},
-	}
+		commits, err := iterutils.Collect(result.Commits)
+		if err != nil {
+			t.Fatalf("error collecting commits: %v", err)
+		}
 
-	// -- Add --
-	err = c.Add([]git.Commit{commit})
-	if err != nil {
-		t.Fatalf("add commits to cache failed with error: %v", err)
+		return commits
 	}
 
-	// -- Get --
-	revs := []string{commit.Hash}
-	result, err := c.Get(revs)
-	if err != nil {
-		t.Fatalf("get commits from cache failed with error: %v", err)
+	c := backends.GobBackend{Dir: dir, Path: path}
+	if err := c.Open(); err != nil {
+		t.Fatalf("could not open cache: %v", err)
 	}
 
-	next, stop := iter.Pull2(result.Commits)
-	defer stop()
+	for _, commit := range []git.Commit{commitOne, commitTwo, commitThree} {
+		if err := c.Add([]git.Commit{commit}); err != nil {
+			t.Fatalf("add commits to cache failed with error: %v", err)
+		}
+	}
 
-	cachedCommit, err, ok := next()
+	// Damage the second frame, and cut the third one short, as if the process
+	// writing it had been killed
+	data, err := os.ReadFile(path)
 	if err != nil {
-		t.Fatalf("error iterating cached commits: %v", err)
+		t.Fatalf("could not read cache file: %v", err)
 	}
 
-	if !ok {
-		t.Fatal("not enough commits in result")
+	frameLen := len(data) / 3
+	data[frameLen+8] ^= 0xff // Past the length and checksum
+	data = data[:len(data)-5]
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("could not write cache file: %v", err)
 	}
 
-	if diff := cmp.Diff(commit, cachedCommit); diff != "" {
-		t.Errorf("commit is wrong:\n%s", diff)
+	if diff := cmp.Diff([]git.Commit{commitOne}, get(&c)); diff != "" {
+		t.Errorf("damaged cache is wrong:\n%s", diff)
 	}
 
-	// -- Clear --
-	err = c.Clear()
+	report, err := c.Verify(false)
 	if err != nil {
-		t.Fatalf("clearing cache failed with error: %v", err)
+		t.Fatalf("verifying cache failed with error: %v", err)
+	}
+	if report.Commits != 1 || report.Discarded != 2 {
+		t.Errorf(
+			"expected 1 intact commit and 2 damaged frames, got %d and %d",
+			report.Commits,
+			report.Discarded,
+		)
+	}
+
+	// Closing the cache repairs it
+	if err := c.Close(); err != nil {
+		t.Fatalf("could not close cache: %v", err)
+	}
+
+	c = backends.GobBackend{Dir: dir, Path: path}
+	if err := c.Open(); err != nil {
+		t.Fatalf("could not open cache: %v", err)
 	}
+	defer c.Close()
 
-	result, err = c.Get(revs)
+	report, err = c.Verify(false)
 	if err != nil {
-		t.Fatalf(
-			"get commits from cache after clear failed with error: %v",
-			err,
+		t.Fatalf("verifying cache failed with error: %v", err)
+	}
+	if report.Commits != 1 || report.Discarded != 0 {
+		t.Errorf(
+			"expected 1 intact commit and nothing damaged, got %d and %d",
+			report.Commits,
+			report.Discarded,
 		)
 	}
 
-	commits, err := iterutils.Collect(result.Commits)
-	if err != nil {
-		t.Fatalf("error collecting commits: %v", err)
+	if err := c.Add([]git.Commit{commitTwo}); err != nil {
+		t.Fatalf("add commits to cache failed with error: %v", err)
 	}
 
-	if len(commits) > 0 {
-		t.Errorf("cache result after clear should have been empty")
+	expected := []git.Commit{commitOne, commitTwo}
+	if diff := cmp.Diff(expected, get(&c)); diff != "" {
+		t.Errorf("repaired cache is wrong:\n%s", diff)
 	}
 }
 
-func TestGobAddGetAddGet(t *testing.T) {
+func TestGobTruncatedGzip(t *testing.T) {
 	dir := CacheDir(t)
-	c := backends.GobBackend{
-		Dir:  dir,
-		Path: filepath.Join(dir, "commits.gob"),
-	}
+	path := filepath.Join(dir, "commits.gob")
 
-	err := c.Open()
-	if err != nil {
-		t.Fatalf("could not open cache: %v", err)
+	commits := []git.Commit{}
+	revs := []string{}
+	for i := range 200 {
+		hash := fmt.Sprintf("%040x", i+1)
+		commits = append(commits, git.Commit{
+			ShortHash: hash[:11],
+			Hash:      hash,
+			FileDiffs: []git.FileDiff{
+				{Path: fmt.Sprintf("dir%d/file%d.txt", i, i*7919), LinesAdded: i},
+			},
+		})
+		revs = append(revs, hash)
 	}
-	defer func() {
-		err = c.Close()
+
+	get := func(c *backends.GobBackend) []git.Commit {
+		result, err := c.Get(revs)
 		if err != nil {
-			t.Fatalf("could not close cache: %v", err)
+			t.Fatalf("get commits from cache failed with error: %v", err)
 		}
-	}()
 
-	commitOne := git.Commit{
-		ShortHash:   "1e9ea7662b1",
-		Hash:        "1e9ea7662b1001d860471a4cece5e2f1de8062fb",
-		AuthorName:  "John",
-		AuthorEmail: "john@doe.local",
-		Date: time.Date(
-			2025, 1, 30, 16, 35, 26, 0, time.UTC,
-		),
-		FileDiffs: []git.FileDiff{
-			{
-				Path:         "foo/bar.txt",
-				LinesAdded:   3,
-				LinesRemoved: 5,
-			},
-		},
+		commits, err := iterutils.Collect(result.Commits)
+		if err != nil {
+			t.Fatalf("error collecting commits: %v", err)
+		}
+
+		return commits
 	}
-	commitTwo := git.Commit{
-		ShortHash:   "2e9ea7662b1",
-		Hash:        "2e9ea7662b1001d860471a4cece5e2f1de8062fb",
-		AuthorName:  "John",
-		AuthorEmail: "john@doe.local",
-		Date: time.Date(
-			2025, 1, 31, 16, 35, 26, 0, time.UTC,
-		),
-		FileDiffs: []git.FileDiff{
-			{
-				Path:         "foo/bim.txt",
-				LinesAdded:   4,
-				LinesRemoved: 0,
-			},
-		},
+
+	c := backends.GobBackend{Dir: dir, Path: path}
+	if err := c.Open(); err != nil {
+		t.Fatalf("could not open cache: %v", err)
+	}
+	for _, commit := range commits[:len(commits)-1] {
+		if err := c.Add([]git.Commit{commit}); err != nil {
+			t.Fatalf("add commits to cache failed with error: %v", err)
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("could not close cache: %v", err)
 	}
-	revs := []string{commitOne.Hash, commitTwo.Hash}
 
-	err = c.Add([]git.Commit{commitOne})
+	// Cut the gzipped file in half
+	gzPath := path + ".gz"
+	data, err := os.ReadFile(gzPath)
 	if err != nil {
+		t.Fatalf("could not read cache file: %v", err)
+	}
+	if err := os.WriteFile(gzPath, data[:len(data)/2], 0o644); err != nil {
+		t.Fatalf("could not write cache file: %v", err)
+	}
+
+	// The commits before the cut are kept
+	c = backends.GobBackend{Dir: dir, Path: path}
+	if err := c.Open(); err != nil {
+		t.Fatalf("could not open truncated cache: %v", err)
+	}
+
+	kept := get(&c)
+	if len(kept) == 0 || len(kept) >= len(commits)-1 {
+		t.Fatalf("expected some but not all commits to be kept, got %d", len(kept))
+	}
+	if diff := cmp.Diff(commits[:len(kept)], kept); diff != "" {
+		t.Errorf("truncated cache is wrong:\n%s", diff)
+	}
+
+	last := commits[len(commits)-1]
+	if err := c.Add([]git.Commit{last}); err != nil {
 		t.Fatalf("add commits to cache failed with error: %v", err)
 	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("could not close cache: %v", err)
+	}
 
-	result, err := c.Get(revs)
-	if err != nil {
-		t.Fatalf("get commits from cache failed with error: %v", err)
+	// Closing the cache replaced the gzipped file with an intact one
+	c = backends.GobBackend{Dir: dir, Path: path}
+	if err := c.Open(); err != nil {
+		t.Fatalf("could not open cache: %v", err)
 	}
 
-	commits, err := iterutils.Collect(result.Commits)
+	report, err := c.Verify(false)
 	if err != nil {
-		t.Fatalf("error collecting commits: %v", err)
+		t.Fatalf("verifying cache failed with error: %v", err)
 	}
-
-	if len(commits) != 1 {
+	if report.Commits != len(kept)+1 || report.Discarded != 0 {
 		t.Errorf(
-			"expected to get one commit from cache, but got %d",
-			len(commits),
+			"expected %d intact commits and nothing damaged, got %d and %d",
+			len(kept)+1,
+			report.Commits,
+			report.Discarded,
 		)
 	}
 
-	err = c.Add([]git.Commit{commitTwo})
-	if err != nil {
-		t.Fatalf("add commits to cache failed with error: %v", err)
+	expected := append(slices.Clone(kept), last)
+	if diff := cmp.Diff(expected, get(&c)); diff != "" {
+		t.Errorf("repaired cache is wrong:\n%s", diff)
 	}
 
-	result, err = c.Get(revs)
-	if err != nil {
-		t.Fatalf("get commits from cache failed with error: %v", err)
+	if err := c.Close(); err != nil {
+		t.Fatalf("could not close cache: %v", err)
 	}
 
-	commits, err = iterutils.Collect(result.Commits)
-	if err != nil {
-		t.Fatalf("error collecting commits: %v", err)
+	// Not even the gzip header is left
+	if err := os.WriteFile(gzPath, data[:4], 0o644); err != nil {
+		t.Fatalf("could not write cache file: %v", err)
 	}
 
-	if len(commits) != 2 {
-		t.Errorf(
-			"expected to get two commits from cache, but got %d",
-			len(commits),
-		)
+	c = backends.GobBackend{Dir: dir, Path: path}
+	if err := c.Open(); err != nil {
+		t.Fatalf("could not open cache without header: %v", err)
+	}
+	if got := get(&c); len(got) != 0 {
+		t.Errorf("expected empty cache, got %d commits", len(got))
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("could not close cache: %v", err)
+	}
+}
+
+func TestGobFailedOpen(t *testing.T) {
+	dir := CacheDir(t)
+	path := filepath.Join(dir, "commits.gob")
+
+	commit := git.Commit{
+		ShortHash: "1e9ea7662b1",
+		Hash:      "1e9ea7662b1001d860471a4cece5e2f1de8062fb",
+	}
+
+	// A directory where the gzipped file should be can't be read
+	if err := os.MkdirAll(path+".gz", 0o700); err != nil {
+		t.Fatalf("could not create directory: %v", err)
+	}
+
+	c := backends.GobBackend{Dir: dir, Path: path}
+	if err := c.Open(); err == nil {
+		t.Fatalf("expected opening cache to fail")
+	}
+
+	// Commits added to a cache that failed to open are dropped
+	if err := c.Add([]git.Commit{commit}); err != nil {
+		t.Errorf("add commits to unopened cache failed with error: %v", err)
+	}
+
+	// Verifying opens the cache again, and fails for the same reason
+	_, err := c.Verify(true)
+	if err == nil || strings.Contains(err.Error(), "failed to open") {
+		t.Errorf("expected verify to report why the cache can't open, got %v", err)
+	}
+
+	if err := c.Clear(); err != nil {
+		t.Fatalf("could not clear cache: %v", err)
+	}
+
+	c = backends.GobBackend{Dir: dir, Path: path}
+	if err := c.Open(); err != nil {
+		t.Fatalf("could not open cleared cache: %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("could not close cache: %v", err)
 	}
 }
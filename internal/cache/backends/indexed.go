@@ -0,0 +1,1087 @@
+package backends
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/trinhminhtriet/git-author/internal/cache"
+	"github.com/trinhminhtriet/git-author/internal/git"
+)
+
+// Stores commits on disk in a data file, with an index from commit hash to the
+// position of the commit in the data file.
+//
+// Each commit is Gob-encoded on its own and appended to the data file in a
+// checksummed frame, like those the Gob backend writes. The index
+// file is a header followed by fixed-size entries sorted by hash, so we can
+// binary search it for the commits we want and read only those from the data
+// file. Unlike the Gob backend, the work done by Get() is proportional to the
+// number of revs asked for rather than to the number of commits cached.
+//
+// The index is only rewritten when the cache is closed. Commits added while it
+// is open are appended to the data file and indexed in memory until then.
+// Commits that are already cached are never added twice. Compact() copies the
+// commits worth keeping into a new data file, dropping the rest along with
+// anything written by a process that didn't close the cache.
+//
+// Commits that fail their checksum are treated as if they weren't cached, and
+// are dropped when the cache is closed. If the index itself is damaged, it is
+// rebuilt from the data file.
+//
+// Locking works as it does for the Gob backend. A read-only cache reads the
+// files in place rather than from a private copy. This is safe because the
+// writer never changes the part of the data file the index refers to: the data
+// file is only ever appended to, the index is replaced with a rename, and a
+// compacted data file is written under a new name (its "generation").
+type IndexedBackend struct {
+	Dir       string
+	Path      string // Prefix for the paths of the index and data files
+	Wait      bool   // Wait for the lock instead of opening read-only
+	wasOpened bool
+	isOpen    bool
+	readOnly  bool
+	lock      *os.File // Held from Open() to Close() unless read-only
+	index     *os.File // Nil if no index has been written yet
+	data      *os.File // Nil if no commits have been written yet
+	header    indexHeader
+	pending   map[indexKey]indexEntry // Added since the index was written
+	end       int64                   // Where the next commit will be written
+
+	// Set when we read a commit that was corrupt, so that it is dropped when
+	// the cache is closed
+	needsRepair bool
+}
+
+const IndexedBackendName string = "indexed"
+
+// Bump the version at the end when the layout of the index changes
+var indexMagic = [8]byte([]byte("GAIDX001"))
+
+type indexHeader struct {
+	Magic      [8]byte
+	Generation uint32 // Generation of the data file the index refers to
+	Count      uint32 // Number of entries
+	DataEnd    int64  // Length of the data file when the index was written
+}
+
+// Size of an encoded indexHeader in bytes
+const indexHeaderSize = 24
+
+// Commit hash decoded from hex, padded with zeroes to fit SHA-256 hashes
+type indexKey [32]byte
+
+type indexEntry struct {
+	Key    indexKey
+	Offset int64  // Position of the Gob-encoded commit, just after its frame prefix
+	Length uint32 // Length of the Gob-encoded commit in bytes
+}
+
+// Size of an encoded indexEntry in bytes
+const indexEntrySize = 44
+
+func keyOf(hash string) (indexKey, bool) {
+	var key indexKey
+
+	if hex.DecodedLen(len(hash)) > len(key) {
+		return key, false
+	}
+
+	_, err := hex.Decode(key[:], []byte(hash))
+	return key, err == nil
+}
+
+func compareEntries(a indexEntry, b indexEntry) int {
+	return bytes.Compare(a.Key[:], b.Key[:])
+}
+
+func compareOffsets(a indexEntry, b indexEntry) int {
+	return cmp.Compare(a.Offset, b.Offset)
+}
+
+func encodeEntry(buf []byte, e indexEntry) {
+	copy(buf, e.Key[:])
+	binary.LittleEndian.PutUint64(buf[32:], uint64(e.Offset))
+	binary.LittleEndian.PutUint32(buf[40:], e.Length)
+}
+
+func decodeEntry(buf []byte) indexEntry {
+	var e indexEntry
+	copy(e.Key[:], buf)
+	e.Offset = int64(binary.LittleEndian.Uint64(buf[32:]))
+	e.Length = binary.LittleEndian.Uint32(buf[40:])
+	return e
+}
+
+func (b *IndexedBackend) Name() string {
+	return IndexedBackendName
+}
+
+func (b *IndexedBackend) indexPath() string {
+	return b.Path + ".index"
+}
+
+func (b *IndexedBackend) dataPath(generation uint32) string {
+	return fmt.Sprintf("%s.%d.data", b.Path, generation)
+}
+
+func (b *IndexedBackend) lockPath() string {
+	return filepath.Join(b.Dir, lockFilename)
+}
+
+// Aggregates are saved alongside the commits they were tallied from, so they
+// are discarded with them when the repo state changes.
+func (b *IndexedBackend) aggregateDir() string {
+	return b.Path + ".aggregates"
+}
+
+// True if the cache was opened read-only because another process is writing to
+// it.
+func (b *IndexedBackend) ReadOnly() bool {
+	return b.readOnly
+}
+
+func (b *IndexedBackend) Open() (err error) {
+	b.wasOpened = true
+	b.pending = map[indexKey]indexEntry{}
+
+	err = os.MkdirAll(b.Dir, 0o700)
+	if err != nil {
+		return err
+	}
+
+	b.lock, err = acquireLock(b.lockPath(), b.Wait)
+	if err != nil {
+		return err
+	}
+
+	if b.lock == nil {
+		logger().Debug(
+			"cache is locked by another process; opening read-only",
+			"dir",
+			b.Dir,
+		)
+
+		b.readOnly = true
+	}
+
+	defer func() {
+		if err != nil {
+			b.needsRepair = false // Nothing was read that could be repaired
+			b.release()
+		} else {
+			b.isOpen = true
+		}
+	}()
+
+	// The writer may compact the cache between us opening the index and
+	// opening the data file it refers to, in which case we try again with the
+	// new index.
+	for attempt := 1; ; attempt++ {
+		err = b.load()
+		if b.readOnly && attempt < 3 && errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		if !b.readOnly && errors.Is(err, errCorruptIndex) {
+			logger().Warn(fmt.Sprintf("%v; rebuilding it", err))
+
+			err = b.rebuildIndex()
+			if err != nil {
+				return err
+			}
+
+			return b.load()
+		}
+
+		return err
+	}
+}
+
+// Opens the index and the data file it refers to, if an index was written.
+func (b *IndexedBackend) load() (err error) {
+	b.closeFiles()
+	b.header = indexHeader{Magic: indexMagic}
+	b.end = 0
+
+	index, err := os.Open(b.indexPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			index.Close()
+		}
+	}()
+
+	header, err := readIndexHeader(index)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCorruptIndex, err)
+	}
+
+	flag := os.O_RDWR
+	if b.readOnly {
+		flag = os.O_RDONLY
+	}
+
+	data, err := os.OpenFile(b.dataPath(header.Generation), flag, 0)
+	if err != nil {
+		return err
+	}
+
+	if !b.readOnly {
+		info, err := data.Stat()
+		if err != nil {
+			data.Close()
+			return err
+		}
+
+		if info.Size() < header.DataEnd {
+			logger().Warn("cache data file is truncated; repairing it on close")
+			b.needsRepair = true
+		}
+
+		// Drop commits appended by a process that didn't close the cache
+		err = data.Truncate(header.DataEnd)
+		if err != nil {
+			data.Close()
+			return err
+		}
+	}
+
+	b.index = index
+	b.data = data
+	b.header = header
+	b.end = header.DataEnd
+	return nil
+}
+
+var errCorruptIndex = errors.New("cache index is damaged")
+
+func readIndexHeader(f *os.File) (indexHeader, error) {
+	var header indexHeader
+
+	err := binary.Read(f, binary.LittleEndian, &header)
+	if err != nil {
+		return header, err
+	}
+
+	if header.Magic != indexMagic {
+		return header, errors.New("index has unrecognized format")
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return header, err
+	}
+
+	if info.Size() != indexHeaderSize+int64(header.Count)*indexEntrySize {
+		return header, fmt.Errorf(
+			"index should have %d entries but is %d bytes long",
+			header.Count,
+			info.Size(),
+		)
+	}
+
+	return header, nil
+}
+
+func (b *IndexedBackend) Close() (err error) {
+	defer b.release()
+
+	if b.readOnly || b.lock == nil {
+		return nil // Read-only, or Open() failed
+	}
+
+	if b.needsRepair {
+		_, err = b.Verify(true)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(b.pending) > 0 {
+		entries, err := b.entries()
+		if err != nil {
+			return err
+		}
+
+		err = b.writeIndex(b.data, b.header.Generation, entries, b.end)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Remove any other dangling cache files
+	removeStale(
+		b.Dir,
+		b.aggregateDir(),
+		b.indexPath(),
+		b.dataPath(b.header.Generation),
+		b.lockPath(),
+	)
+
+	return nil
+}
+
+func (b *IndexedBackend) closeFiles() {
+	if b.index != nil {
+		b.index.Close() // Don't care about error closing when reading
+		b.index = nil
+	}
+
+	if b.data != nil {
+		err := b.data.Close()
+		if err != nil {
+			logger().Warn(fmt.Sprintf("failed to close cache file: %v", err))
+		}
+
+		b.data = nil
+	}
+}
+
+// Closes the files and releases the lock, if we hold it.
+func (b *IndexedBackend) release() {
+	b.isOpen = false
+	b.closeFiles()
+
+	if b.lock != nil {
+		err := releaseLock(b.lock)
+		if err != nil {
+			logger().Warn(fmt.Sprintf("failed to release cache lock: %v", err))
+		}
+
+		b.lock = nil
+	}
+}
+
+// Returns every entry in the index, including those not written yet, sorted
+// by key.
+func (b *IndexedBackend) entries() ([]indexEntry, error) {
+	entries := make([]indexEntry, 0, int(b.header.Count)+len(b.pending))
+
+	if b.header.Count > 0 {
+		buf := make([]byte, int(b.header.Count)*indexEntrySize)
+		_, err := b.index.ReadAt(buf, indexHeaderSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := 0; i < len(buf); i += indexEntrySize {
+			entries = append(entries, decodeEntry(buf[i:]))
+		}
+	}
+
+	for _, e := range b.pending {
+		entries = append(entries, e)
+	}
+
+	slices.SortFunc(entries, compareEntries)
+	return entries, nil
+}
+
+// Returns the entries for each of keys that is in the index or pending, in no
+// particular order.
+//
+// For a handful of keys, we binary search the index on disk. Once that would
+// mean reading more entries than there are in the index, we read the whole
+// index instead and search it in memory.
+func (b *IndexedBackend) lookup(keys []indexKey) (_ []indexEntry, err error) {
+	found := []indexEntry{}
+	n := int(b.header.Count)
+
+	var entryAt func(i int) (indexEntry, error)
+
+	if len(keys)*bits.Len(uint(n)) >= n {
+		buf := make([]byte, n*indexEntrySize)
+		if n > 0 {
+			_, err = b.index.ReadAt(buf, indexHeaderSize)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		entryAt = func(i int) (indexEntry, error) {
+			return decodeEntry(buf[i*indexEntrySize:]), nil
+		}
+	} else {
+		buf := make([]byte, indexEntrySize)
+		entryAt = func(i int) (indexEntry, error) {
+			off := indexHeaderSize + int64(i)*indexEntrySize
+			_, err := b.index.ReadAt(buf, off)
+			return decodeEntry(buf), err
+		}
+	}
+
+	for _, key := range keys {
+		if e, ok := b.pending[key]; ok {
+			found = append(found, e)
+			continue
+		}
+
+		// Binary search for the first entry not less than key
+		lo, hi := 0, n
+		for lo < hi {
+			mid := int(uint(lo+hi) >> 1)
+
+			e, err := entryAt(mid)
+			if err != nil {
+				return nil, err
+			}
+
+			if bytes.Compare(e.Key[:], key[:]) < 0 {
+				lo = mid + 1
+			} else {
+				hi = mid
+			}
+		}
+
+		if lo < n {
+			e, err := entryAt(lo)
+			if err != nil {
+				return nil, err
+			}
+
+			if e.Key == key {
+				found = append(found, e)
+			}
+		}
+	}
+
+	return found, nil
+}
+
+// Reads the commit for an entry from the data file. Returns errCorruptFrame or
+// errTruncatedFrame if the commit was damaged on disk.
+func readEntry(data *os.File, e indexEntry) (git.Commit, error) {
+	var commit git.Commit
+
+	buf := make([]byte, framePrefixSize+int(e.Length))
+	_, err := data.ReadAt(buf, e.Offset-framePrefixSize)
+	if err == io.EOF {
+		return commit, errTruncatedFrame
+	} else if err != nil {
+		return commit, err
+	}
+
+	err = checkFrame(buf, buf[framePrefixSize:])
+	if err != nil {
+		return commit, err
+	}
+
+	err = gob.NewDecoder(bytes.NewReader(buf[framePrefixSize:])).Decode(&commit)
+	return commit, err
+}
+
+func (b *IndexedBackend) Get(revs []string) (_ cache.Result, err error) {
+	if !b.wasOpened {
+		panic("cache not yet open. Did you forget to call Open()?")
+	}
+
+	result := cache.EmptyResult()
+	if b.data == nil {
+		return result, nil
+	}
+
+	lookingFor := map[string]bool{}
+	keys := []indexKey{}
+	for _, rev := range revs {
+		key, ok := keyOf(rev)
+		if !ok || lookingFor[rev] {
+			continue
+		}
+
+		lookingFor[rev] = true
+		keys = append(keys, key)
+	}
+
+	found, err := b.lookup(keys)
+	if err != nil {
+		return result, err
+	}
+
+	// Read commits in the order they were added, which is the order in which
+	// the other backends return them
+	slices.SortFunc(found, compareOffsets)
+
+	data := b.data
+	it := func(yield func(git.Commit, error) bool) {
+		for _, e := range found {
+			c, err := readEntry(data, e)
+			if errors.Is(err, errCorruptFrame) ||
+				errors.Is(err, errTruncatedFrame) {
+				logger().Warn(
+					fmt.Sprintf("skipping damaged part of cache: %v", err),
+				)
+				b.needsRepair = true
+				continue
+			} else if err != nil {
+				yield(c, fmt.Errorf("error reading cached commit: %w", err))
+				return
+			}
+
+			// Keys of hashes with different lengths can match
+			if !lookingFor[c.Hash] {
+				continue
+			}
+
+			if !yield(c, nil) {
+				return
+			}
+		}
+	}
+
+	return cache.Result{Commits: it}, nil
+}
+
+func (b *IndexedBackend) Add(commits []git.Commit) (err error) {
+	if !b.wasOpened {
+		panic("cache not yet open. Did you forget to call Open()?")
+	}
+
+	if b.readOnly {
+		logger().Debug(
+			"cache is read-only; not adding commits",
+			"num",
+			len(commits),
+		)
+		return nil
+	}
+
+	if !b.isOpen {
+		logger().Debug(
+			"cache failed to open; not adding commits",
+			"num",
+			len(commits),
+		)
+		return nil
+	}
+
+	keys := make([]indexKey, len(commits))
+	for i, c := range commits {
+		key, ok := keyOf(c.Hash)
+		if !ok {
+			return fmt.Errorf("cannot cache commit with hash %q", c.Hash)
+		}
+
+		keys[i] = key
+	}
+
+	found, err := b.lookup(keys)
+	if err != nil {
+		return err
+	}
+
+	cached := map[indexKey]bool{}
+	for _, e := range found {
+		cached[e.Key] = true
+	}
+
+	if b.data == nil {
+		// The directory is gone if every cache was deleted since we opened
+		// this one
+		err = os.MkdirAll(b.Dir, 0o700)
+		if err != nil {
+			return err
+		}
+
+		b.data, err = os.OpenFile(
+			b.dataPath(b.header.Generation),
+			os.O_RDWR|os.O_CREATE|os.O_TRUNC,
+			0644,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	start := b.end
+	added := map[indexKey]indexEntry{}
+
+	var data []byte
+	var record bytes.Buffer
+	for i, c := range commits {
+		if cached[keys[i]] {
+			continue
+		}
+
+		record.Reset()
+		err = gob.NewEncoder(&record).Encode(&c)
+		if err != nil {
+			return err
+		}
+
+		added[keys[i]] = indexEntry{
+			Key:    keys[i],
+			Offset: start + int64(len(data)) + framePrefixSize,
+			Length: uint32(record.Len()),
+		}
+		cached[keys[i]] = true
+
+		data, err = appendFrame(data, record.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	_, err = b.data.WriteAt(data, start)
+	if err != nil {
+		return err
+	}
+
+	for key, e := range added {
+		b.pending[key] = e
+	}
+	b.end += int64(len(data))
+
+	return nil
+}
+
+// Writes an index of entries, which must be sorted by key, into the data file
+// of the given generation. Replaces the index on disk atomically.
+func (b *IndexedBackend) writeIndex(
+	data *os.File,
+	generation uint32,
+	entries []indexEntry,
+	dataEnd int64,
+) (err error) {
+	// The data must be on disk before an index that refers to it
+	err = data.Sync()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(b.Dir, filepath.Base(b.indexPath())+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		f.Close()
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+
+	w := bufio.NewWriter(f)
+
+	header := indexHeader{
+		Magic:      indexMagic,
+		Generation: generation,
+		Count:      uint32(len(entries)),
+		DataEnd:    dataEnd,
+	}
+	err = binary.Write(w, binary.LittleEndian, header)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, indexEntrySize)
+	for _, e := range entries {
+		encodeEntry(buf, e)
+
+		_, err = w.Write(buf)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), b.indexPath())
+}
+
+// Rewrites the cache with only the commits in keep, or with every commit if
+// keep is nil. The commits are copied into a new data file, which reclaims the
+// space taken by any other commits in the old one. Returns the number of
+// commits removed.
+func (b *IndexedBackend) Compact(keep []string) (int, error) {
+	if !b.wasOpened {
+		panic("cache not yet open. Did you forget to call Open()?")
+	}
+
+	if keep == nil {
+		return b.compact(func(indexEntry) bool { return true })
+	}
+
+	keepKeys := map[indexKey]bool{}
+	for _, rev := range keep {
+		if key, ok := keyOf(rev); ok {
+			keepKeys[key] = true
+		}
+	}
+
+	return b.compact(func(e indexEntry) bool { return keepKeys[e.Key] })
+}
+
+// Rewrites the cache with only the entries for which keep returns true.
+func (b *IndexedBackend) compact(keep func(indexEntry) bool) (_ int, err error) {
+	if b.readOnly {
+		return 0, errors.New("cannot compact cache opened read-only")
+	}
+
+	entries, err := b.entries()
+	if err != nil {
+		return 0, err
+	}
+
+	kept := slices.DeleteFunc(slices.Clone(entries), func(e indexEntry) bool {
+		return !keep(e)
+	})
+
+	// Copy commits in the order they were added
+	slices.SortFunc(kept, compareOffsets)
+
+	generation := b.header.Generation + 1
+
+	data, err := os.OpenFile(
+		b.dataPath(generation),
+		os.O_RDWR|os.O_CREATE|os.O_TRUNC,
+		0644,
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			data.Close()
+			os.Remove(data.Name())
+		}
+	}()
+
+	w := bufio.NewWriter(data)
+	var end int64
+	for i, e := range kept {
+		// Copy the frame prefix along with the commit
+		r := io.NewSectionReader(
+			b.data,
+			e.Offset-framePrefixSize,
+			int64(e.Length)+framePrefixSize,
+		)
+
+		n, err := io.Copy(w, r)
+		if err != nil {
+			return 0, err
+		}
+
+		kept[i].Offset = end + framePrefixSize
+		end += n
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return 0, err
+	}
+
+	slices.SortFunc(kept, compareEntries)
+
+	err = b.writeIndex(data, generation, kept, end)
+	if err != nil {
+		return 0, err
+	}
+
+	// The new index is in place, so the old data file is no longer needed
+	oldPath := b.dataPath(b.header.Generation)
+	b.closeFiles()
+
+	err = os.Remove(oldPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logger().Warn(fmt.Sprintf("failed to delete old cache file: %v", err))
+	}
+
+	data.Close()
+	b.pending = map[indexKey]indexEntry{}
+
+	err = b.load()
+	if err != nil {
+		return 0, err
+	}
+
+	logger().Debug(
+		"compacted cache",
+		"kept",
+		len(kept),
+		"removed",
+		len(entries)-len(kept),
+	)
+
+	return len(entries) - len(kept), nil
+}
+
+// Checks that every commit in the index can be read back from the data file
+// intact. If repair is true, the cache is compacted without those that can't.
+func (b *IndexedBackend) Verify(repair bool) (_ cache.VerifyReport, err error) {
+	if !b.wasOpened {
+		panic("cache not yet open. Did you forget to call Open()?")
+	}
+
+	report := cache.VerifyReport{Problems: []string{}}
+
+	// If Open() failed, open the cache again just for the check, so that a
+	// repair is made to the files on disk
+	if !b.isOpen {
+		err = b.Open()
+		if err != nil {
+			return report, err
+		}
+		defer func() {
+			closeErr := b.Close()
+			if err == nil {
+				err = closeErr
+			}
+		}()
+	}
+
+	if repair && b.readOnly {
+		return report, errors.New("cannot repair cache opened read-only")
+	}
+
+	entries, err := b.entries()
+	if err != nil {
+		return report, err
+	}
+
+	// Read in the order the commits were written
+	slices.SortFunc(entries, compareOffsets)
+
+	damaged := map[indexKey]bool{}
+	for _, e := range entries {
+		c, err := readEntry(b.data, e)
+		if err == nil {
+			key, _ := keyOf(c.Hash)
+			if key != e.Key {
+				err = fmt.Errorf("cache index entry points at commit %s", c.Hash)
+			}
+		}
+
+		if err != nil {
+			damaged[e.Key] = true
+			report.Discarded += 1
+			report.Problems = append(
+				report.Problems,
+				fmt.Sprintf("%v (offset %d)", err, e.Offset),
+			)
+			continue
+		}
+
+		report.Commits += 1
+	}
+
+	if !repair || (report.Discarded == 0 && !b.needsRepair) {
+		return report, nil
+	}
+
+	_, err = b.compact(func(e indexEntry) bool { return !damaged[e.Key] })
+	if err != nil {
+		return report, err
+	}
+
+	b.needsRepair = false
+	return report, nil
+}
+
+// Writes a new index for the latest data file, from the commits that can be
+// read back from it intact. Used when the index itself is damaged.
+func (b *IndexedBackend) rebuildIndex() (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to rebuild cache index: %w", err)
+		}
+	}()
+
+	matches, err := filepath.Glob(b.Path + ".*.data")
+	if err != nil {
+		panic(err) // Bad pattern
+	}
+
+	var generation uint32
+	var found bool
+	for _, match := range matches {
+		var gen uint32
+		_, err := fmt.Sscanf(
+			strings.TrimPrefix(match, b.Path),
+			".%d.data",
+			&gen,
+		)
+		if err == nil && (!found || gen > generation) {
+			generation = gen
+			found = true
+		}
+	}
+
+	if !found {
+		return os.Remove(b.indexPath())
+	}
+
+	data, err := os.OpenFile(b.dataPath(generation), os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+
+	entries := []indexEntry{}
+	seen := map[indexKey]bool{}
+	var end int64
+
+	for frame, err := range readFrames(bufio.NewReader(data)) {
+		if errors.Is(err, errTruncatedFrame) {
+			break
+		}
+
+		end = frame.offset + framePrefixSize + int64(len(frame.data))
+		if errors.Is(err, errCorruptFrame) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		var c git.Commit
+		err = gob.NewDecoder(bytes.NewReader(frame.data)).Decode(&c)
+		if err != nil {
+			continue
+		}
+
+		key, ok := keyOf(c.Hash)
+		if !ok || seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		entries = append(entries, indexEntry{
+			Key:    key,
+			Offset: frame.offset + framePrefixSize,
+			Length: uint32(len(frame.data)),
+		})
+	}
+
+	logger().Debug("rebuilt cache index", "commits", len(entries))
+
+	slices.SortFunc(entries, compareEntries)
+	return b.writeIndex(data, generation, entries, end)
+}
+
+// Deletes everything in Dir but the lock file, waiting for the lock if the
+// cache isn't open. A read-only cache only forgets what it has read.
+func (b *IndexedBackend) Clear() (err error) {
+	if b.readOnly {
+		b.closeFiles()
+		b.header = indexHeader{Magic: indexMagic}
+		b.pending = map[indexKey]indexEntry{}
+		b.end = 0
+		return nil
+	}
+
+	if b.lock == nil {
+		_, err := os.Stat(b.Dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		lock, err := acquireLock(b.lockPath(), true)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			unlockErr := releaseLock(lock)
+			if err == nil {
+				err = unlockErr
+			}
+		}()
+
+		return removeAllButLock(b.Dir)
+	}
+
+	// Start a new generation, so read-only caches in other processes that
+	// still have the old data file open never see it reused
+	generation := b.header.Generation + 1
+
+	b.closeFiles()
+	b.header = indexHeader{Magic: indexMagic, Generation: generation}
+	b.pending = map[indexKey]indexEntry{}
+	b.end = 0
+
+	return removeAllButLock(b.Dir)
+}
+
+// Must be called while the cache is open.
+func (b *IndexedBackend) Stats() (_ cache.Stats, err error) {
+	if !b.wasOpened {
+		panic("cache not yet open. Did you forget to call Open()?")
+	}
+
+	stats := cache.Stats{
+		Path:       b.indexPath(),
+		Commits:    int(b.header.Count) + len(b.pending),
+		Aggregates: countAggregates(b.aggregateDir()),
+	}
+
+	for _, f := range []*os.File{b.index, b.data} {
+		if f == nil {
+			continue
+		}
+
+		info, err := f.Stat()
+		if err != nil {
+			return stats, err
+		}
+
+		stats.Size += info.Size()
+	}
+
+	return stats, nil
+}
+
+func (b *IndexedBackend) GetAggregate(key string) (cache.Aggregate, bool, error) {
+	if !b.wasOpened {
+		panic("cache not yet open. Did you forget to call Open()?")
+	}
+
+	return readAggregate(b.aggregateDir(), key)
+}
+
+// Replaces any aggregate saved under the same key.
+func (b *IndexedBackend) SetAggregate(key string, a cache.Aggregate) error {
+	if !b.wasOpened {
+		panic("cache not yet open. Did you forget to call Open()?")
+	}
+
+	if b.readOnly {
+		logger().Debug("cache is read-only; not saving aggregate", "tip", a.Tip)
+		return nil
+	}
+
+	return writeAggregate(b.aggregateDir(), key, a)
+}
+
+// Returns the path prefix for the index and data files, relative to the
+// directory for the repo.
+func IndexedCacheFilename(gitRootPath string) (string, error) {
+	return cache.RepoStateHash(gitRootPath)
+}
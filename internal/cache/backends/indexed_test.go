@@ -0,0 +1,233 @@
+package backends_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/trinhminhtriet/git-author/internal/cache"
+	"github.com/trinhminhtriet/git-author/internal/cache/backends"
+	"github.com/trinhminhtriet/git-author/internal/git"
+	"github.com/trinhminhtriet/git-author/internal/utils/iterutils"
+)
+
+func newIndexedBackend(dir string) cache.Backend {
+	return &backends.IndexedBackend{
+		Dir:  dir,
+		Path: filepath.Join(dir, "commits"),
+	}
+}
+
+func TestIndexedBackend(t *testing.T) {
+	testBackend(t, newIndexedBackend)
+	testAggregateBackend(t, newIndexedBackend)
+}
+
+func TestIndexedReopenCompact(t *testing.T) {
+	dir := CacheDir(t)
+	path := filepath.Join(dir, "commits")
+
+	commits := []git.Commit{}
+	for i := range 100 {
+		commits = append(commits, git.Commit{
+			ShortHash:  fmt.Sprintf("%011x", i),
+			Hash:       fmt.Sprintf("%040x", i),
+			AuthorName: "John",
+		})
+	}
+
+	get := func(c *backends.IndexedBackend, revs []string) []git.Commit {
+		result, err := c.Get(revs)
+		if err != nil {
+			t.Fatalf("get commits from cache failed with error: %v", err)
+		}
+
+		commits, err := iterutils.Collect(result.Commits)
+		if err != nil {
+			t.Fatalf("error collecting commits: %v", err)
+		}
+
+		return commits
+	}
+
+	c := backends.IndexedBackend{Dir: dir, Path: path}
+	if err := c.Open(); err != nil {
+		t.Fatalf("could not open cache: %v", err)
+	}
+	if err := c.Add(commits[:60]); err != nil {
+		t.Fatalf("add commits to cache failed with error: %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("could not close cache: %v", err)
+	}
+
+	c = backends.IndexedBackend{Dir: dir, Path: path}
+	if err := c.Open(); err != nil {
+		t.Fatalf("could not open cache: %v", err)
+	}
+	defer c.Close()
+
+	// Commits already cached should not be added again
+	if err := c.Add(commits[50:]); err != nil {
+		t.Fatalf("add commits to cache failed with error: %v", err)
+	}
+
+	stats, err := c.Stats()
+	if err != nil {
+		t.Fatalf("reading cache stats failed with error: %v", err)
+	}
+	if stats.Commits != 100 {
+		t.Errorf("expected 100 commits in cache, but got %d", stats.Commits)
+	}
+
+	// Few enough revs that the index is searched on disk
+	revs := []string{commits[7].Hash, commits[42].Hash, commits[99].Hash}
+	expected := []git.Commit{commits[7], commits[42], commits[99]}
+	if diff := cmp.Diff(expected, get(&c, revs)); diff != "" {
+		t.Errorf("cached commits are wrong:\n%s", diff)
+	}
+
+	keep := []string{}
+	for _, commit := range commits[:10] {
+		keep = append(keep, commit.Hash)
+	}
+
+	removed, err := c.Compact(keep)
+	if err != nil {
+		t.Fatalf("compacting cache failed with error: %v", err)
+	}
+	if removed != 90 {
+		t.Errorf("expected compact to remove 90 commits, but removed %d", removed)
+	}
+
+	allRevs := []string{}
+	for _, commit := range commits {
+		allRevs = append(allRevs, commit.Hash)
+	}
+
+	if diff := cmp.Diff(commits[:10], get(&c, allRevs)); diff != "" {
+		t.Errorf("compacted cache is wrong:\n%s", diff)
+	}
+
+	compacted, err := c.Stats()
+	if err != nil {
+		t.Fatalf("reading cache stats failed with error: %v", err)
+	}
+	if compacted.Size >= stats.Size {
+		t.Errorf(
+			"expected compacted cache to be smaller than %d bytes, but is %d",
+			stats.Size,
+			compacted.Size,
+		)
+	}
+}
+
+func TestIndexedDamaged(t *testing.T) {
+	dir := CacheDir(t)
+	path := filepath.Join(dir, "commits")
+
+	commits := []git.Commit{}
+	revs := []string{}
+	for i := range 3 {
+		commit := git.Commit{
+			ShortHash: fmt.Sprintf("%011x", i),
+			Hash:      fmt.Sprintf("%040x", i),
+		}
+		commits = append(commits, commit)
+		revs = append(revs, commit.Hash)
+	}
+
+	get := func(c *backends.IndexedBackend) []git.Commit {
+		result, err := c.Get(revs)
+		if err != nil {
+			t.Fatalf("get commits from cache failed with error: %v", err)
+		}
+
+		commits, err := iterutils.Collect(result.Commits)
+		if err != nil {
+			t.Fatalf("error collecting commits: %v", err)
+		}
+
+		return commits
+	}
+
+	open := func() *backends.IndexedBackend {
+		c := &backends.IndexedBackend{Dir: dir, Path: path}
+		if err := c.Open(); err != nil {
+			t.Fatalf("could not open cache: %v", err)
+		}
+
+		return c
+	}
+
+	c := open()
+	if err := c.Add(commits); err != nil {
+		t.Fatalf("add commits to cache failed with error: %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("could not close cache: %v", err)
+	}
+
+	// Damage the second commit
+	dataPath := path + ".0.data"
+	data, err := os.ReadFile(dataPath)
+	if err != nil {
+		t.Fatalf("could not read cache file: %v", err)
+	}
+
+	data[len(data)/3+8] ^= 0xff // Past the length and checksum
+	if err := os.WriteFile(dataPath, data, 0o644); err != nil {
+		t.Fatalf("could not write cache file: %v", err)
+	}
+
+	c = open()
+
+	expected := []git.Commit{commits[0], commits[2]}
+	if diff := cmp.Diff(expected, get(c)); diff != "" {
+		t.Errorf("damaged cache is wrong:\n%s", diff)
+	}
+
+	report, err := c.Verify(false)
+	if err != nil {
+		t.Fatalf("verifying cache failed with error: %v", err)
+	}
+	if report.Commits != 2 || report.Discarded != 1 {
+		t.Errorf(
+			"expected 2 intact commits and 1 damaged, got %d and %d",
+			report.Commits,
+			report.Discarded,
+		)
+	}
+
+	// Closing the cache repairs it
+	if err := c.Close(); err != nil {
+		t.Fatalf("could not close cache: %v", err)
+	}
+
+	// Damage the index, which should be rebuilt from the data file
+	if err := os.WriteFile(path+".index", []byte("garbage"), 0o644); err != nil {
+		t.Fatalf("could not write cache index: %v", err)
+	}
+
+	c = open()
+	defer c.Close()
+
+	report, err = c.Verify(false)
+	if err != nil {
+		t.Fatalf("verifying cache failed with error: %v", err)
+	}
+	if report.Commits != 2 || report.Discarded != 0 {
+		t.Errorf(
+			"expected 2 intact commits and nothing damaged, got %d and %d",
+			report.Commits,
+			report.Discarded,
+		)
+	}
+
+	if diff := cmp.Diff(expected, get(c)); diff != "" {
+		t.Errorf("repaired cache is wrong:\n%s", diff)
+	}
+}
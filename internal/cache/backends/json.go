@@ -119,3 +119,46 @@ func (b JSONBackend) Add(commits []git.Commit) (err error) {
 func (b JSONBackend) Clear() error {
 	return os.Remove(b.Path)
 }
+
+func (b JSONBackend) Stats() (cache.Stats, error) {
+	stats := cache.Stats{Path: b.Path}
+
+	f, err := os.Open(b.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return stats, nil
+	} else if err != nil {
+		return stats, err
+	}
+	defer f.Close() // Don't care about error closing when reading
+
+	info, err := f.Stat()
+	if err != nil {
+		return stats, err
+	}
+	stats.Size = info.Size()
+
+	dec := json.NewDecoder(f)
+	for {
+		var c git.Commit
+
+		err = dec.Decode(&c)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return stats, err
+		}
+
+		stats.Commits += 1
+	}
+
+	return stats, nil
+}
+
+// The JSON backend doesn't store aggregates.
+func (b JSONBackend) GetAggregate(key string) (cache.Aggregate, bool, error) {
+	return cache.Aggregate{}, false, nil
+}
+
+func (b JSONBackend) SetAggregate(key string, a cache.Aggregate) error {
+	return nil
+}
@@ -0,0 +1,41 @@
+package backends
+
+import (
+	"fmt"
+	"os"
+)
+
+// Opens the lock file at path and takes an exclusive advisory lock on it.
+//
+// If wait is false and another process holds the lock, returns a nil file
+// instead of waiting.
+func acquireLock(path string, wait bool) (_ *os.File, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to lock cache: %w", err)
+		}
+	}()
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	locked, err := lockFile(f, wait)
+	if err != nil || !locked {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func releaseLock(f *os.File) error {
+	err := unlockFile(f)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to unlock cache: %w", err)
+	}
+
+	return f.Close()
+}
@@ -30,3 +30,15 @@ func (b NoopBackend) Add(commits []git.Commit) error {
 func (b NoopBackend) Clear() error {
 	return nil
 }
+
+func (b NoopBackend) Stats() (cache.Stats, error) {
+	return cache.Stats{}, nil
+}
+
+func (b NoopBackend) GetAggregate(key string) (cache.Aggregate, bool, error) {
+	return cache.Aggregate{}, false, nil
+}
+
+func (b NoopBackend) SetAggregate(key string, a cache.Aggregate) error {
+	return nil
+}
@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/trinhminhtriet/git-author/internal/git"
+)
+
+// A portable copy of the commits cached for a repository, so that a cache can
+// be moved to another machine or another checkout of the same repository.
+//
+// Unlike the cache itself, a bundle doesn't depend on where the repository is
+// checked out. It records the cache format version and repo state hash it was
+// exported with, since the commits in it can only be used where both match.
+type Bundle struct {
+	FormatVersion int
+	StateHash     string
+	Commits       []git.Commit
+}
+
+// Bump this whenever the layout of a bundle changes
+const bundleMagic = "git-author cache bundle 1"
+
+// Writes the bundle to w.
+//
+// A bundle is gzipped. It starts with a line identifying the format and a line
+// with the SHA-256 checksum of the rest, which is the Gob-encoded bundle.
+func WriteBundle(w io.Writer, b Bundle) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to write cache bundle: %w", err)
+		}
+	}()
+
+	var body bytes.Buffer
+	err = gob.NewEncoder(&body).Encode(&b)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(body.Bytes())
+
+	zw, err := gzip.NewWriterLevel(w, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(zw, "%s\n%s\n", bundleMagic, hex.EncodeToString(sum[:]))
+	if err != nil {
+		return err
+	}
+
+	_, err = zw.Write(body.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// Reads a bundle written by WriteBundle() from r, checking that it hasn't been
+// corrupted along the way.
+func ReadBundle(r io.Reader) (_ Bundle, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to read cache bundle: %w", err)
+		}
+	}()
+
+	var b Bundle
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return b, err
+	}
+	defer zr.Close()
+
+	br := bufio.NewReader(zr)
+
+	magic, err := br.ReadString('\n')
+	if err != nil || strings.TrimSuffix(magic, "\n") != bundleMagic {
+		return b, errors.New("not a git-author cache bundle")
+	}
+
+	checksum, err := br.ReadString('\n')
+	if err != nil {
+		return b, err
+	}
+
+	body, err := io.ReadAll(br)
+	if err != nil {
+		return b, err
+	}
+
+	sum := sha256.Sum256(body)
+	if strings.TrimSuffix(checksum, "\n") != hex.EncodeToString(sum[:]) {
+		return b, errors.New("checksum does not match; bundle is corrupt")
+	}
+
+	err = gob.NewDecoder(bytes.NewReader(body)).Decode(&b)
+	if err != nil {
+		return b, err
+	}
+
+	return b, nil
+}
@@ -0,0 +1,97 @@
+package cache_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/trinhminhtriet/git-author/internal/cache"
+	"github.com/trinhminhtriet/git-author/internal/git"
+)
+
+func TestBundleRoundTrip(t *testing.T) {
+	bundle := cache.Bundle{
+		FormatVersion: cache.FormatVersion,
+		StateHash:     "1234abcd",
+		Commits: []git.Commit{
+			{
+				ShortHash:   "9e9ea7662b1",
+				Hash:        "9e9ea7662b1001d860471a4cece5e2f1de8062fb",
+				AuthorName:  "John",
+				AuthorEmail: "john@doe.local",
+				Date: time.Date(
+					2025, 1, 31, 16, 35, 26, 0, time.UTC,
+				),
+				FileDiffs: []git.FileDiff{
+					{
+						Path:         "foo/bar.txt",
+						LinesAdded:   3,
+						LinesRemoved: 5,
+					},
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	err := cache.WriteBundle(&buf, bundle)
+	if err != nil {
+		t.Fatalf("writing bundle failed with error: %v", err)
+	}
+
+	read, err := cache.ReadBundle(&buf)
+	if err != nil {
+		t.Fatalf("reading bundle failed with error: %v", err)
+	}
+
+	if diff := cmp.Diff(bundle, read); diff != "" {
+		t.Errorf("bundle is wrong:\n%s", diff)
+	}
+}
+
+func TestBundleCorrupt(t *testing.T) {
+	bundle := cache.Bundle{
+		FormatVersion: cache.FormatVersion,
+		StateHash:     "1234abcd",
+		Commits: []git.Commit{
+			{Hash: "9e9ea7662b1001d860471a4cece5e2f1de8062fb"},
+		},
+	}
+
+	var buf bytes.Buffer
+	err := cache.WriteBundle(&buf, bundle)
+	if err != nil {
+		t.Fatalf("writing bundle failed with error: %v", err)
+	}
+
+	// Flip a byte in the uncompressed body, then compress it again
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("could not decompress bundle: %v", err)
+	}
+
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("could not decompress bundle: %v", err)
+	}
+	raw[len(raw)-1] ^= 0xff
+
+	var corrupt bytes.Buffer
+	zw := gzip.NewWriter(&corrupt)
+	zw.Write(raw)
+	zw.Close()
+
+	_, err = cache.ReadBundle(&corrupt)
+	if err == nil {
+		t.Errorf("expected error reading corrupt bundle")
+	}
+
+	_, err = cache.ReadBundle(bytes.NewReader([]byte("not a bundle")))
+	if err == nil {
+		t.Errorf("expected error reading something that isn't a bundle")
+	}
+}
@@ -13,6 +13,8 @@ import (
 	"os/user"
 	"path/filepath"
 	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/trinhminhtriet/git-author/internal/git"
@@ -39,6 +41,27 @@ func EmptyResult() Result {
 	}
 }
 
+// Describes what a backend has stored on disk.
+type Stats struct {
+	Path    string // Where the cache is stored, empty if not stored on disk
+	Size    int64  // Size on disk in bytes
+	Commits int    // Number of commits stored
+
+	Aggregates int // Number of saved tallies
+}
+
+// A tally over the history of a commit, saved so that a later tally over the
+// history of a descendant only has to add the commits in between.
+type Aggregate struct {
+	Tip string // Hash of the commit
+
+	// Whether each path the tally saw was excluded from line and file metrics.
+	// The tally can't be reused if any of these have changed.
+	Excluded map[string]bool
+
+	Tally []byte // Gob-encoded tally
+}
+
 type Backend interface {
 	Name() string
 	Open() error
@@ -46,6 +69,37 @@ type Backend interface {
 	Get(revs []string) (Result, error)
 	Add(commits []git.Commit) error
 	Clear() error
+	Stats() (Stats, error)
+
+	// Aggregates are looked up by a key describing how the tally was made.
+	// Backends that can't store them never find one and drop those added.
+	GetAggregate(key string) (Aggregate, bool, error)
+	SetAggregate(key string, a Aggregate) error
+}
+
+// Implemented by backends that can remove commits in place, rather than by
+// reading back the commits to keep and adding them to an empty cache.
+type Compacter interface {
+	// Removes every commit not in keep, or only reclaims space if keep is nil.
+	// Returns the number of commits removed.
+	Compact(keep []string) (int, error)
+}
+
+// Describes the problems Verify() found in a cache.
+type VerifyReport struct {
+	Commits   int      // Number of intact commits
+	Discarded int      // Number of corrupt or duplicate entries
+	Problems  []string // Description of each problem found
+}
+
+// Implemented by backends that can check their files for corrupt entries.
+type Verifier interface {
+	// Finds corrupt or duplicate entries. If repair is true, they are dropped
+	// from the cache, leaving the intact commits in place.
+	//
+	// May be called after Open() failed, in which case the files on disk are
+	// checked and repaired directly.
+	Verify(repair bool) (VerifyReport, error)
 }
 
 type Cache struct {
@@ -167,11 +221,171 @@ func (c *Cache) Clear() error {
 	return nil
 }
 
-// Returns the absolute path at which we should store data for a given cache
+func (c *Cache) GetAggregate(key string) (_ Aggregate, _ bool, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to retrieve tally from cache: %w", err)
+		}
+	}()
+
+	start := time.Now()
+
+	a, ok, err := c.backend.GetAggregate(key)
+	if err != nil {
+		return a, false, err
+	}
+
+	elapsed := time.Now().Sub(start)
+	logger().Debug(
+		"cache get aggregate",
+		"found",
+		ok,
+		"duration_ms",
+		elapsed.Milliseconds(),
+	)
+
+	return a, ok, nil
+}
+
+func (c *Cache) SetAggregate(key string, a Aggregate) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to save tally to cache: %w", err)
+		}
+	}()
+
+	start := time.Now()
+
+	err = c.backend.SetAggregate(key, a)
+	if err != nil {
+		return err
+	}
+
+	elapsed := time.Now().Sub(start)
+	logger().Debug(
+		"cache set aggregate",
+		"tip",
+		a.Tip,
+		"duration_ms",
+		elapsed.Milliseconds(),
+	)
+
+	return nil
+}
+
+func (c *Cache) Stats() (_ Stats, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to read cache stats: %w", err)
+		}
+	}()
+
+	return c.backend.Stats()
+}
+
+// Removes every cached commit not in keep. Returns the number of commits
+// removed.
+//
+// Backends that implement Compacter compact themselves. Otherwise, the commits
+// we keep are read into memory, then the cache is cleared and they are added
+// back.
+func (c *Cache) Prune(keep []string) (_ int, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to prune cache: %w", err)
+		}
+	}()
+
+	if compacter, ok := c.backend.(Compacter); ok {
+		if keep == nil {
+			keep = []string{} // Nil would keep everything
+		}
+
+		return compacter.Compact(keep)
+	}
+
+	stats, err := c.backend.Stats()
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := c.backend.Get(keep)
+	if err != nil {
+		return 0, err
+	}
+
+	kept := []git.Commit{}
+	for commit, err := range result.Commits {
+		if err != nil {
+			return 0, err
+		}
+
+		kept = append(kept, commit)
+	}
+
+	if len(kept) == stats.Commits {
+		return 0, nil // Nothing to prune
+	}
+
+	err = c.backend.Clear()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(kept) > 0 {
+		err = c.backend.Add(kept)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	logger().Debug("cache prune", "kept", len(kept), "stored", stats.Commits)
+	return stats.Commits - len(kept), nil
+}
+
+// Checks the cache for corrupt or duplicate entries, and drops them if repair
+// is true.
+func (c *Cache) Verify(repair bool) (_ VerifyReport, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to verify cache: %w", err)
+		}
+	}()
+
+	verifier, ok := c.backend.(Verifier)
+	if !ok {
+		return VerifyReport{}, fmt.Errorf(
+			"%s cache backend does not support verification",
+			c.backend.Name(),
+		)
+	}
+
+	start := time.Now()
+
+	report, err := verifier.Verify(repair)
+	if err != nil {
+		return report, err
+	}
+
+	elapsed := time.Now().Sub(start)
+	logger().Debug(
+		"cache verify",
+		"repair",
+		repair,
+		"discarded",
+		report.Discarded,
+		"duration_ms",
+		elapsed.Milliseconds(),
+	)
+
+	return report, nil
+}
+
+// Returns the absolute path of the directory holding the caches of every
 // backend.
 //
 // Tries to store it under the XDG_CACHE_HOME dir.
-func CacheStorageDir(name string) (_ string, err error) {
+func CacheRootDir() (_ string, err error) {
 	defer func() {
 		if err != nil {
 			err = fmt.Errorf("failed to determine cache storage path: %w", err)
@@ -188,7 +402,7 @@ func CacheStorageDir(name string) (_ string, err error) {
 		cacheHome = os.Getenv("XDG_CACHE_HOME")
 	}
 
-	p := filepath.Join(cacheHome, "git-author", name)
+	p := filepath.Join(cacheHome, "git-author")
 	absP, err := filepath.Abs(p)
 	if err != nil {
 		return "", err
@@ -197,25 +411,161 @@ func CacheStorageDir(name string) (_ string, err error) {
 	return absP, nil
 }
 
+// Returns the absolute path at which we should store data for a given cache
+// backend.
+func CacheStorageDir(name string) (string, error) {
+	root, err := CacheRootDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(root, name), nil
+}
+
+// Returns the most space in bytes the caches of all repositories together may
+// take up, as set by GIT_WHO_CACHE_SIZE, or zero if there is no limit.
+//
+// The size is a number of bytes, optionally followed by a unit: K, M, G or T
+// (powers of 1024), with or without a trailing "iB" or "B".
+func CacheBudget() (_ int64, err error) {
+	value := strings.TrimSpace(os.Getenv("GIT_WHO_CACHE_SIZE"))
+	if value == "" {
+		return 0, nil
+	}
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("invalid GIT_WHO_CACHE_SIZE \"%s\": %w", value, err)
+		}
+	}()
+
+	number := strings.TrimRight(strings.ToUpper(value), "KMGTIB ")
+	unit := strings.TrimSpace(strings.ToUpper(value[len(number):]))
+	unit = strings.TrimSuffix(strings.TrimSuffix(unit, "B"), "I")
+
+	multipliers := map[string]float64{
+		"":  1,
+		"K": 1 << 10,
+		"M": 1 << 20,
+		"G": 1 << 30,
+		"T": 1 << 40,
+	}
+
+	multiplier, ok := multipliers[unit]
+	if !ok {
+		return 0, errors.New("unknown unit")
+	}
+
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, errors.New("not a number")
+	}
+
+	if n < 0 {
+		return 0, errors.New("size cannot be negative")
+	}
+
+	return int64(n * multiplier), nil
+}
+
+// Version of the format of cached commits. Bump this whenever git.Commit, the
+// way we parse commits, or the way backends lay out their files changes, so
+// that caches written by other versions of git-author are discarded instead of
+// being decoded into the wrong shape.
+const FormatVersion = 3
+
 // Returns a hash of state in the repo that, if changed, should invalidate our
 // cache.
-func RepoStateHash(gitRootPath string) (string, error) {
-	mailmapPath := filepath.Join(gitRootPath, ".mailmap")
+//
+// This covers the cache format version, the options we parse git log output
+// with, and every source git reads the mailmap from, since cached commits store
+// author names and emails with the mailmap already applied.
+func RepoStateHash(gitRootPath string) (_ string, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to hash repository state: %w", err)
+		}
+	}()
 
 	h := fnv.New32()
 
-	f, err := os.Open(mailmapPath)
+	fmt.Fprintf(h, "version %d\n", FormatVersion)
+	fmt.Fprintf(h, "log args %s\n", strings.Join(git.DiffLogArgs(), " "))
+
+	// Rename detection changes the paths in numstat output
+	renames, err := git.GetConfig("diff.renames")
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(h, "diff.renames %s\n", renames)
+
+	err = hashFile(h, ".mailmap", filepath.Join(gitRootPath, ".mailmap"))
+	if err != nil {
+		return "", err
+	}
+
+	mailmapFile, err := git.GetConfigPath("mailmap.file")
+	if err != nil {
+		return "", err
+	}
+
+	if mailmapFile != "" {
+		if !filepath.IsAbs(mailmapFile) {
+			mailmapFile = filepath.Join(gitRootPath, mailmapFile)
+		}
+
+		err = hashFile(h, "mailmap.file", mailmapFile)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	mailmapBlob, err := git.GetConfig("mailmap.blob")
+	if err != nil {
+		return "", err
+	}
+
+	if mailmapBlob == "" {
+		// In bare repositories, git defaults to the mailmap in HEAD
+		bare, err := git.IsBare()
+		if err != nil {
+			return "", err
+		}
+
+		if bare {
+			mailmapBlob = "HEAD:.mailmap"
+		}
+	}
+
+	if mailmapBlob != "" {
+		blobHash, err := git.ResolveRev(mailmapBlob)
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(h, "mailmap.blob %s %s\n", mailmapBlob, blobHash)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Writes the name and contents of the file at path to w. Missing files are
+// skipped.
+func hashFile(w io.Writer, name string, path string) error {
+	f, err := os.Open(path)
 	if errors.Is(err, fs.ErrNotExist) {
-		return hex.EncodeToString(h.Sum(nil)), nil
+		return nil
 	} else if err != nil {
-		return "", fmt.Errorf("could not read mailmap file: %v", err)
+		return fmt.Errorf("could not read %s: %w", name, err)
 	}
 	defer f.Close()
 
-	_, err = io.Copy(h, f)
+	fmt.Fprintf(w, "%s\n", name)
+
+	_, err = io.Copy(w, f)
 	if err != nil {
-		return "", fmt.Errorf("error hashing mailmap file: %v", err)
+		return fmt.Errorf("error hashing %s: %w", name, err)
 	}
 
-	return hex.EncodeToString(h.Sum(nil)), nil
+	return nil
 }
@@ -0,0 +1,112 @@
+package cache_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/trinhminhtriet/git-author/internal/cache"
+)
+
+func gitCmd(t *testing.T, args ...string) {
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, out)
+	}
+}
+
+func TestRepoStateHashMailmapSources(t *testing.T) {
+	root := t.TempDir()
+	t.Chdir(root)
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(root, "gitconfig"))
+	gitCmd(t, "init", "-q")
+
+	hash := func() string {
+		h, err := cache.RepoStateHash(root)
+		if err != nil {
+			t.Fatalf("hashing repo state failed with error: %v", err)
+		}
+		return h
+	}
+
+	writeFile := func(name string, contents string) {
+		err := os.WriteFile(filepath.Join(root, name), []byte(contents), 0o644)
+		if err != nil {
+			t.Fatalf("could not write %s: %v", name, err)
+		}
+	}
+
+	initial := hash()
+	if hash() != initial {
+		t.Fatal("hash is not stable")
+	}
+
+	writeFile(".mailmap", "Jane <jane@doe.local> <jd@doe.local>\n")
+	withMailmap := hash()
+	if withMailmap == initial {
+		t.Error("hash did not change when .mailmap was added")
+	}
+
+	writeFile("extra.mailmap", "John <john@doe.local> <jd@doe.local>\n")
+	gitCmd(t, "config", "mailmap.file", "extra.mailmap")
+	withMailmapFile := hash()
+	if withMailmapFile == withMailmap {
+		t.Error("hash did not change when mailmap.file was set")
+	}
+
+	writeFile("extra.mailmap", "Jim <jim@doe.local> <jd@doe.local>\n")
+	if hash() == withMailmapFile {
+		t.Error("hash did not change when mailmap.file changed")
+	}
+
+	gitCmd(t, "config", "diff.renames", "false")
+	withRenames := hash()
+	gitCmd(t, "config", "--unset", "diff.renames")
+	if hash() == withRenames {
+		t.Error("hash did not change when diff.renames changed")
+	}
+}
+
+func TestCacheBudget(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+	}{
+		{"", 0},
+		{"0", 0},
+		{"4096", 4096},
+		{"100B", 100},
+		{"2k", 2 << 10},
+		{"500M", 500 << 20},
+		{"500 MB", 500 << 20},
+		{"1.5GiB", 3 << 29},
+		{"1T", 1 << 40},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			t.Setenv("GIT_WHO_CACHE_SIZE", test.value)
+
+			got, err := cache.CacheBudget()
+			if err != nil {
+				t.Fatalf("parsing budget failed with error: %v", err)
+			}
+
+			if got != test.want {
+				t.Errorf("expected %d bytes, got %d", test.want, got)
+			}
+		})
+	}
+
+	for _, value := range []string{"lots", "10X", "GB", "-1M"} {
+		t.Run(value, func(t *testing.T) {
+			t.Setenv("GIT_WHO_CACHE_SIZE", value)
+
+			_, err := cache.CacheBudget()
+			if err == nil {
+				t.Errorf("expected error for \"%s\"", value)
+			}
+		})
+	}
+}
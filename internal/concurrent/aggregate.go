@@ -0,0 +1,178 @@
+package concurrent
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+
+	"github.com/trinhminhtriet/git-author/internal/cache"
+	"github.com/trinhminhtriet/git-author/internal/git"
+)
+
+// Saves the tally over the history of a single commit to the cache, so that a
+// later run over the history of a descendant only has to tally the commits in
+// between. See cache.Aggregate.
+type aggregation struct {
+	key      string
+	tip      string // Hash of the commit we are tallying the history of
+	savedTip string // Hash of the commit the saved tally was for, if any
+	recorder *exclusionRecorder
+}
+
+// Records whether each path tallied was excluded from line and file metrics,
+// so we can tell later whether a saved tally is still valid.
+type exclusionRecorder struct {
+	exclude  func(path string) bool // May be nil
+	excluded map[string]bool
+	mu       sync.Mutex
+}
+
+func (r *exclusionRecorder) IsExcluded(path string) bool {
+	excluded := r.exclude != nil && r.exclude(path)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.excluded[path] = excluded
+	return excluded
+}
+
+// Returns nil if the tally can't be saved. Only tallies over the full history
+// of a single commit can be saved.
+func newAggregation[T combinable[T]](
+	whop whoperation[T],
+) (_ *aggregation, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("could not set up saved tally: %w", err)
+		}
+	}()
+
+	filters := whop.filters
+	if whop.opts.KeyName == "" ||
+		filters.Since != "" ||
+		filters.Until != "" ||
+		len(filters.Authors) > 0 ||
+		len(filters.Nauthors) > 0 {
+		return nil, nil
+	}
+
+	if len(whop.revspec) != 1 ||
+		strings.HasPrefix(whop.revspec[0], "^") ||
+		strings.HasPrefix(whop.revspec[0], "-") ||
+		strings.Contains(whop.revspec[0], "..") {
+		return nil, nil
+	}
+
+	tip, err := git.ResolveRev(whop.revspec[0] + "^{commit}")
+	if err != nil || tip == "" {
+		return nil, err
+	}
+
+	// Pathspecs are relative to the working directory
+	prefix, err := git.GetPrefix()
+	if err != nil {
+		return nil, err
+	}
+
+	key := strings.Join([]string{
+		whop.name,
+		"key=" + whop.opts.KeyName,
+		fmt.Sprintf("merges=%t", whop.opts.CountMerges),
+		"prefix=" + prefix,
+		"pathspecs=" + strings.Join(whop.pathspecs, "\x00"),
+	}, "\n")
+
+	return &aggregation{
+		key: key,
+		tip: tip,
+		recorder: &exclusionRecorder{
+			exclude:  whop.opts.ExcludePath,
+			excluded: map[string]bool{},
+		},
+	}, nil
+}
+
+// Returns the saved tally and the revspec for the commits that still have to be
+// tallied on top of it. Returns false if there is no saved tally we can use.
+func loadAggregate[T combinable[T]](
+	ctx context.Context,
+	agg *aggregation,
+	c *cache.Cache,
+) (_ T, _ []string, _ bool, err error) {
+	var none T
+
+	saved, ok, err := c.GetAggregate(agg.key)
+	if err != nil || !ok {
+		return none, nil, false, err
+	}
+
+	isAncestor, err := git.IsAncestor(ctx, saved.Tip, agg.tip)
+	if err != nil {
+		return none, nil, false, err
+	}
+
+	if !isAncestor {
+		logger().Debug(
+			"saved tally is not for an ancestor; ignoring it",
+			"savedTip",
+			saved.Tip,
+			"tip",
+			agg.tip,
+		)
+		return none, nil, false, nil
+	}
+
+	for path, wasExcluded := range saved.Excluded {
+		exclude := agg.recorder.exclude
+		if (exclude != nil && exclude(path)) != wasExcluded {
+			logger().Debug(
+				"path exclusions changed since tally was saved; ignoring it",
+				"path",
+				path,
+			)
+			return none, nil, false, nil
+		}
+	}
+
+	var accumulator T
+	err = gob.NewDecoder(bytes.NewReader(saved.Tally)).Decode(&accumulator)
+	if err != nil {
+		return none, nil, false, err
+	}
+
+	maps.Copy(agg.recorder.excluded, saved.Excluded)
+	agg.savedTip = saved.Tip
+
+	logger().Debug("starting from saved tally", "savedTip", saved.Tip)
+	return accumulator, []string{agg.tip, "^" + saved.Tip}, true, nil
+}
+
+func saveAggregate[T combinable[T]](
+	agg *aggregation,
+	c *cache.Cache,
+	accumulator T,
+) error {
+	if agg.savedTip == agg.tip {
+		return nil // Nothing new
+	}
+
+	var data bytes.Buffer
+	err := gob.NewEncoder(&data).Encode(accumulator)
+	if err != nil {
+		return fmt.Errorf("could not encode tally: %w", err)
+	}
+
+	agg.recorder.mu.Lock()
+	defer agg.recorder.mu.Unlock()
+
+	return c.SetAggregate(agg.key, cache.Aggregate{
+		Tip:      agg.tip,
+		Excluded: agg.recorder.excluded,
+		Tally:    data.Bytes(),
+	})
+}
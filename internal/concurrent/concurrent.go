@@ -25,6 +25,7 @@ import (
 	"fmt"
 	"iter"
 	"runtime"
+	"slices"
 	"time"
 
 	"github.com/trinhminhtriet/git-author/internal/cache"
@@ -32,11 +33,14 @@ import (
 	"github.com/trinhminhtriet/git-author/internal/git"
 	"github.com/trinhminhtriet/git-author/internal/pretty"
 	"github.com/trinhminhtriet/git-author/internal/tally"
+	"github.com/trinhminhtriet/git-author/internal/utils/iterutils"
 )
 
 // We run one git log process for each chuck of this many revisions.
 const chunkSize = 1024
 
+// Most workers we run at once. With a single CPU there is only one worker, but
+// commits still go through the cache.
 var nCPU int
 
 func init() {
@@ -54,6 +58,7 @@ type combinable[T any] interface {
 
 // tally job we can do concurrently
 type whoperation[T combinable[T]] struct {
+	name      string // Kind of tally, for telling saved tallies apart
 	revspec   []string
 	pathspecs []string
 	filters   git.LogFilters
@@ -110,13 +115,60 @@ func accumulateCached[T combinable[T]](
 	return accumulator, setDiff(revs, foundRevs), nil
 }
 
-func handleCacheFailure(c cache.Cache, err error) error {
-	// Graceful handling of cache error. Wipe cache and move on without it
+// Graceful handling of cache error. Tries to repair the cache by dropping only
+// the entries that are damaged. If it can't be repaired, wipes the cache and
+// moves on without it.
+//
+// Returns true if the cache was repaired and can be read from again.
+func handleCacheFailure(c cache.Cache, err error) (bool, error) {
 	logger().Warn(
 		fmt.Sprintf("error reading from cache (maybe corrupt?): %v", err),
 	)
+
+	report, err := c.Verify(true)
+	if err == nil {
+		logger().Warn(fmt.Sprintf(
+			"repaired cache, dropping %d damaged entries",
+			report.Discarded,
+		))
+		return true, nil
+	}
+
+	logger().Debug("could not repair cache", "err", err)
 	logger().Warn("wiping cache and moving on")
-	return c.Clear()
+	return false, c.Clear()
+}
+
+// Like accumulateCached(), but if the cache can't be read, repairs it and tries
+// again, or wipes it. If nothing could be read from the cache, every rev in
+// revs remains to be tallied.
+func accumulateCachedOrRepair[T combinable[T]](
+	whop whoperation[T],
+	c cache.Cache,
+	revs []string,
+) (T, []string, error) {
+	var none T
+
+	accumulator, remainingRevs, err := accumulateCached(whop, c, revs)
+	if err == nil {
+		return accumulator, remainingRevs, nil
+	}
+
+	repaired, err := handleCacheFailure(c, err)
+	if err != nil || !repaired {
+		return none, revs, err
+	}
+
+	accumulator, remainingRevs, err = accumulateCached(whop, c, revs)
+	if err != nil {
+		logger().Warn(
+			fmt.Sprintf("error reading from repaired cache: %v", err),
+		)
+		logger().Warn("wiping cache and moving on")
+		return none, revs, c.Clear()
+	}
+
+	return accumulator, remainingRevs, nil
 }
 
 func tallyFanOutFanIn[T combinable[T]](
@@ -133,8 +185,64 @@ func tallyFanOutFanIn[T combinable[T]](
 
 	var accumulator T
 
+	err := cache.Open()
+	defer func() {
+		err = cache.Close()
+	}()
+
+	cacheOpen := err == nil
+	if !cacheOpen {
+		repaired, err := handleCacheFailure(cache, err)
+		if err != nil {
+			return accumulator, err
+		}
+
+		if repaired {
+			err = cache.Open()
+			if err != nil {
+				logger().Warn(
+					fmt.Sprintf("could not reopen repaired cache: %v", err),
+				)
+			}
+			cacheOpen = err == nil
+		}
+	}
+
+	// -- Start from a tally saved by an earlier run, if there is one ----------
+	revspec := whop.revspec
+
+	if cacheOpen {
+		agg, err := newAggregation(whop)
+		if err != nil {
+			logger().Warn(err.Error())
+		} else if agg != nil {
+			whop.opts.ExcludePath = agg.recorder.IsExcluded
+
+			saved, since, ok, err := loadAggregate[T](ctx, agg, &cache)
+			if err != nil {
+				logger().Warn(
+					fmt.Sprintf("could not read saved tally; ignoring it: %v", err),
+				)
+			} else if ok {
+				accumulator = saved
+				revspec = since
+			}
+
+			defer func() {
+				if _err != nil {
+					return
+				}
+
+				err := saveAggregate(agg, &cache, accumulator)
+				if err != nil {
+					logger().Warn(fmt.Sprintf("could not save tally: %v", err))
+				}
+			}()
+		}
+	}
+
 	// -- Get rev list ---------------------------------------------------------
-	revs, err := git.RevList(ctx, whop.revspec, whop.pathspecs, whop.filters)
+	revs, err := git.RevList(ctx, revspec, whop.pathspecs, whop.filters)
 	if err != nil {
 		return accumulator, err
 	}
@@ -147,27 +255,18 @@ func tallyFanOutFanIn[T combinable[T]](
 	// -- Use cached commits if there are any ----------------------------------
 	remainingRevs := revs
 
-	err = cache.Open()
-	defer func() {
-		err = cache.Close()
-	}()
-
-	if err == nil {
-		accumulator, remainingRevs, err = accumulateCached(whop, cache, revs)
+	if cacheOpen {
+		var cached T
+		cached, remainingRevs, err = accumulateCachedOrRepair(whop, cache, revs)
 		if err != nil {
-			err = handleCacheFailure(cache, err)
-			if err != nil {
-				return accumulator, err
-			}
-		} else if len(remainingRevs) == 0 {
+			return accumulator, err
+		}
+
+		accumulator = accumulator.Combine(cached)
+		if len(remainingRevs) == 0 {
 			logger().Debug("all commits read from cache")
 			return accumulator, nil
 		}
-	} else {
-		err = handleCacheFailure(cache, err)
-		if err != nil {
-			return accumulator, err
-		}
 	}
 
 	// -- Fork -----------------------------------------------------------------
@@ -291,7 +390,9 @@ loop:
 	return accumulator, nil
 }
 
-func TallyCommits(
+// Tallies commits by author and path, reading commits from the cache where we
+// can and diffing the rest in parallel.
+func TallyCommitsByPath(
 	ctx context.Context,
 	revspec []string,
 	pathspecs []string,
@@ -299,8 +400,9 @@ func TallyCommits(
 	opts tally.TallyOpts,
 	cache cache.Cache,
 	allowProgressBar bool,
-) (_ map[string]tally.Tally, err error) {
+) (tally.TalliesByPath, error) {
 	whop := whoperation[tally.TalliesByPath]{
+		name:      "by-path",
 		revspec:   revspec,
 		pathspecs: pathspecs,
 		filters:   filters,
@@ -308,39 +410,41 @@ func TallyCommits(
 		opts:      opts,
 	}
 
-	talliesByPath, err := tallyFanOutFanIn[tally.TalliesByPath](
+	return tallyFanOutFanIn[tally.TalliesByPath](
 		ctx,
 		whop,
 		cache,
 		allowProgressBar,
 	)
-	if err != nil {
-		return nil, err
-	}
-
-	return talliesByPath.Reduce(), nil
 }
 
-func TallyCommitsTree(
+func TallyCommitsTimeline(
 	ctx context.Context,
 	revspec []string,
 	pathspecs []string,
 	filters git.LogFilters,
 	opts tally.TallyOpts,
-	worktreePaths map[string]bool,
-	gitRootPath string,
+	end time.Time,
 	cache cache.Cache,
 	allowProgressBar bool,
-) (*tally.TreeNode, error) {
-	whop := whoperation[tally.TalliesByPath]{
+) ([]tally.TimeBucket, error) {
+	f := func(
+		commits iter.Seq2[git.Commit, error],
+		opts tally.TallyOpts,
+	) (tally.TimeSeries, error) {
+		return tally.TallyCommitsByDate(commits, opts)
+	}
+
+	whop := whoperation[tally.TimeSeries]{
+		name:      "by-date",
 		revspec:   revspec,
 		pathspecs: pathspecs,
 		filters:   filters,
-		tally:     tally.TallyCommitsByPath,
+		tally:     f,
 		opts:      opts,
 	}
 
-	talliesByPath, err := tallyFanOutFanIn[tally.TalliesByPath](
+	buckets, err := tallyFanOutFanIn[tally.TimeSeries](
 		ctx,
 		whop,
 		cache,
@@ -350,14 +454,60 @@ func TallyCommitsTree(
 		return nil, err
 	}
 
-	return tally.TallyCommitsTreeFromPaths(
-		talliesByPath,
-		worktreePaths,
-		gitRootPath,
+	return rebucket(buckets, end), nil
+}
+
+// Tallies by author and path and by date, made in the same pass over the
+// commits.
+type pathsAndDates struct {
+	ByPath tally.TalliesByPath
+	ByDate tally.TimeSeries
+}
+
+func (a pathsAndDates) Combine(b pathsAndDates) pathsAndDates {
+	if b.ByPath == nil {
+		b.ByPath = tally.TalliesByPath{}
+	}
+
+	return pathsAndDates{
+		ByPath: a.ByPath.Combine(b.ByPath),
+		ByDate: a.ByDate.Combine(b.ByDate),
+	}
+}
+
+func tallyPathsAndDates(
+	commits iter.Seq2[git.Commit, error],
+	opts tally.TallyOpts,
+) (pathsAndDates, error) {
+	// Hold on to the commits so we only have to read them once
+	collected, err := iterutils.Collect(commits)
+	if err != nil {
+		return pathsAndDates{}, err
+	}
+
+	byPath, err := tally.TallyCommitsByPath(
+		iterutils.WithoutErrors(slices.Values(collected)),
+		opts,
+	)
+	if err != nil {
+		return pathsAndDates{}, err
+	}
+
+	byDate, err := tally.TallyCommitsByDate(
+		iterutils.WithoutErrors(slices.Values(collected)),
+		opts,
 	)
+	if err != nil {
+		return pathsAndDates{}, err
+	}
+
+	return pathsAndDates{ByPath: byPath, ByDate: byDate}, nil
 }
 
-func TallyCommitsTimeline(
+// Tallies commits by author and path and into time buckets ending at end, or
+// at the last commit if end is the zero time. Each commit is read only once,
+// for both tallies.
+func TallyCommitsByPathAndTimeline(
 	ctx context.Context,
 	revspec []string,
 	pathspecs []string,
@@ -366,36 +516,44 @@ func TallyCommitsTimeline(
 	end time.Time,
 	cache cache.Cache,
 	allowProgressBar bool,
-) ([]tally.TimeBucket, error) {
-	f := func(
-		commits iter.Seq2[git.Commit, error],
-		opts tally.TallyOpts,
-	) (tally.TimeSeries, error) {
-		return tally.TallyCommitsByDate(commits, opts)
-	}
-
-	whop := whoperation[tally.TimeSeries]{
+) (tally.TalliesByPath, []tally.TimeBucket, error) {
+	whop := whoperation[pathsAndDates]{
+		name:      "by-path-and-date",
 		revspec:   revspec,
 		pathspecs: pathspecs,
 		filters:   filters,
-		tally:     f,
+		tally:     tallyPathsAndDates,
 		opts:      opts,
 	}
 
-	buckets, err := tallyFanOutFanIn[tally.TimeSeries](
+	tallies, err := tallyFanOutFanIn[pathsAndDates](
 		ctx,
 		whop,
 		cache,
 		allowProgressBar,
 	)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	if tallies.ByPath == nil {
+		tallies.ByPath = tally.TalliesByPath{}
+	}
+
+	return tallies.ByPath, rebucket(tallies.ByDate, end), nil
+}
+
+// Spreads the buckets evenly up to end, or up to the last bucket if end is the
+// zero time.
+func rebucket(buckets []tally.TimeBucket, end time.Time) []tally.TimeBucket {
+	if len(buckets) == 0 {
+		return buckets
 	}
 
 	if end.IsZero() {
 		end = buckets[len(buckets)-1].Time
 	}
+
 	resolution := tally.CalcResolution(buckets[0].Time, end)
-	rebuckets := tally.Rebucket(buckets, resolution, end)
-	return rebuckets, nil
+	return tally.Rebucket(buckets, resolution, end)
 }
@@ -0,0 +1,320 @@
+package concurrent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/trinhminhtriet/git-author/internal/cache"
+	"github.com/trinhminhtriet/git-author/internal/cache/backends"
+	"github.com/trinhminhtriet/git-author/internal/git"
+	"github.com/trinhminhtriet/git-author/internal/repotest"
+	"github.com/trinhminhtriet/git-author/internal/tally"
+)
+
+// Makes a repository with enough commits to fill several chunks.
+func newChunkedRepo(t *testing.T) {
+	authors := []string{"Alice", "Bob", "Carol", "Dave", "Erin"}
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	commits := []repotest.Commit{}
+	for i := range 2*chunkSize + 100 {
+		author := authors[i%len(authors)]
+		path := fmt.Sprintf("dir%d/file%d.txt", i%3, i%40)
+		contents := strings.Repeat("line\n", i%7+1) + fmt.Sprintln(i)
+
+		files := map[string]string{path: contents}
+		if i%97 == 0 {
+			files[fmt.Sprintf("dir%d/file%d.txt", (i+1)%3, (i+1)%40)] = ""
+		}
+
+		commits = append(commits, repotest.Commit{
+			Name:  author,
+			Email: strings.ToLower(author) + "@mail.com",
+			Date:  start.Add(time.Duration(i) * 3 * time.Hour),
+			Files: files,
+		})
+	}
+
+	repotest.NewRepo(t, commits)
+}
+
+func setWorkers(t *testing.T, n int) {
+	saved := nCPU
+	nCPU = n
+	t.Cleanup(func() { nCPU = saved })
+}
+
+func testOpts(mode tally.TallyMode) tally.TallyOpts {
+	return tally.TallyOpts{
+		Mode:    mode,
+		Key:     func(c git.Commit) string { return c.AuthorName },
+		KeyName: "name",
+	}
+}
+
+// Tallies the commits in a single pass, without the cache or the worker pool.
+func serialByPath(
+	t *testing.T,
+	pathspecs []string,
+	opts tally.TallyOpts,
+) tally.TalliesByPath {
+	commits, closer, err := git.CommitsWithOpts(
+		context.Background(),
+		[]string{"HEAD"},
+		pathspecs,
+		git.LogFilters{},
+		true,
+	)
+	if err != nil {
+		t.Fatalf("could not log commits: %v", err)
+	}
+
+	tallies, err := tally.TallyCommitsByPath(commits, opts)
+	if err != nil {
+		t.Fatalf("serial tally failed with error: %v", err)
+	}
+
+	if err := closer(); err != nil {
+		t.Fatalf("could not close git log: %v", err)
+	}
+
+	return tallies
+}
+
+func serialTimeline(t *testing.T, opts tally.TallyOpts) []tally.TimeBucket {
+	commits, closer, err := git.CommitsWithOpts(
+		context.Background(),
+		[]string{"HEAD"},
+		nil,
+		git.LogFilters{},
+		true,
+	)
+	if err != nil {
+		t.Fatalf("could not log commits: %v", err)
+	}
+
+	buckets, err := tally.TallyCommitsTimeline(commits, opts, time.Time{})
+	if err != nil {
+		t.Fatalf("serial tally failed with error: %v", err)
+	}
+
+	if err := closer(); err != nil {
+		t.Fatalf("could not close git log: %v", err)
+	}
+
+	return buckets
+}
+
+// Returns the final tallies sorted by name, so that they compare equal however
+// ties were ranked.
+func rankByName(
+	tallies map[string]tally.Tally,
+	mode tally.TallyMode,
+) []tally.FinalTally {
+	ranked := tally.Rank(tallies, mode)
+	slices.SortStableFunc(ranked, func(a, b tally.FinalTally) int {
+		return strings.Compare(a.AuthorName, b.AuthorName)
+	})
+	return ranked
+}
+
+func diffByPath(
+	expected tally.TalliesByPath,
+	got tally.TalliesByPath,
+	mode tally.TallyMode,
+) string {
+	return cmp.Diff(
+		rankByName(expected.Reduce(), mode),
+		rankByName(got.Reduce(), mode),
+	)
+}
+
+// The parts of a time bucket that end up in the output.
+type bucketSummary struct {
+	Name    string
+	Total   int
+	Authors []tally.FinalTally
+}
+
+func diffTimeline(
+	expected []tally.TimeBucket,
+	got []tally.TimeBucket,
+	mode tally.TallyMode,
+) string {
+	summarize := func(buckets []tally.TimeBucket) []bucketSummary {
+		summaries := []bucketSummary{}
+		for _, bucket := range buckets {
+			authors := bucket.Authors(mode)
+			slices.SortStableFunc(authors, func(a, b tally.FinalTally) int {
+				return strings.Compare(a.AuthorName, b.AuthorName)
+			})
+
+			summaries = append(summaries, bucketSummary{
+				Name:    bucket.Name,
+				Total:   bucket.Rank(mode).TotalValue(mode),
+				Authors: authors,
+			})
+		}
+		return summaries
+	}
+
+	return cmp.Diff(summarize(expected), summarize(got))
+}
+
+func TestPooledTallyMatchesSerial(t *testing.T) {
+	newChunkedRepo(t)
+	ctx := context.Background()
+
+	modes := map[string]tally.TallyMode{
+		"commits": tally.CommitMode,
+		"lines":   tally.LinesMode,
+		"files":   tally.FilesMode,
+	}
+
+	for _, workers := range []int{1, 4} {
+		for modeName, mode := range modes {
+			name := fmt.Sprintf("%d_workers_%s", workers, modeName)
+			t.Run(name, func(t *testing.T) {
+				setWorkers(t, workers)
+				opts := testOpts(mode)
+				noCache := cache.NewCache(backends.NoopBackend{})
+
+				byPath, err := TallyCommitsByPath(
+					ctx,
+					[]string{"HEAD"},
+					nil,
+					git.LogFilters{},
+					opts,
+					noCache,
+					false,
+				)
+				if err != nil {
+					t.Fatalf("pooled tally failed with error: %v", err)
+				}
+
+				expectedByPath := serialByPath(t, nil, opts)
+				if diff := diffByPath(expectedByPath, byPath, mode); diff != "" {
+					t.Errorf("tally by path is wrong:\n%s", diff)
+				}
+
+				buckets, err := TallyCommitsTimeline(
+					ctx,
+					[]string{"HEAD"},
+					nil,
+					git.LogFilters{},
+					opts,
+					time.Time{},
+					noCache,
+					false,
+				)
+				if err != nil {
+					t.Fatalf("pooled timeline failed with error: %v", err)
+				}
+
+				expectedBuckets := serialTimeline(t, opts)
+				if diff := diffTimeline(expectedBuckets, buckets, mode); diff != "" {
+					t.Errorf("timeline is wrong:\n%s", diff)
+				}
+
+				byPath, buckets, err = TallyCommitsByPathAndTimeline(
+					ctx,
+					[]string{"HEAD"},
+					nil,
+					git.LogFilters{},
+					opts,
+					time.Time{},
+					noCache,
+					false,
+				)
+				if err != nil {
+					t.Fatalf("pooled tally failed with error: %v", err)
+				}
+
+				if diff := diffByPath(expectedByPath, byPath, mode); diff != "" {
+					t.Errorf("tally by path from one pass is wrong:\n%s", diff)
+				}
+				if diff := diffTimeline(expectedBuckets, buckets, mode); diff != "" {
+					t.Errorf("timeline from one pass is wrong:\n%s", diff)
+				}
+			})
+		}
+	}
+}
+
+func TestPooledTallyFillsAndReadsCache(t *testing.T) {
+	newChunkedRepo(t)
+	ctx := context.Background()
+
+	// A single worker still goes through the cache
+	setWorkers(t, 1)
+
+	opts := testOpts(tally.LinesMode)
+
+	dir := filepath.Join(t.TempDir(), "gob", "test-1234")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatalf("could not create cache dir: %v", err)
+	}
+
+	newCache := func() cache.Cache {
+		return cache.NewCache(&backends.GobBackend{
+			Dir:  dir,
+			Path: filepath.Join(dir, "commits.gob"),
+		})
+	}
+
+	runs := []struct {
+		name      string
+		pathspecs []string
+	}{
+		{"cold", nil},
+		{"warm_saved_tally", nil},
+		{"warm_cached_commits", []string{"dir1"}},
+	}
+
+	for _, run := range runs {
+		byPath, err := TallyCommitsByPath(
+			ctx,
+			[]string{"HEAD"},
+			run.pathspecs,
+			git.LogFilters{},
+			opts,
+			newCache(),
+			false,
+		)
+		if err != nil {
+			t.Fatalf("%s run failed with error: %v", run.name, err)
+		}
+
+		expected := serialByPath(t, run.pathspecs, opts)
+		if diff := diffByPath(expected, byPath, opts.Mode); diff != "" {
+			t.Errorf("%s run tally is wrong:\n%s", run.name, diff)
+		}
+
+		c := newCache()
+		if err := c.Open(); err != nil {
+			t.Fatalf("could not open cache: %v", err)
+		}
+		stats, err := c.Stats()
+		c.Close()
+		if err != nil {
+			t.Fatalf("reading cache stats failed with error: %v", err)
+		}
+
+		if stats.Commits != 2*chunkSize+100 {
+			t.Errorf(
+				"after %s run, expected %d commits in cache, got %d",
+				run.name,
+				2*chunkSize+100,
+				stats.Commits,
+			)
+		}
+	}
+}
@@ -104,3 +104,20 @@ func Number(num int) string {
 
 	return fmt.Sprintf("%d", num)
 }
+
+// Formats a size in bytes using the largest binary unit that fits
+func Bytes(n int64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	units := []string{"KiB", "MiB", "GiB", "TiB"}
+	size := float64(n) / 1024
+	i := 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i += 1
+	}
+
+	return fmt.Sprintf("%.1f %s", size, units[i])
+}
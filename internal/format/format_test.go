@@ -91,3 +91,41 @@ func TestNumberNegativeError(t *testing.T) {
 
 	format.Number(-1)
 }
+
+func TestBytes(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int64
+		exp  string
+	}{
+		{
+			name: "zero",
+			n:    0,
+			exp:  "0 B",
+		},
+		{
+			name: "bytes",
+			n:    1023,
+			exp:  "1023 B",
+		},
+		{
+			name: "kibibytes",
+			n:    1536,
+			exp:  "1.5 KiB",
+		},
+		{
+			name: "mebibytes",
+			n:    12 * 1024 * 1024,
+			exp:  "12.0 MiB",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ans := format.Bytes(test.n)
+			if ans != test.exp {
+				t.Errorf("expected %s but got %s", test.exp, ans)
+			}
+		})
+	}
+}
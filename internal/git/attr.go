@@ -0,0 +1,178 @@
+package git
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Values git check-attr reports for attributes that aren't set to a value.
+const (
+	AttrSet         = "set"
+	AttrUnset       = "unset"
+	AttrUnspecified = "unspecified"
+)
+
+// Looks up gitattributes for paths as they appear in git log output.
+//
+// A single git check-attr process is kept running so that paths can be
+// checked as we come across them. It is safe to call Check() from multiple
+// goroutines.
+type AttrChecker struct {
+	attrs      []string
+	cdup       string // Prefix turning repo-relative paths into cwd-relative
+	subprocess *Subprocess
+	w          *bufio.Writer
+	r          *bufio.Reader
+	closeStdin func() error
+	mu         sync.Mutex
+}
+
+// Starts a checker for the given attributes. They are read from the
+// .gitattributes files in the source revision, so that a bare repository or an
+// older revision is checked the way it was committed. With no source, or with a
+// git too old to support check-attr --source, they are read from the working
+// tree instead.
+func NewAttrChecker(
+	ctx context.Context,
+	attrs []string,
+	source string,
+) (_ *AttrChecker, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to start attribute checker: %w", err)
+		}
+	}()
+
+	cdup, err := getCdup(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if source != "" && !canCheckAttrAt(ctx, source) {
+		logger().Debug(
+			"git check-attr can't read attributes from revision",
+			"source",
+			source,
+		)
+		source = ""
+	}
+
+	subprocess, err := RunCheckAttr(ctx, attrs, source)
+	if err != nil {
+		return nil, err
+	}
+
+	w, closeStdin := subprocess.StdinWriter()
+	return &AttrChecker{
+		attrs:      attrs,
+		cdup:       cdup,
+		subprocess: subprocess,
+		w:          w,
+		r:          bufio.NewReader(subprocess.stdout),
+		closeStdin: closeStdin,
+	}, nil
+}
+
+// Returns the state of each attribute for the given path, which should be
+// relative to the root of the repository. The state is one of AttrSet,
+// AttrUnset, AttrUnspecified, or the value the attribute is set to.
+func (c *AttrChecker) Check(path string) (_ map[string]string, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("error checking attributes of %s: %w", path, err)
+		}
+	}()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err = fmt.Fprintf(c.w, "%s%s\x00", c.cdup, path)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.w.Flush()
+	if err != nil {
+		return nil, err
+	}
+
+	// Output is a <path> NUL <attribute> NUL <info> NUL triple per attribute
+	values := map[string]string{}
+	for range c.attrs {
+		var fields [3]string
+		for i := range fields {
+			field, err := c.r.ReadString('\x00')
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
+			} else if err != nil {
+				return nil, err
+			}
+
+			fields[i] = strings.TrimSuffix(field, "\x00")
+		}
+
+		values[fields[1]] = fields[2]
+	}
+
+	return values, nil
+}
+
+// Stops the git check-attr process.
+func (c *AttrChecker) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := c.closeStdin()
+	if err != nil {
+		return err
+	}
+
+	return c.subprocess.Wait()
+}
+
+// Returns the path from the working directory up to the root of the repo.
+func getCdup(ctx context.Context) (_ string, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to run git rev-parse --show-cdup: %w", err)
+		}
+	}()
+
+	subprocess, err := run(ctx, []string{"rev-parse", "--show-cdup"}, false)
+	if err != nil {
+		return "", err
+	}
+
+	b, err := io.ReadAll(subprocess.stdout)
+	if err != nil {
+		return "", err
+	}
+
+	err = subprocess.Wait()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(b)), nil
+}
+
+// Returns whether git check-attr can read attributes from the given revision.
+// The --source option was added in git 2.40.
+func canCheckAttrAt(ctx context.Context, source string) bool {
+	args := []string{"check-attr", "--source=" + source, "diff", "--", "."}
+	subprocess, err := run(ctx, args, false)
+	if err != nil {
+		return false
+	}
+
+	_, err = io.Copy(io.Discard, subprocess.stdout)
+	if err != nil {
+		return false
+	}
+
+	return subprocess.Wait() == nil
+}
@@ -0,0 +1,184 @@
+package git_test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/trinhminhtriet/git-author/internal/git"
+	"github.com/trinhminhtriet/git-author/internal/repotest"
+)
+
+var checkedAttrs = []string{"linguist-generated", "diff", "binary"}
+
+func newAttrRepo(t *testing.T, gitattributes ...string) {
+	commits := []repotest.Commit{}
+	for i, attrs := range gitattributes {
+		commits = append(commits, repotest.Commit{
+			Name:  "Alice",
+			Email: "alice@mail.com",
+			Date:  time.Date(2024, 1, i+1, 12, 0, 0, 0, time.UTC),
+			Files: map[string]string{
+				".gitattributes":   attrs,
+				"main.go":          "package main\n",
+				"sub/main_test.go": "package main\n",
+			},
+		})
+	}
+
+	repotest.NewRepo(t, commits)
+}
+
+func checkAttrs(
+	t *testing.T,
+	checker *git.AttrChecker,
+	paths []string,
+) map[string]map[string]string {
+	t.Helper()
+
+	got := map[string]map[string]string{}
+	for _, path := range paths {
+		attrs, err := checker.Check(path)
+		if err != nil {
+			t.Fatalf("Check() returned error: %v", err)
+		}
+		got[path] = attrs
+	}
+
+	return got
+}
+
+func TestAttrChecker(t *testing.T) {
+	newAttrRepo(t, `gen/** linguist-generated
+*.png binary
+notes.txt -diff
+*.md diff=markdown
+`)
+
+	unspecified := map[string]string{
+		"linguist-generated": git.AttrUnspecified,
+		"diff":               git.AttrUnspecified,
+		"binary":             git.AttrUnspecified,
+	}
+	expected := map[string]map[string]string{
+		"main.go": unspecified,
+		"gen/api.pb.go": {
+			"linguist-generated": git.AttrSet,
+			"diff":               git.AttrUnspecified,
+			"binary":             git.AttrUnspecified,
+		},
+		"logo.png": {
+			"linguist-generated": git.AttrUnspecified,
+			"diff":               git.AttrUnset,
+			"binary":             git.AttrSet,
+		},
+		"notes.txt": {
+			"linguist-generated": git.AttrUnspecified,
+			"diff":               git.AttrUnset,
+			"binary":             git.AttrUnspecified,
+		},
+		"docs/read me.md": {
+			"linguist-generated": git.AttrUnspecified,
+			"diff":               "markdown",
+			"binary":             git.AttrUnspecified,
+		},
+	}
+	paths := []string{
+		"main.go",
+		"gen/api.pb.go",
+		"logo.png",
+		"notes.txt",
+		"docs/read me.md",
+	}
+
+	tests := []struct {
+		name   string
+		dir    string
+		source string
+	}{
+		{"work_tree", "", ""},
+		{"source", "", "HEAD"},
+		{"subdir", "sub", "HEAD"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.dir != "" {
+				t.Chdir(test.dir)
+			}
+
+			ctx := context.Background()
+			checker, err := git.NewAttrChecker(ctx, checkedAttrs, test.source)
+			if err != nil {
+				t.Fatalf("NewAttrChecker() returned error: %v", err)
+			}
+
+			got := checkAttrs(t, checker, paths)
+			if diff := cmp.Diff(expected, got); diff != "" {
+				t.Errorf("attributes are wrong:\n%s", diff)
+			}
+
+			if err := checker.Close(); err != nil {
+				t.Errorf("Close() returned error: %v", err)
+			}
+		})
+	}
+}
+
+func TestAttrCheckerReadsSource(t *testing.T) {
+	newAttrRepo(t, "*.go linguist-generated\n", "*.go -diff\n")
+
+	// Attributes in the work tree should not matter
+	err := os.WriteFile(".gitattributes", []byte("*.go binary\n"), 0o644)
+	if err != nil {
+		t.Fatalf("could not write .gitattributes: %v", err)
+	}
+
+	cmd := exec.Command("git", "check-attr", "--source=HEAD", "diff", "--", ".")
+	if err := cmd.Run(); err != nil {
+		t.Skip("git check-attr --source needs git 2.40 or later")
+	}
+
+	tests := []struct {
+		source string
+		exp    map[string]string
+	}{
+		{
+			source: "HEAD~1",
+			exp: map[string]string{
+				"linguist-generated": git.AttrSet,
+				"diff":               git.AttrUnspecified,
+				"binary":             git.AttrUnspecified,
+			},
+		},
+		{
+			source: "HEAD",
+			exp: map[string]string{
+				"linguist-generated": git.AttrUnspecified,
+				"diff":               git.AttrUnset,
+				"binary":             git.AttrUnspecified,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			ctx := context.Background()
+			checker, err := git.NewAttrChecker(ctx, checkedAttrs, test.source)
+			if err != nil {
+				t.Fatalf("NewAttrChecker() returned error: %v", err)
+			}
+			defer checker.Close()
+
+			got := checkAttrs(t, checker, []string{"main.go"})
+			expected := map[string]map[string]string{"main.go": test.exp}
+			if diff := cmp.Diff(expected, got); diff != "" {
+				t.Errorf("attributes are wrong:\n%s", diff)
+			}
+		})
+	}
+}
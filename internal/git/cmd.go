@@ -14,10 +14,26 @@ import (
 )
 
 const (
-	logFormat     = "--pretty=format:%H%n%h%n%p%n%aN%n%aE%n%ad%n" // newline
-	logDiffFormat = "--pretty=format:%H%n%h%n%p%n%aN%n%aE%n%ad"
+	logFormat     = "--pretty=format:%H%n%h%n%P%n%aN%n%aE%n%ad%n%cd%n" // newline
+	logDiffFormat = "--pretty=format:%H%n%h%n%P%n%aN%n%aE%n%ad%n%cd"
 )
 
+// Arguments to git log that determine what we parse out of each commit and its
+// diff.
+var diffLogArgs = []string{
+	logDiffFormat,
+	"-z",
+	"--date=unix",
+	"--no-show-signature",
+	"--numstat",
+}
+
+// Returns the arguments to git log that determine what we parse out of each
+// commit and its diff. Commits parsed with different arguments may differ.
+func DiffLogArgs() []string {
+	return slices.Clone(diffLogArgs)
+}
+
 type SubprocessErr struct {
 	ExitCode int
 	Stderr   string
@@ -226,15 +242,11 @@ func RunLog(
 ) (*Subprocess, error) {
 	var baseArgs []string
 	if needDiffs {
-		baseArgs = []string{
-			"log",
-			logDiffFormat,
-			"-z",
-			"--date=unix",
-			"--reverse",
-			"--no-show-signature",
-			"--numstat",
-		}
+		baseArgs = slices.Concat(
+			[]string{"log"},
+			diffLogArgs,
+			[]string{"--reverse"},
+		)
 	} else {
 		// Runs git log without --numstat, which is much faster.
 		baseArgs = []string{
@@ -278,17 +290,11 @@ func RunStdinLog(
 ) (*Subprocess, error) {
 	var baseArgs []string
 	if needDiffs {
-		baseArgs = []string{
-			"log",
-			logDiffFormat,
-			"-z",
-			"--date=unix",
-			"--reverse",
-			"--no-show-signature",
-			"--numstat",
-			"--stdin",
-			"--no-walk",
-		}
+		baseArgs = slices.Concat(
+			[]string{"log"},
+			diffLogArgs,
+			[]string{"--reverse", "--stdin", "--no-walk"},
+		)
 	} else {
 		// Runs git log without --numstat, which is much faster.
 		baseArgs = []string{
@@ -374,19 +380,42 @@ func RunRevList(
 	return subprocess, nil
 }
 
-func RunLsFiles(ctx context.Context, pathspecs []string) (*Subprocess, error) {
-	baseArgs := []string{"ls-files", "--exclude-standard"}
-
-	var args []string
-	if len(pathspecs) > 0 {
-		args = slices.Concat(baseArgs, pathspecs)
-	} else {
-		args = slices.Concat(baseArgs, []string{"--"}, pathspecs)
+// Runs git ls-tree, listing every file in the given tree-ish relative to the
+// root of the repository.
+func RunLsTree(ctx context.Context, treeish string) (*Subprocess, error) {
+	args := []string{
+		"ls-tree",
+		"-r",
+		"-z",
+		"--full-tree",
+		"--name-only",
+		treeish,
+		"--",
 	}
 
 	subprocess, err := run(ctx, args, false)
 	if err != nil {
-		return nil, fmt.Errorf("failed to run git ls-files: %w", err)
+		return nil, fmt.Errorf("failed to run git ls-tree: %w", err)
+	}
+
+	return subprocess, nil
+}
+
+// Runs git check-attr, reading NULL-terminated paths from stdin. If source is
+// not empty, attributes are read from that revision instead of the working tree.
+func RunCheckAttr(
+	ctx context.Context,
+	attrs []string,
+	source string,
+) (*Subprocess, error) {
+	baseArgs := []string{"check-attr", "-z", "--stdin"}
+	if source != "" {
+		baseArgs = append(baseArgs, "--source="+source)
+	}
+
+	subprocess, err := run(ctx, slices.Concat(baseArgs, attrs), true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run git check-attr: %w", err)
 	}
 
 	return subprocess, nil
@@ -8,9 +8,11 @@ package git
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"iter"
+	"slices"
 	"strings"
 	"time"
 )
@@ -18,10 +20,12 @@ import (
 type Commit struct {
 	Hash        string
 	ShortHash   string
+	Parents     []string // Full hashes
 	IsMerge     bool
 	AuthorName  string
 	AuthorEmail string
-	Date        time.Time
+	Date        time.Time // Author date
+	CommitDate  time.Time
 	FileDiffs   []FileDiff
 }
 
@@ -126,21 +130,48 @@ func RevList(
 	return revs, nil
 }
 
-func GetRoot() (_ string, err error) {
+// Returns the root of the working tree, or the git directory if the repository
+// is bare.
+func GetRoot() (string, error) {
+	bare, err := IsBare()
+	if err != nil {
+		return "", err
+	}
+
+	if bare {
+		return revParseValue("--absolute-git-dir")
+	}
+
+	return revParseValue("--show-toplevel")
+}
+
+func IsBare() (bool, error) {
+	bare, err := revParseValue("--is-bare-repository")
+	if err != nil {
+		return false, err
+	}
+
+	return bare == "true", nil
+}
+
+// Returns the path of the working directory relative to the root of the
+// repository, with a trailing slash. Empty at the root and in bare
+// repositories.
+func GetPrefix() (string, error) {
+	return revParseValue("--show-prefix")
+}
+
+func revParseValue(arg string) (_ string, err error) {
 	defer func() {
 		if err != nil {
-			err = fmt.Errorf(
-				"failed to run git rev-parse --show-toplevel: %w",
-				err,
-			)
+			err = fmt.Errorf("failed to run git rev-parse %s: %w", arg, err)
 		}
 	}()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	args := []string{"rev-parse", "--show-toplevel"}
-	subprocess, err := run(ctx, args, false)
+	subprocess, err := run(ctx, []string{"rev-parse", arg}, false)
 	if err != nil {
 		return "", err
 	}
@@ -155,42 +186,158 @@ func GetRoot() (_ string, err error) {
 		return "", err
 	}
 
-	root := strings.TrimSpace(string(b))
-	return root, nil
+	return strings.TrimSpace(string(b)), nil
 }
 
-// Returns all paths in the working tree under the given pathspecs.
-func WorkingTreeFiles(pathspecs []string) (_ map[string]bool, err error) {
+// Returns the value of the given git config key, or an empty string if it is
+// not set. Works outside of a repository too, using the global config.
+func GetConfig(key string) (string, error) {
+	return getConfig(key, "--get", key)
+}
+
+// Like GetConfig(), but expands a leading "~/" in the value as git does for
+// config values that are paths.
+func GetConfigPath(key string) (string, error) {
+	return getConfig(key, "--get", "--path", key)
+}
+
+func getConfig(key string, args ...string) (_ string, err error) {
 	defer func() {
 		if err != nil {
-			err = fmt.Errorf("error getting tree files: %w", err)
+			err = fmt.Errorf("failed to run git config %s: %w", key, err)
 		}
 	}()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	wtreeset := map[string]bool{}
+	subprocess, err := run(ctx, slices.Concat([]string{"config"}, args), false)
+	if err != nil {
+		return "", err
+	}
 
-	subprocess, err := RunLsFiles(ctx, pathspecs)
+	b, err := io.ReadAll(subprocess.stdout)
 	if err != nil {
-		return wtreeset, err
+		return "", err
 	}
 
-	lines := subprocess.StdoutLines()
-	for line, err := range lines {
+	err = subprocess.Wait()
+	var subprocessErr SubprocessErr
+	if errors.As(err, &subprocessErr) && subprocessErr.ExitCode == 1 {
+		return "", nil // Key is not set
+	} else if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(b)), nil
+}
+
+// Returns the object name that rev resolves to, or an empty string if it does
+// not name an object.
+func ResolveRev(rev string) (_ string, err error) {
+	defer func() {
 		if err != nil {
-			return wtreeset, err
+			err = fmt.Errorf("failed to resolve %s: %w", rev, err)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	subprocess, err := run(
+		ctx,
+		[]string{"rev-parse", "--verify", "--quiet", rev},
+		false,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	b, err := io.ReadAll(subprocess.stdout)
+	if err != nil {
+		return "", err
+	}
+
+	err = subprocess.Wait()
+	var subprocessErr SubprocessErr
+	if errors.As(err, &subprocessErr) && subprocessErr.ExitCode == 1 {
+		return "", nil // Does not resolve
+	} else if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(b)), nil
+}
+
+// Whether ancestor is an ancestor of rev, or the same commit.
+func IsAncestor(ctx context.Context, ancestor string, rev string) (_ bool, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf(
+				"failed to check whether %s is an ancestor of %s: %w",
+				ancestor,
+				rev,
+				err,
+			)
+		}
+	}()
+
+	subprocess, err := run(
+		ctx,
+		[]string{"merge-base", "--is-ancestor", ancestor, rev},
+		false,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	err = subprocess.Wait()
+	var subprocessErr SubprocessErr
+	if errors.As(err, &subprocessErr) && subprocessErr.ExitCode == 1 {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Returns all paths in the given tree-ish, relative to the root of the
+// repository.
+func TreeFiles(treeish string) (_ map[string]bool, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("error getting files in %s: %w", treeish, err)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	treeset := map[string]bool{}
+
+	subprocess, err := RunLsTree(ctx, treeish)
+	if err != nil {
+		return treeset, err
+	}
+
+	b, err := io.ReadAll(subprocess.stdout)
+	if err != nil {
+		return treeset, err
+	}
+
+	for _, path := range strings.Split(string(b), "\x00") {
+		if path != "" {
+			treeset[path] = true
 		}
-		wtreeset[strings.TrimSpace(line)] = true
 	}
 
 	err = subprocess.Wait()
 	if err != nil {
-		return wtreeset, err
+		return treeset, err
 	}
 
-	return wtreeset, nil
+	return treeset, nil
 }
 
 // Returns all commits in the input iterator, but for each commit, strips out
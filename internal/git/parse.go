@@ -54,13 +54,20 @@ func allowCommit(commit Commit, now time.Time) bool {
 	return true
 }
 
-// Turns an iterator over lines from git log into an iterator of commits
+// Number of lines before the file diffs of each commit in git log output
+const headerLineCount = 7
+
+// Turns an iterator over lines from git log into an iterator of commits.
+//
+// Also reads logs saved by older versions of git-author, which don't have the
+// commit date line. Their commits are parsed with a zero CommitDate.
 func ParseCommits(lines iter.Seq2[string, error]) iter.Seq2[Commit, error] {
 	return func(yield func(Commit, error) bool) {
 		var commit Commit
 		var diff *FileDiff
 		now := time.Now()
 		linesThisCommit := 0
+		headerLines := headerLineCount
 
 		for line, err := range lines {
 			if err != nil {
@@ -75,7 +82,14 @@ func ParseCommits(lines iter.Seq2[string, error]) iter.Seq2[Commit, error] {
 				return
 			}
 
-			done := linesThisCommit >= 6 && (len(line) == 0 || isRev(line))
+			if linesThisCommit == headerLineCount-1 && !isTimestamp(line) {
+				// Saved by an older version, so this is a diff or the end of
+				// the commit rather than the commit date
+				headerLines = headerLineCount - 1
+			}
+
+			done := linesThisCommit >= headerLines &&
+				(len(line) == 0 || isRev(line))
 			if done {
 				if allowCommit(commit, now) {
 					if !yield(commit, nil) {
@@ -86,6 +100,7 @@ func ParseCommits(lines iter.Seq2[string, error]) iter.Seq2[Commit, error] {
 				commit = Commit{}
 				diff = nil
 				linesThisCommit = 0
+				headerLines = headerLineCount
 
 				if len(line) == 0 {
 					continue
@@ -98,13 +113,14 @@ func ParseCommits(lines iter.Seq2[string, error]) iter.Seq2[Commit, error] {
 			case linesThisCommit == 1:
 				commit.ShortHash = line
 			case linesThisCommit == 2:
-				parts := strings.Split(line, " ")
-				commit.IsMerge = len(parts) > 1
+				commit.Parents = strings.Fields(line)
+				commit.IsMerge = len(commit.Parents) > 1
 			case linesThisCommit == 3:
 				commit.AuthorName = line
 			case linesThisCommit == 4:
 				commit.AuthorEmail = line
-			case linesThisCommit == 5:
+			case linesThisCommit == 5 ||
+				(linesThisCommit == 6 && headerLines == headerLineCount):
 				i, err := strconv.Atoi(line)
 				if err != nil {
 					yield(
@@ -118,7 +134,11 @@ func ParseCommits(lines iter.Seq2[string, error]) iter.Seq2[Commit, error] {
 					return
 				}
 
-				commit.Date = time.Unix(int64(i), 0)
+				if linesThisCommit == 5 {
+					commit.Date = time.Unix(int64(i), 0)
+				} else {
+					commit.CommitDate = time.Unix(int64(i), 0)
+				}
 			default:
 				// Handle file diffs
 				var err error
@@ -219,6 +239,12 @@ func ParseCommits(lines iter.Seq2[string, error]) iter.Seq2[Commit, error] {
 	}
 }
 
+// Returns true if this is a date as a Unix timestamp.
+func isTimestamp(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
 // Returns true if this is a (full-length) Git revision hash, false otherwise.
 //
 // We also need to handle a hash with "^" in front.
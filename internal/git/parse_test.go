@@ -0,0 +1,170 @@
+package git_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/trinhminhtriet/git-author/internal/git"
+	"github.com/trinhminhtriet/git-author/internal/utils/iterutils"
+)
+
+func TestParseCommits(t *testing.T) {
+	lines := []string{
+		"9e9ea7662b1001d860471a4cece5e2f1de8062fb",
+		"9e9ea76",
+		"",
+		"Alice",
+		"alice@mail.com",
+		"1700000000",
+		"1700000100",
+		"3\t1\tfoo.txt",
+		"",
+		"2bdd9e23b5c8bdf5b6f7ed8b2b4b2c0cf7b7a3a1",
+		"2bdd9e2",
+		"9e9ea7662b1001d860471a4cece5e2f1de8062fb " +
+			"5c2f6a3a1e4b7d9c8a6f3e2d1c0b9a8f7e6d5c4b",
+		"Bob",
+		"bob@mail.com",
+		"1700000200",
+		"1700000300",
+		"",
+	}
+
+	seq := git.ParseCommits(iterutils.WithoutErrors(slices.Values(lines)))
+	commits, err := iterutils.Collect(seq)
+	if err != nil {
+		t.Fatalf("ParseCommits() returned error: %v", err)
+	}
+
+	expected := []git.Commit{
+		{
+			Hash:        "9e9ea7662b1001d860471a4cece5e2f1de8062fb",
+			ShortHash:   "9e9ea76",
+			Parents:     []string{},
+			AuthorName:  "Alice",
+			AuthorEmail: "alice@mail.com",
+			Date:        time.Unix(1700000000, 0),
+			CommitDate:  time.Unix(1700000100, 0),
+			FileDiffs: []git.FileDiff{
+				{Path: "foo.txt", LinesAdded: 3, LinesRemoved: 1},
+			},
+		},
+		{
+			Hash:      "2bdd9e23b5c8bdf5b6f7ed8b2b4b2c0cf7b7a3a1",
+			ShortHash: "2bdd9e2",
+			Parents: []string{
+				"9e9ea7662b1001d860471a4cece5e2f1de8062fb",
+				"5c2f6a3a1e4b7d9c8a6f3e2d1c0b9a8f7e6d5c4b",
+			},
+			IsMerge:     true,
+			AuthorName:  "Bob",
+			AuthorEmail: "bob@mail.com",
+			Date:        time.Unix(1700000200, 0),
+			CommitDate:  time.Unix(1700000300, 0),
+		},
+	}
+
+	if diff := cmp.Diff(expected, commits); diff != "" {
+		t.Errorf("commits are wrong:\n%s", diff)
+	}
+}
+
+// Output of "dump" from before commit dates were logged, which has one line
+// less for each commit.
+func TestParseCommitsWithoutCommitDates(t *testing.T) {
+	lines := []string{
+		"124442694912991617cbeef9b4a83f6303f248b3",
+		"1244426",
+		"",
+		"Alice",
+		"alice@mail.com",
+		"1700000000",
+		"3\t0\tfoo.txt",
+		"",
+		"e4383ae9fe862d8e2af152a0137e3ce8e9ef757e",
+		"e4383ae",
+		"1244426",
+		"Bob",
+		"bob@mail.com",
+		"1700000200",
+		"0\t0\t",
+		"foo.txt",
+		"dir/foo.txt",
+		"",
+		"8ca0b0acc32ffede1cb097650c42ac24c8127b0d",
+		"8ca0b0a",
+		"e4383ae",
+		"Bob",
+		"bob@mail.com",
+		"1700000400",
+		"b7064b3615e99616467bc9e04912be81b2c39cae",
+		"b7064b3",
+		"8ca0b0a",
+		"Alice",
+		"alice@mail.com",
+		"1700000500",
+		"1\t0\tbar.txt",
+		"-\t-\tbin.dat",
+		"1\t0\tdir/foo.txt",
+		"",
+	}
+
+	seq := git.ParseCommits(iterutils.WithoutErrors(slices.Values(lines)))
+	commits, err := iterutils.Collect(seq)
+	if err != nil {
+		t.Fatalf("ParseCommits() returned error: %v", err)
+	}
+
+	expected := []git.Commit{
+		{
+			Hash:        "124442694912991617cbeef9b4a83f6303f248b3",
+			ShortHash:   "1244426",
+			Parents:     []string{},
+			AuthorName:  "Alice",
+			AuthorEmail: "alice@mail.com",
+			Date:        time.Unix(1700000000, 0),
+			FileDiffs: []git.FileDiff{
+				{Path: "foo.txt", LinesAdded: 3},
+			},
+		},
+		{
+			Hash:        "e4383ae9fe862d8e2af152a0137e3ce8e9ef757e",
+			ShortHash:   "e4383ae",
+			Parents:     []string{"1244426"},
+			AuthorName:  "Bob",
+			AuthorEmail: "bob@mail.com",
+			Date:        time.Unix(1700000200, 0),
+			FileDiffs: []git.FileDiff{
+				{Path: "dir/foo.txt"},
+			},
+		},
+		{
+			Hash:        "8ca0b0acc32ffede1cb097650c42ac24c8127b0d",
+			ShortHash:   "8ca0b0a",
+			Parents:     []string{"e4383ae"},
+			AuthorName:  "Bob",
+			AuthorEmail: "bob@mail.com",
+			Date:        time.Unix(1700000400, 0),
+		},
+		{
+			Hash:        "b7064b3615e99616467bc9e04912be81b2c39cae",
+			ShortHash:   "b7064b3",
+			Parents:     []string{"8ca0b0a"},
+			AuthorName:  "Alice",
+			AuthorEmail: "alice@mail.com",
+			Date:        time.Unix(1700000500, 0),
+			FileDiffs: []git.FileDiff{
+				{Path: "bar.txt", LinesAdded: 1},
+				{Path: "bin.dat"},
+				{Path: "dir/foo.txt", LinesAdded: 1},
+			},
+		},
+	}
+
+	if diff := cmp.Diff(expected, commits); diff != "" {
+		t.Errorf("commits are wrong:\n%s", diff)
+	}
+}
@@ -8,5 +8,12 @@ const Red string = "\x1b[31m"
 const DefaultColor string = "\x1b[39m"
 
 const Dim string = "\x1b[2m"
+const Reverse string = "\x1b[7m"
 
 const EraseLine string = "\x1b[2K"
+const EraseScreen string = "\x1b[2J"
+const CursorHome string = "\x1b[H"
+const HideCursor string = "\x1b[?25l"
+const ShowCursor string = "\x1b[?25h"
+const EnterAltScreen string = "\x1b[?1049h"
+const ExitAltScreen string = "\x1b[?1049l"
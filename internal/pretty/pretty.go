@@ -2,6 +2,7 @@ package pretty
 
 import (
 	"os"
+	"strconv"
 
 	"golang.org/x/term"
 )
@@ -10,3 +11,19 @@ import (
 func AllowDynamic(f *os.File) bool {
 	return term.IsTerminal(int(f.Fd()))
 }
+
+// Returns the number of columns output written to f should fit in, or 0 if
+// there is no limit. COLUMNS takes precedence over the size of the terminal.
+func TerminalWidth(f *os.File) int {
+	columns, err := strconv.Atoi(os.Getenv("COLUMNS"))
+	if err == nil && columns > 0 {
+		return columns
+	}
+
+	width, _, err := term.GetSize(int(f.Fd()))
+	if err != nil {
+		return 0
+	}
+
+	return width
+}
@@ -0,0 +1,172 @@
+package pretty
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Characters used to draw tables, trees and charts.
+type Glyphs struct {
+	Horizontal  string
+	Vertical    string
+	TopLeft     string
+	TopRight    string
+	BottomLeft  string
+	BottomRight string
+	LeftTee     string
+	RightTee    string
+	Axis        string // Left edge of a bar chart
+	TreeBranch  string // Prefix of a child with siblings after it
+	TreeLast    string // Prefix of the last child
+	TreePipe    string // Indent under a child with siblings after it
+	Arrow       string
+	Expanded    string
+	Collapsed   string
+}
+
+var UnicodeGlyphs = Glyphs{
+	Horizontal:  "─",
+	Vertical:    "│",
+	TopLeft:     "┌",
+	TopRight:    "┐",
+	BottomLeft:  "└",
+	BottomRight: "┘",
+	LeftTee:     "├",
+	RightTee:    "┤",
+	Axis:        "┤",
+	TreeBranch:  "├── ",
+	TreeLast:    "└── ",
+	TreePipe:    "│   ",
+	Arrow:       "→",
+	Expanded:    "▾",
+	Collapsed:   "▸",
+}
+
+var ASCIIGlyphs = Glyphs{
+	Horizontal:  "-",
+	Vertical:    "|",
+	TopLeft:     "+",
+	TopRight:    "+",
+	BottomLeft:  "+",
+	BottomRight: "+",
+	LeftTee:     "+",
+	RightTee:    "+",
+	Axis:        "|",
+	TreeBranch:  "|-- ",
+	TreeLast:    "`-- ",
+	TreePipe:    "|   ",
+	Arrow:       "->",
+	Expanded:    "v",
+	Collapsed:   ">",
+}
+
+// Writes text output, adding colors only if they are enabled and drawing with
+// the configured glyphs.
+//
+// Output is buffered until Flush() is called.
+type Renderer struct {
+	Glyphs Glyphs
+	Width  int // Columns to fit output in, or 0 if there is no limit
+	w      *bufio.Writer
+	color  bool
+	ascii  bool
+}
+
+func NewRenderer(w io.Writer, color bool, ascii bool, width int) *Renderer {
+	glyphs := UnicodeGlyphs
+	if ascii {
+		glyphs = ASCIIGlyphs
+	}
+
+	return &Renderer{
+		Glyphs: glyphs,
+		Width:  width,
+		w:      bufio.NewWriter(w),
+		color:  color,
+		ascii:  ascii,
+	}
+}
+
+func (r *Renderer) ASCII() bool {
+	return r.ascii
+}
+
+func (r *Renderer) Printf(format string, a ...any) {
+	fmt.Fprintf(r.w, format, a...)
+}
+
+func (r *Renderer) Flush() error {
+	err := r.w.Flush()
+	if err != nil {
+		return fmt.Errorf("error writing to stdout: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Renderer) Dim(s string) string {
+	return r.style(Dim, s, Reset)
+}
+
+// Unlike Dim(), leaves the rest of the style in place after s, so colored text
+// can be nested in dimmed text.
+func (r *Renderer) Green(s string) string {
+	return r.style(Green, s, DefaultColor)
+}
+
+func (r *Renderer) Red(s string) string {
+	return r.style(Red, s, DefaultColor)
+}
+
+func (r *Renderer) style(start string, s string, end string) string {
+	if !r.color {
+		return s
+	}
+
+	return start + s + end
+}
+
+// Decides whether to color output written to f.
+//
+// mode is one of "auto", "always" or "never", and colorUI is git's "color.ui"
+// setting, empty if unset. In "auto" mode, we follow color.ui, then NO_COLOR,
+// and otherwise color output only if f is a terminal that isn't dumb.
+func UseColor(mode string, colorUI string, f *os.File) bool {
+	return useColor(
+		mode,
+		colorUI,
+		os.Getenv("NO_COLOR") != "",
+		os.Getenv("TERM") == "dumb",
+		AllowDynamic(f),
+	)
+}
+
+func useColor(
+	mode string,
+	colorUI string,
+	noColor bool,
+	dumbTerm bool,
+	isTerminal bool,
+) bool {
+	switch mode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+
+	switch colorUI {
+	case "always":
+		return true
+	case "never", "false":
+		return false
+	}
+
+	if noColor || dumbTerm {
+		return false
+	}
+
+	return isTerminal
+}
@@ -0,0 +1,109 @@
+package pretty
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUseColor(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		colorUI    string
+		noColor    bool
+		dumbTerm   bool
+		isTerminal bool
+		exp        bool
+	}{
+		{
+			name:       "auto_terminal",
+			mode:       "auto",
+			isTerminal: true,
+			exp:        true,
+		},
+		{
+			name: "auto_pipe",
+			mode: "auto",
+			exp:  false,
+		},
+		{
+			name:       "auto_no_color",
+			mode:       "auto",
+			noColor:    true,
+			isTerminal: true,
+			exp:        false,
+		},
+		{
+			name:       "auto_dumb_term",
+			mode:       "auto",
+			dumbTerm:   true,
+			isTerminal: true,
+			exp:        false,
+		},
+		{
+			name:       "color_ui_never",
+			mode:       "auto",
+			colorUI:    "false",
+			isTerminal: true,
+			exp:        false,
+		},
+		{
+			name:    "color_ui_always_beats_no_color",
+			mode:    "auto",
+			colorUI: "always",
+			noColor: true,
+			exp:     true,
+		},
+		{
+			name:       "color_ui_auto",
+			mode:       "auto",
+			colorUI:    "auto",
+			isTerminal: true,
+			exp:        true,
+		},
+		{
+			name:     "always",
+			mode:     "always",
+			colorUI:  "never",
+			noColor:  true,
+			dumbTerm: true,
+			exp:      true,
+		},
+		{
+			name:       "never",
+			mode:       "never",
+			colorUI:    "always",
+			isTerminal: true,
+			exp:        false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := useColor(
+				test.mode,
+				test.colorUI,
+				test.noColor,
+				test.dumbTerm,
+				test.isTerminal,
+			)
+			if got != test.exp {
+				t.Errorf("expected %v but got %v", test.exp, got)
+			}
+		})
+	}
+}
+
+func TestRendererWithoutColor(t *testing.T) {
+	var b strings.Builder
+	r := NewRenderer(&b, false, true, 0)
+
+	r.Printf("%s%s%s", r.Glyphs.TreeLast, r.Dim("a"), r.Green("b"))
+	if err := r.Flush(); err != nil {
+		t.Fatalf("Flush() returned error: %v", err)
+	}
+
+	if b.String() != "`-- ab" {
+		t.Errorf("expected plain ASCII output but got %q", b.String())
+	}
+}
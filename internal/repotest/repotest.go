@@ -1,9 +1,18 @@
-// Helpers for running tests in the test submodule/repo.
+// Helpers for running tests in the test submodule/repo, or in a repo made for
+// the test.
 package repotest
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"maps"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
 )
 
 const msg = `error changing working directory to submodule: %w
@@ -17,3 +26,67 @@ func UseTestRepo() error {
 
 	return nil
 }
+
+// A commit made by NewRepo.
+type Commit struct {
+	Name  string
+	Email string
+	Date  time.Time
+	Files map[string]string // New contents of each path, or "" to delete it
+}
+
+// Creates a repository holding commits on its main branch in a temporary
+// directory, and changes into it for the rest of the test. Global and system
+// git config are ignored so they can't change what the tests see.
+func NewRepo(t *testing.T, commits []Commit) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(dir, ".git", "test-config"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	git := func(stdin io.Reader, args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Stdin = stdin
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+
+	git(nil, "init", "-q", "-b", "main")
+
+	var stream bytes.Buffer
+	for i, commit := range commits {
+		signature := fmt.Sprintf(
+			"%s <%s> %d +0000",
+			commit.Name,
+			commit.Email,
+			commit.Date.Unix(),
+		)
+		message := fmt.Sprintf("Commit %d", i+1)
+
+		fmt.Fprintln(&stream, "commit refs/heads/main")
+		fmt.Fprintln(&stream, "author", signature)
+		fmt.Fprintln(&stream, "committer", signature)
+		fmt.Fprintf(&stream, "data %d\n%s\n", len(message), message)
+
+		for _, path := range slices.Sorted(maps.Keys(commit.Files)) {
+			contents := commit.Files[path]
+			if contents == "" {
+				fmt.Fprintf(&stream, "D %s\n", path)
+			} else {
+				fmt.Fprintf(&stream, "M 100644 inline %s\n", path)
+				fmt.Fprintf(&stream, "data %d\n%s\n", len(contents), contents)
+			}
+		}
+
+		fmt.Fprintln(&stream)
+	}
+
+	git(&stream, "fast-import", "--quiet")
+	git(nil, "reset", "-q", "--hard", "main")
+
+	return dir
+}
@@ -14,15 +14,17 @@ import (
 type TimeBucket struct {
 	Name       string
 	Time       time.Time
+	End        time.Time  // Start of the next bucket
 	Tally      FinalTally // Winning author's tally
 	TotalTally FinalTally // Overall tally for all authors
 	tallies    map[string]Tally
 }
 
-func newBucket(name string, t time.Time) TimeBucket {
+func newBucket(name string, t time.Time, end time.Time) TimeBucket {
 	return TimeBucket{
 		Name:    name,
 		Time:    t,
+		End:     end,
 		tallies: map[string]Tally{},
 	}
 }
@@ -79,7 +81,10 @@ func (b TimeBucket) Rank(mode TallyMode) TimeBucket {
 	if len(b.tallies) > 0 {
 		b.Tally = Rank(b.tallies, mode)[0]
 
+		// Start from fresh sets so we don't add to any author's sets
 		var runningTally Tally
+		runningTally.commitset = map[string]bool{}
+		runningTally.fileset = map[string]bool{}
 		for _, tally := range b.tallies {
 			runningTally = runningTally.Combine(tally)
 		}
@@ -89,6 +94,12 @@ func (b TimeBucket) Rank(mode TallyMode) TimeBucket {
 	return b
 }
 
+// Returns the tally of every author with commits in the bucket, sorted
+// according to mode.
+func (b TimeBucket) Authors(mode TallyMode) []FinalTally {
+	return Rank(b.tallies, mode)
+}
+
 type TimeSeries []TimeBucket
 
 func (a TimeSeries) Combine(b TimeSeries) TimeSeries {
@@ -229,6 +240,7 @@ func TallyCommitsByDate(
 			bucket = newBucket(
 				resolution.label(bucketedCommitTime),
 				resolution.apply(bucketedCommitTime),
+				resolution.next(bucketedCommitTime),
 			)
 		}
 
@@ -247,6 +259,10 @@ func TallyCommitsByDate(
 
 			if !commit.IsMerge {
 				for _, diff := range commit.FileDiffs {
+					if !opts.countsPath(diff.Path) {
+						continue
+					}
+
 					tally.added += diff.LinesAdded
 					tally.removed += diff.LinesRemoved
 					tally.fileset[diff.Path] = true
@@ -265,7 +281,11 @@ func TallyCommitsByDate(
 	for t.Before(maxTime) || t.Equal(maxTime) {
 		bucket, ok := buckets[t.Unix()]
 		if !ok {
-			bucket = newBucket(resolution.label(t), resolution.apply(t))
+			bucket = newBucket(
+				resolution.label(t),
+				resolution.apply(t),
+				resolution.next(t),
+			)
 		}
 
 		bucketSlice = append(bucketSlice, bucket)
@@ -318,7 +338,11 @@ func Rebucket(
 	// Re-bucket using new resolution
 	t := resolution.apply(buckets[0].Time)
 	for t.Before(end) || t.Equal(end) {
-		bucket := newBucket(resolution.label(t), resolution.apply(t))
+		bucket := newBucket(
+			resolution.label(t),
+			resolution.apply(t),
+			resolution.next(t),
+		)
 		rebuckets = append(rebuckets, bucket)
 		t = resolution.next(t)
 	}
@@ -336,6 +360,7 @@ func Rebucket(
 		}
 
 		bucket.Time = rebucket.Time
+		bucket.End = rebucket.End
 		bucket.Name = rebucket.Name
 		rebuckets[i] = rebuckets[i].Combine(bucket)
 	}
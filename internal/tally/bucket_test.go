@@ -156,3 +156,73 @@ func TestTallyCommitsTimelineEmpty(t *testing.T) {
 		)
 	}
 }
+
+func TestTimeBucketAuthors(t *testing.T) {
+	bucket := TimeBucket{
+		Name: "2024-04-01",
+		Time: time.Date(2024, 4, 1, 0, 0, 0, 0, time.Local),
+		tallies: map[string]Tally{
+			"alice": {
+				name:      "alice",
+				commitset: map[string]bool{"a": true},
+			},
+			"bob": {
+				name:      "bob",
+				commitset: map[string]bool{"b": true, "c": true},
+			},
+		},
+	}
+
+	bucket = bucket.Rank(CommitMode)
+	if bucket.TotalTally.Commits != 3 {
+		t.Errorf("expected 3 commits in total but got %d", bucket.TotalTally.Commits)
+	}
+
+	authors := bucket.Authors(CommitMode)
+	if len(authors) != 2 {
+		t.Fatalf("expected 2 authors but got %d", len(authors))
+	}
+
+	if authors[0].AuthorName != "bob" || authors[0].Commits != 2 {
+		t.Errorf("expected bob with 2 commits first but got %v", authors[0])
+	}
+
+	// Ranking must not have added to either author's commits
+	if authors[1].AuthorName != "alice" || authors[1].Commits != 1 {
+		t.Errorf("expected alice with 1 commit second but got %v", authors[1])
+	}
+}
+
+func TestRebucketSetsEnd(t *testing.T) {
+	buckets := []TimeBucket{
+		newBucket(
+			"2024-04-01",
+			time.Date(2024, 4, 1, 0, 0, 0, 0, time.Local),
+			time.Date(2024, 4, 2, 0, 0, 0, 0, time.Local),
+		),
+		newBucket(
+			"2024-05-15",
+			time.Date(2024, 5, 15, 0, 0, 0, 0, time.Local),
+			time.Date(2024, 5, 16, 0, 0, 0, 0, time.Local),
+		),
+	}
+
+	end := time.Date(2024, 8, 1, 0, 0, 0, 0, time.Local)
+	rebuckets := Rebucket(buckets, CalcResolution(buckets[0].Time, end), end)
+
+	if len(rebuckets) != 5 {
+		t.Fatalf("expected 5 monthly buckets but got %d", len(rebuckets))
+	}
+
+	for i, bucket := range rebuckets {
+		expected := time.Date(2024, time.Month(5+i), 1, 0, 0, 0, 0, time.Local)
+		if !bucket.End.Equal(expected) {
+			t.Errorf(
+				"expected bucket %s to end at %v but got %v",
+				bucket.Name,
+				expected,
+				bucket.End,
+			)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package tally
+
+// A file tree annotated with the top author of each path in two different
+// revision ranges.
+type CompareNode struct {
+	Before     FinalTally // Top author in the first range
+	After      FinalTally // Top author in the second range
+	HasBefore  bool       // Path was edited in the first range
+	HasAfter   bool       // Path was edited in the second range
+	Children   map[string]*CompareNode
+	InWorkTree bool // In git working tree/directory
+}
+
+// Whether the top author of the path differs between the two ranges.
+//
+// Paths only edited in one of the two ranges have no previous (or next) owner
+// and so are not considered to have changed hands.
+func (n *CompareNode) OwnerChanged(key func(t FinalTally) string) bool {
+	return n.HasBefore && n.HasAfter && key(n.Before) != key(n.After)
+}
+
+/*
+* CompareTrees() merges two ranked trees into a single tree holding the top
+* author for each path in both. Either tree may be nil if no commits were found
+* in the corresponding range.
+ */
+func CompareTrees(before *TreeNode, after *TreeNode) *CompareNode {
+	node := &CompareNode{Children: map[string]*CompareNode{}}
+
+	if before != nil {
+		node.Before = before.Tally
+		node.HasBefore = len(before.tallies) > 0
+		node.InWorkTree = before.InWorkTree
+	}
+
+	if after != nil {
+		node.After = after.Tally
+		node.HasAfter = len(after.tallies) > 0
+		node.InWorkTree = node.InWorkTree || after.InWorkTree
+	}
+
+	if before != nil {
+		for p, child := range before.Children {
+			var afterChild *TreeNode
+			if after != nil {
+				afterChild = after.Children[p]
+			}
+
+			node.Children[p] = CompareTrees(child, afterChild)
+		}
+	}
+
+	if after != nil {
+		for p, child := range after.Children {
+			if _, ok := node.Children[p]; ok {
+				continue // Already merged above
+			}
+
+			node.Children[p] = CompareTrees(nil, child)
+		}
+	}
+
+	return node
+}
@@ -0,0 +1,163 @@
+package tally_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/trinhminhtriet/git-author/internal/git"
+	"github.com/trinhminhtriet/git-author/internal/tally"
+	"github.com/trinhminhtriet/git-author/internal/utils/iterutils"
+)
+
+func TestCompareTrees(t *testing.T) {
+	beforeCommits := []git.Commit{
+		git.Commit{
+			Hash:        "baa",
+			ShortHash:   "baa",
+			AuthorName:  "bob",
+			AuthorEmail: "bob@mail.com",
+			FileDiffs: []git.FileDiff{
+				git.FileDiff{
+					Path:         "foo/bim.txt",
+					LinesAdded:   4,
+					LinesRemoved: 0,
+				},
+				git.FileDiff{
+					Path:         "foo/bar.txt",
+					LinesAdded:   8,
+					LinesRemoved: 2,
+				},
+			},
+		},
+	}
+	afterCommits := []git.Commit{
+		git.Commit{
+			Hash:        "bab",
+			ShortHash:   "bab",
+			AuthorName:  "jim",
+			AuthorEmail: "jim@mail.com",
+			FileDiffs: []git.FileDiff{
+				git.FileDiff{
+					Path:         "foo/bim.txt",
+					LinesAdded:   3,
+					LinesRemoved: 1,
+				},
+				git.FileDiff{
+					Path:         "foo/new.txt",
+					LinesAdded:   1,
+					LinesRemoved: 0,
+				},
+			},
+		},
+	}
+
+	worktreeset := map[string]bool{
+		"foo/bim.txt": true,
+		"foo/bar.txt": true,
+		"foo/new.txt": true,
+	}
+	opts := tally.TallyOpts{
+		Mode: tally.CommitMode,
+		Key:  func(c git.Commit) string { return c.AuthorEmail },
+	}
+
+	before, err := tally.TallyCommitsTree(
+		iterutils.WithoutErrors(slices.Values(beforeCommits)),
+		opts,
+		worktreeset,
+		"",
+	)
+	if err != nil {
+		t.Fatalf("TallyCommitsTree() returned error: %v", err)
+	}
+
+	after, err := tally.TallyCommitsTree(
+		iterutils.WithoutErrors(slices.Values(afterCommits)),
+		opts,
+		worktreeset,
+		"",
+	)
+	if err != nil {
+		t.Fatalf("TallyCommitsTree() returned error: %v", err)
+	}
+
+	root := tally.CompareTrees(before.Rank(opts.Mode), after.Rank(opts.Mode))
+	key := func(t tally.FinalTally) string { return t.AuthorEmail }
+
+	fooNode, ok := root.Children["foo"]
+	if !ok {
+		t.Fatalf("root node has no \"foo\" child")
+	}
+
+	if len(fooNode.Children) != 3 {
+		t.Fatalf(
+			"expected \"foo\" to have 3 children but found %d",
+			len(fooNode.Children),
+		)
+	}
+
+	bimNode := fooNode.Children["bim.txt"]
+	if !bimNode.OwnerChanged(key) {
+		t.Errorf("expected owner of \"bim.txt\" to have changed")
+	}
+
+	barNode := fooNode.Children["bar.txt"]
+	if !barNode.HasBefore || barNode.HasAfter {
+		t.Errorf("expected \"bar.txt\" to only be edited in first range")
+	}
+	if barNode.OwnerChanged(key) {
+		t.Errorf("did not expect owner of \"bar.txt\" to have changed")
+	}
+
+	newNode := fooNode.Children["new.txt"]
+	if newNode.HasBefore || !newNode.HasAfter {
+		t.Errorf("expected \"new.txt\" to only be edited in second range")
+	}
+	if newNode.After.AuthorName != "jim" {
+		t.Errorf(
+			"expected \"new.txt\" to be owned by jim but got %s",
+			newNode.After.AuthorName,
+		)
+	}
+}
+
+func TestCompareTreesOneSideEmpty(t *testing.T) {
+	commits := []git.Commit{
+		git.Commit{
+			Hash:        "baa",
+			ShortHash:   "baa",
+			AuthorName:  "bob",
+			AuthorEmail: "bob@mail.com",
+			FileDiffs: []git.FileDiff{
+				git.FileDiff{
+					Path:         "bim.txt",
+					LinesAdded:   4,
+					LinesRemoved: 0,
+				},
+			},
+		},
+	}
+	opts := tally.TallyOpts{
+		Mode: tally.CommitMode,
+		Key:  func(c git.Commit) string { return c.AuthorEmail },
+	}
+
+	after, err := tally.TallyCommitsTree(
+		iterutils.WithoutErrors(slices.Values(commits)),
+		opts,
+		map[string]bool{"bim.txt": true},
+		"",
+	)
+	if err != nil {
+		t.Fatalf("TallyCommitsTree() returned error: %v", err)
+	}
+
+	root := tally.CompareTrees(nil, after.Rank(opts.Mode))
+	if root.HasBefore || !root.HasAfter {
+		t.Errorf("expected root to only have tally for second range")
+	}
+
+	if _, ok := root.Children["bim.txt"]; !ok {
+		t.Errorf("root node has no \"bim.txt\" child")
+	}
+}
@@ -0,0 +1,134 @@
+package tally
+
+import (
+	"bytes"
+	"encoding/gob"
+	"maps"
+	"slices"
+	"time"
+)
+
+// Tallies are saved to the cache between runs, so they implement
+// gob.GobEncoder and gob.GobDecoder despite their unexported fields.
+
+type tallyGob struct {
+	Name            string
+	Email           string
+	HasCommitset    bool // Distinguishes an empty set from a nil one
+	Commits         []string
+	Added           int
+	Removed         int
+	HasFileset      bool
+	Files           []string
+	FirstCommitTime time.Time
+	LastCommitTime  time.Time
+	NumTallied      int
+}
+
+func (t Tally) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(tallyGob{
+		Name:            t.name,
+		Email:           t.email,
+		HasCommitset:    t.commitset != nil,
+		Commits:         slices.Collect(maps.Keys(t.commitset)),
+		Added:           t.added,
+		Removed:         t.removed,
+		HasFileset:      t.fileset != nil,
+		Files:           slices.Collect(maps.Keys(t.fileset)),
+		FirstCommitTime: t.firstCommitTime,
+		LastCommitTime:  t.lastCommitTime,
+		NumTallied:      t.numTallied,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (t *Tally) GobDecode(data []byte) error {
+	var g tallyGob
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&g)
+	if err != nil {
+		return err
+	}
+
+	*t = Tally{
+		name:            g.Name,
+		email:           g.Email,
+		added:           g.Added,
+		removed:         g.Removed,
+		firstCommitTime: g.FirstCommitTime,
+		lastCommitTime:  g.LastCommitTime,
+		numTallied:      g.NumTallied,
+	}
+
+	if g.HasCommitset {
+		t.commitset = toSet(g.Commits)
+	}
+
+	if g.HasFileset {
+		t.fileset = toSet(g.Files)
+	}
+
+	return nil
+}
+
+func toSet(keys []string) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		set[k] = true
+	}
+
+	return set
+}
+
+type timeBucketGob struct {
+	Name       string
+	Time       time.Time
+	End        time.Time
+	Tally      FinalTally
+	TotalTally FinalTally
+	Tallies    map[string]Tally
+}
+
+func (b TimeBucket) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(timeBucketGob{
+		Name:       b.Name,
+		Time:       b.Time,
+		End:        b.End,
+		Tally:      b.Tally,
+		TotalTally: b.TotalTally,
+		Tallies:    b.tallies,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (b *TimeBucket) GobDecode(data []byte) error {
+	var g timeBucketGob
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&g)
+	if err != nil {
+		return err
+	}
+
+	*b = TimeBucket{
+		Name:       g.Name,
+		Time:       g.Time,
+		End:        g.End,
+		Tally:      g.Tally,
+		TotalTally: g.TotalTally,
+		tallies:    g.Tallies,
+	}
+
+	if b.tallies == nil {
+		b.tallies = map[string]Tally{}
+	}
+
+	return nil
+}
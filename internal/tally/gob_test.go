@@ -0,0 +1,80 @@
+package tally
+
+import (
+	"bytes"
+	"encoding/gob"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/trinhminhtriet/git-author/internal/git"
+	"github.com/trinhminhtriet/git-author/internal/utils/iterutils"
+)
+
+func roundTrip[T any](t *testing.T, v T) T {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	if err != nil {
+		t.Fatalf("encoding failed with error: %v", err)
+	}
+
+	var decoded T
+	err = gob.NewDecoder(&buf).Decode(&decoded)
+	if err != nil {
+		t.Fatalf("decoding failed with error: %v", err)
+	}
+
+	return decoded
+}
+
+func TestGobRoundTrip(t *testing.T) {
+	commits := []git.Commit{
+		{
+			Hash:       "baa",
+			ShortHash:  "baa",
+			AuthorName: "bob",
+			Date:       time.Date(2025, 1, 30, 16, 35, 26, 0, time.UTC),
+			FileDiffs: []git.FileDiff{
+				{Path: "bim.txt", LinesAdded: 4},
+				{Path: "vim.txt", LinesAdded: 8, LinesRemoved: 2},
+			},
+		},
+		{
+			Hash:       "bab",
+			ShortHash:  "bab",
+			AuthorName: "jim",
+			Date:       time.Date(2025, 2, 3, 10, 0, 0, 0, time.UTC),
+		},
+	}
+	opts := TallyOpts{
+		Mode: LinesMode,
+		Key:  func(c git.Commit) string { return c.AuthorName },
+	}
+	allowUnexported := cmp.AllowUnexported(Tally{}, TimeBucket{})
+
+	byPath, err := TallyCommitsByPath(
+		iterutils.WithoutErrors(slices.Values(commits)),
+		opts,
+	)
+	if err != nil {
+		t.Fatalf("TallyCommitsByPath() returned error: %v", err)
+	}
+
+	if diff := cmp.Diff(byPath, roundTrip(t, byPath), allowUnexported); diff != "" {
+		t.Errorf("decoded tallies by path are wrong:\n%s", diff)
+	}
+
+	series, err := TallyCommitsByDate(
+		iterutils.WithoutErrors(slices.Values(commits)),
+		opts,
+	)
+	if err != nil {
+		t.Fatalf("TallyCommitsByDate() returned error: %v", err)
+	}
+
+	if diff := cmp.Diff(series, roundTrip(t, series), allowUnexported); diff != "" {
+		t.Errorf("decoded time series is wrong:\n%s", diff)
+	}
+}
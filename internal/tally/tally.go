@@ -28,6 +28,20 @@ type TallyOpts struct {
 	Mode        TallyMode
 	Key         func(c git.Commit) string // Unique ID for author
 	CountMerges bool
+
+	// Names what Key returns, e.g. "name" or "email". Tallies saved to the
+	// cache are only reused by runs with the same KeyName, and are never saved
+	// if it is empty.
+	KeyName string
+
+	// Paths for which this returns true still count toward commits, but not
+	// toward lines or files. May be nil.
+	ExcludePath func(path string) bool
+}
+
+// Whether edits to the path count toward the line and file metrics
+func (opts TallyOpts) countsPath(path string) bool {
+	return opts.ExcludePath == nil || !opts.ExcludePath(path)
 }
 
 // Whether we need --stat and --summary data from git log for this tally mode
@@ -338,7 +352,7 @@ func TallyCommitsByPath(
 					commit.Date,
 				)
 
-				if !commit.IsMerge {
+				if !commit.IsMerge && opts.countsPath(diff.Path) {
 					// Only non-merge commits contribute to files / lines
 					tally.numTallied = 1
 					tally.added += diff.LinesAdded
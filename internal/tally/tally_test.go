@@ -94,3 +94,71 @@ func TestTallyCommits(t *testing.T) {
 		t.Errorf("jim's tally is wrong:\n%s", diff)
 	}
 }
+
+func TestTallyCommitsExcludePath(t *testing.T) {
+	commits := []git.Commit{
+		git.Commit{
+			Hash:        "baa",
+			ShortHash:   "baa",
+			AuthorName:  "bob",
+			AuthorEmail: "bob@mail.com",
+			FileDiffs: []git.FileDiff{
+				git.FileDiff{
+					Path:         "bim.txt",
+					LinesAdded:   4,
+					LinesRemoved: 0,
+				},
+				git.FileDiff{
+					Path:         "package-lock.json",
+					LinesAdded:   800,
+					LinesRemoved: 200,
+				},
+			},
+		},
+		git.Commit{
+			Hash:        "bab",
+			ShortHash:   "bab",
+			AuthorName:  "bob",
+			AuthorEmail: "bob@mail.com",
+			FileDiffs: []git.FileDiff{
+				git.FileDiff{
+					Path:         "package-lock.json",
+					LinesAdded:   10,
+					LinesRemoved: 10,
+				},
+			},
+		},
+	}
+
+	seq := iterutils.WithoutErrors(slices.Values(commits))
+	opts := tally.TallyOpts{
+		Mode: tally.LinesMode,
+		Key: func(c git.Commit) string {
+			return c.AuthorEmail
+		},
+		ExcludePath: func(path string) bool {
+			return path == "package-lock.json"
+		},
+	}
+	tallies, err := tally.TallyCommits(seq, opts)
+	if err != nil {
+		t.Fatalf("TallyCommits() returned error: %v", err)
+	}
+
+	rankedTallies := tally.Rank(tallies, opts.Mode)
+	if len(rankedTallies) != 1 {
+		t.Fatalf("expected one tally but got %d", len(rankedTallies))
+	}
+
+	expected := tally.FinalTally{
+		AuthorName:   "bob",
+		AuthorEmail:  "bob@mail.com",
+		Commits:      2,
+		LinesAdded:   4,
+		LinesRemoved: 0,
+		FileCount:    1,
+	}
+	if diff := cmp.Diff(expected, rankedTallies[0]); diff != "" {
+		t.Errorf("bob's tally is wrong:\n%s", diff)
+	}
+}
@@ -91,15 +91,105 @@ func (t *TreeNode) Rank(mode TallyMode) *TreeNode {
 	return t
 }
 
+// Picks the best tally for each node according to a new mode.
+//
+// Unlike Rank(), this does not sum up metrics again, so it can only be called
+// on a tree that has already been ranked.
+func (t *TreeNode) Rerank(mode TallyMode) *TreeNode {
+	for _, child := range t.Children {
+		child.Rerank(mode)
+	}
+
+	t.Tally = Rank(t.tallies, mode)[0]
+	return t
+}
+
+// Returns the tally of every author who edited the node (or its children,
+// once ranked), sorted according to mode.
+func (t *TreeNode) Authors(mode TallyMode) []FinalTally {
+	return Rank(t.tallies, mode)
+}
+
+// Number of distinct authors who edited the node.
+func (t *TreeNode) Contributors() int {
+	return len(t.tallies)
+}
+
+// Number of distinct commits by any author editing the node.
+func (t *TreeNode) TotalCommits() int {
+	commits := map[string]bool{}
+	numTallied := 0
+	for _, tally := range t.tallies {
+		for commit := range tally.commitset {
+			commits[commit] = true
+		}
+		numTallied += tally.numTallied
+	}
+
+	if len(commits) == 0 {
+		return numTallied // Not using commitset
+	}
+
+	return len(commits)
+}
+
+// Fraction of the metric for the mode contributed by the top author. Only
+// defined for modes that count something.
+func (t *TreeNode) Share(mode TallyMode) (float64, bool) {
+	if mode == LastModifiedMode || mode == FirstModifiedMode {
+		return 0, false
+	}
+
+	var total int64
+	for _, tally := range t.tallies {
+		total += tally.Final().SortKey(mode)
+	}
+
+	if total == 0 {
+		return 0, false
+	}
+
+	return float64(t.Tally.SortKey(mode)) / float64(total), true
+}
+
+// Smallest number of authors who together account for at least half of the
+// metric for the mode at the node. Time-based modes fall back to commits.
+func (t *TreeNode) BusFactor(mode TallyMode) int {
+	if mode == LastModifiedMode || mode == FirstModifiedMode {
+		mode = CommitMode
+	}
+
+	authors := t.Authors(mode)
+
+	var total int64
+	for _, author := range authors {
+		total += author.SortKey(mode)
+	}
+
+	var running int64
+	for i, author := range authors {
+		running += author.SortKey(mode)
+		if 2*running >= total {
+			return i + 1
+		}
+	}
+
+	return len(authors)
+}
+
 /*
-* TallyCommitsTree() returns a tree of nodes mirroring the working directory
+* TallyCommitsTree() returns a tree of nodes mirroring the directory at prefix
 * with a tally for each node.
+*
+* Paths in worktreePaths are relative to the root of the repository. A node is
+* marked as in the working tree if its path is in worktreePaths, or always if
+* worktreePaths is nil.
  */
 func TallyCommitsTree(
 	commits iter.Seq2[git.Commit, error],
 	opts TallyOpts,
 	worktreePaths map[string]bool,
-	gitRootPath string,
+	prefix string,
 ) (*TreeNode, error) {
 	// Tally paths
 	talliesByPath, err := TallyCommitsByPath(commits, opts)
@@ -107,36 +197,26 @@ func TallyCommitsTree(
 		return nil, err
 	}
 
-	return TallyCommitsTreeFromPaths(talliesByPath, worktreePaths, gitRootPath)
+	return TallyCommitsTreeFromPaths(talliesByPath, worktreePaths, prefix)
 }
 
 func TallyCommitsTreeFromPaths(
 	talliesByPath TalliesByPath,
 	worktreePaths map[string]bool,
-	gitRootPath string,
+	prefix string,
 ) (*TreeNode, error) {
 	root := newNode(true)
 
-	wd, err := os.Getwd()
-	if err != nil {
-		return root, err
-	}
-
 	// Build tree
 	for key, pathTallies := range talliesByPath {
 		for path, tally := range pathTallies {
-			relPath := path
-			if gitRootPath != "" {
-				// Adjust path for working dir
-				absPath := filepath.Join(gitRootPath, path)
-				relPath, err = filepath.Rel(wd, absPath)
-				if err != nil || !filepath.IsLocal(relPath) {
-					continue // Skip any paths outside of working dir
-				}
+			relPath, ok := strings.CutPrefix(path, prefix)
+			if !ok {
+				continue // Skip any paths outside of prefix
 			}
 
-			inWTree := worktreePaths[relPath]
-			root.insert(relPath, key, tally, inWTree)
+			inWTree := worktreePaths == nil || worktreePaths[path]
+			root.insert(filepath.FromSlash(relPath), key, tally, inWTree)
 		}
 	}
 
@@ -133,3 +133,312 @@ func TestTallyCommitsTreeNoCommits(t *testing.T) {
 		)
 	}
 }
+
+func TestTreeNodeRerank(t *testing.T) {
+	commits := []git.Commit{
+		git.Commit{
+			Hash:        "baa",
+			ShortHash:   "baa",
+			AuthorName:  "bob",
+			AuthorEmail: "bob@mail.com",
+			FileDiffs: []git.FileDiff{
+				git.FileDiff{
+					Path:         "foo/bim.txt",
+					LinesAdded:   1,
+					LinesRemoved: 0,
+				},
+			},
+		},
+		git.Commit{
+			Hash:        "bab",
+			ShortHash:   "bab",
+			AuthorName:  "bob",
+			AuthorEmail: "bob@mail.com",
+			FileDiffs: []git.FileDiff{
+				git.FileDiff{
+					Path:         "foo/bim.txt",
+					LinesAdded:   1,
+					LinesRemoved: 0,
+				},
+			},
+		},
+		git.Commit{
+			Hash:        "bac",
+			ShortHash:   "bac",
+			AuthorName:  "jim",
+			AuthorEmail: "jim@mail.com",
+			FileDiffs: []git.FileDiff{
+				git.FileDiff{
+					Path:         "foo/bim.txt",
+					LinesAdded:   40,
+					LinesRemoved: 2,
+				},
+			},
+		},
+	}
+
+	worktreeset := map[string]bool{"foo/bim.txt": true}
+	seq := iterutils.WithoutErrors(slices.Values(commits))
+	opts := tally.TallyOpts{
+		Mode: tally.CommitMode,
+		Key:  func(c git.Commit) string { return c.AuthorEmail },
+	}
+
+	root, err := tally.TallyCommitsTree(seq, opts, worktreeset, "")
+	if err != nil {
+		t.Fatalf("TallyCommitsTree() returned error: %v", err)
+	}
+
+	root = root.Rank(tally.CommitMode)
+	if root.Tally.AuthorName != "bob" {
+		t.Errorf("expected bob to rank first by commits")
+	}
+
+	root = root.Rerank(tally.LinesMode)
+	bimNode := root.Children["foo"].Children["bim.txt"]
+	if bimNode.Tally.AuthorName != "jim" {
+		t.Errorf("expected jim to rank first by lines")
+	}
+
+	// Reranking should not have summed up metrics a second time
+	expected := tally.FinalTally{
+		AuthorName:   "jim",
+		AuthorEmail:  "jim@mail.com",
+		Commits:      1,
+		LinesAdded:   40,
+		LinesRemoved: 2,
+		FileCount:    1,
+	}
+	if diff := cmp.Diff(expected, root.Tally); diff != "" {
+		t.Errorf("jim's tally is wrong:\n%s", diff)
+	}
+
+	authors := root.Authors(tally.LinesMode)
+	if len(authors) != 2 {
+		t.Fatalf("expected two authors but got %d", len(authors))
+	}
+
+	if authors[1].AuthorName != "bob" || authors[1].LinesAdded != 2 {
+		t.Errorf("bob's tally is wrong: %v", authors[1])
+	}
+}
+
+func TestTreeNodeSummary(t *testing.T) {
+	commits := []git.Commit{
+		git.Commit{
+			Hash:        "baa",
+			ShortHash:   "baa",
+			AuthorName:  "bob",
+			AuthorEmail: "bob@mail.com",
+			FileDiffs: []git.FileDiff{
+				git.FileDiff{
+					Path:         "foo/bim.txt",
+					LinesAdded:   6,
+					LinesRemoved: 0,
+				},
+				git.FileDiff{
+					Path:         "foo/bar.txt",
+					LinesAdded:   2,
+					LinesRemoved: 0,
+				},
+			},
+		},
+		git.Commit{
+			Hash:        "bab",
+			ShortHash:   "bab",
+			AuthorName:  "bob",
+			AuthorEmail: "bob@mail.com",
+			FileDiffs: []git.FileDiff{
+				git.FileDiff{
+					Path:         "foo/bim.txt",
+					LinesAdded:   1,
+					LinesRemoved: 1,
+				},
+			},
+		},
+		git.Commit{
+			Hash:        "bac",
+			ShortHash:   "bac",
+			AuthorName:  "jim",
+			AuthorEmail: "jim@mail.com",
+			FileDiffs: []git.FileDiff{
+				git.FileDiff{
+					Path:         "foo/bim.txt",
+					LinesAdded:   2,
+					LinesRemoved: 0,
+				},
+			},
+		},
+	}
+
+	worktreeset := map[string]bool{"foo/bim.txt": true, "foo/bar.txt": true}
+	seq := iterutils.WithoutErrors(slices.Values(commits))
+	opts := tally.TallyOpts{
+		Mode: tally.LinesMode,
+		Key:  func(c git.Commit) string { return c.AuthorEmail },
+	}
+
+	root, err := tally.TallyCommitsTree(seq, opts, worktreeset, "")
+	if err != nil {
+		t.Fatalf("TallyCommitsTree() returned error: %v", err)
+	}
+
+	root = root.Rank(opts.Mode)
+	fooNode := root.Children["foo"]
+	barNode := fooNode.Children["bar.txt"]
+
+	if fooNode.Contributors() != 2 {
+		t.Errorf("expected 2 contributors but got %d", fooNode.Contributors())
+	}
+
+	if barNode.Contributors() != 1 {
+		t.Errorf("expected 1 contributor but got %d", barNode.Contributors())
+	}
+
+	if fooNode.TotalCommits() != 3 {
+		t.Errorf("expected 3 commits but got %d", fooNode.TotalCommits())
+	}
+
+	share, ok := fooNode.Share(tally.LinesMode)
+	if !ok || share != 10.0/12.0 {
+		t.Errorf("expected share of 10/12 but got %v", share)
+	}
+
+	_, ok = fooNode.Share(tally.LastModifiedMode)
+	if ok {
+		t.Errorf("share should not be defined for last modified mode")
+	}
+
+	if fooNode.BusFactor(tally.LinesMode) != 1 {
+		t.Errorf(
+			"expected bus factor of 1 by lines but got %d",
+			fooNode.BusFactor(tally.LinesMode),
+		)
+	}
+
+	if fooNode.BusFactor(tally.CommitMode) != 1 {
+		t.Errorf(
+			"expected bus factor of 1 by commits but got %d",
+			fooNode.BusFactor(tally.CommitMode),
+		)
+	}
+}
+
+func TestTallyCommitsTreePrefix(t *testing.T) {
+	commits := []git.Commit{
+		git.Commit{
+			Hash:        "baa",
+			ShortHash:   "baa",
+			AuthorName:  "bob",
+			AuthorEmail: "bob@mail.com",
+			FileDiffs: []git.FileDiff{
+				git.FileDiff{
+					Path:         "foo/bim.txt",
+					LinesAdded:   4,
+					LinesRemoved: 0,
+				},
+				git.FileDiff{
+					Path:         "bar.txt",
+					LinesAdded:   8,
+					LinesRemoved: 2,
+				},
+			},
+		},
+	}
+
+	worktreeset := map[string]bool{"foo/bim.txt": true}
+	seq := iterutils.WithoutErrors(slices.Values(commits))
+	opts := tally.TallyOpts{
+		Mode: tally.CommitMode,
+		Key:  func(c git.Commit) string { return c.AuthorEmail },
+	}
+
+	root, err := tally.TallyCommitsTree(seq, opts, worktreeset, "foo/")
+	if err != nil {
+		t.Fatalf("TallyCommitsTree() returned error: %v", err)
+	}
+
+	if len(root.Children) != 1 {
+		t.Fatalf("expected root to have 1 child but got %d", len(root.Children))
+	}
+
+	bimNode, ok := root.Children["bim.txt"]
+	if !ok {
+		t.Fatalf("root node has no \"bim.txt\" child")
+	}
+
+	if !bimNode.InWorkTree {
+		t.Errorf("expected \"bim.txt\" to be in the working tree")
+	}
+}
+
+func TestTreeNodeBusFactor(t *testing.T) {
+	commits := []git.Commit{}
+	for _, name := range []string{"bob", "jim", "sue"} {
+		commits = append(commits, git.Commit{
+			Hash:        name,
+			ShortHash:   name,
+			AuthorName:  name,
+			AuthorEmail: name + "@mail.com",
+			FileDiffs: []git.FileDiff{
+				git.FileDiff{
+					Path:         "foo.txt",
+					LinesAdded:   1,
+					LinesRemoved: 0,
+				},
+			},
+		})
+	}
+
+	seq := iterutils.WithoutErrors(slices.Values(commits))
+	opts := tally.TallyOpts{
+		Mode: tally.CommitMode,
+		Key:  func(c git.Commit) string { return c.AuthorEmail },
+	}
+
+	root, err := tally.TallyCommitsTree(seq, opts, map[string]bool{}, "")
+	if err != nil {
+		t.Fatalf("TallyCommitsTree() returned error: %v", err)
+	}
+
+	root = root.Rank(opts.Mode)
+
+	// No one author has half of the commits, but any two do
+	if root.BusFactor(tally.CommitMode) != 2 {
+		t.Errorf("expected bus factor of 2 but got %d", root.BusFactor(tally.CommitMode))
+	}
+}
+
+func TestTallyCommitsTreeNoWorkTree(t *testing.T) {
+	commits := []git.Commit{
+		git.Commit{
+			Hash:        "baa",
+			ShortHash:   "baa",
+			AuthorName:  "bob",
+			AuthorEmail: "bob@mail.com",
+			FileDiffs: []git.FileDiff{
+				git.FileDiff{
+					Path:         "foo/bim.txt",
+					LinesAdded:   4,
+					LinesRemoved: 0,
+				},
+			},
+		},
+	}
+
+	seq := iterutils.WithoutErrors(slices.Values(commits))
+	opts := tally.TallyOpts{
+		Mode: tally.CommitMode,
+		Key:  func(c git.Commit) string { return c.AuthorEmail },
+	}
+
+	root, err := tally.TallyCommitsTree(seq, opts, nil, "")
+	if err != nil {
+		t.Fatalf("TallyCommitsTree() returned error: %v", err)
+	}
+
+	bimNode := root.Children["foo"].Children["bim.txt"]
+	if !bimNode.InWorkTree {
+		t.Errorf("expected every path to be in the working tree")
+	}
+}
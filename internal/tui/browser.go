@@ -0,0 +1,601 @@
+// Interactive terminal browser for the file tree built by the "tree"
+// subcommand.
+package tui
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	runewidth "github.com/mattn/go-runewidth"
+
+	"github.com/trinhminhtriet/git-author/internal/format"
+	"github.com/trinhminhtriet/git-author/internal/pretty"
+	"github.com/trinhminhtriet/git-author/internal/tally"
+)
+
+// Modes we can switch between, in the order we cycle through them.
+var modes = []tally.TallyMode{
+	tally.CommitMode,
+	tally.LinesMode,
+	tally.FilesMode,
+	tally.LastModifiedMode,
+	tally.FirstModifiedMode,
+}
+
+var modeNames = map[tally.TallyMode]string{
+	tally.CommitMode:        "commits",
+	tally.LinesMode:         "lines",
+	tally.FilesMode:         "files",
+	tally.LastModifiedMode:  "last modified",
+	tally.FirstModifiedMode: "first modified",
+}
+
+const panelMinWidth = 30
+
+type BrowserOpts struct {
+	Mode       tally.TallyMode
+	ShowEmail  bool
+	ShowHidden bool      // Show paths not in the working tree
+	Now        time.Time // Used to print relative times
+	ASCII      bool      // Draw with ASCII characters only
+}
+
+// A visible line in the tree.
+type row struct {
+	node  *tally.TreeNode
+	path  string // Path relative to the root, used to identify the node
+	name  string
+	depth int
+}
+
+// State of the interactive tree browser.
+//
+// The tree must have been ranked before being handed to the browser. Switching
+// modes re-ranks it in place.
+type Browser struct {
+	root     *tally.TreeNode
+	opts     BrowserOpts
+	expanded map[string]bool // Paths of expanded directories
+	rows     []row
+	cursor   int
+	offset   int // Index of first row on screen
+	height   int // Rows that fit on screen, as of last render
+	panel    bool
+
+	searching bool
+	query     string
+	message   string
+}
+
+func NewBrowser(root *tally.TreeNode, opts BrowserOpts) *Browser {
+	b := &Browser{
+		root:     root,
+		opts:     opts,
+		expanded: map[string]bool{"": true},
+	}
+
+	b.buildRows()
+	return b
+}
+
+// Path of the node under the cursor.
+func (b *Browser) Selected() string {
+	if len(b.rows) == 0 {
+		return ""
+	}
+
+	return b.rows[b.cursor].path
+}
+
+func (b *Browser) Mode() tally.TallyMode {
+	return b.opts.Mode
+}
+
+func (b *Browser) PanelOpen() bool {
+	return b.panel
+}
+
+func isDir(node *tally.TreeNode) bool {
+	return len(node.Children) > 0
+}
+
+func (b *Browser) isVisible(node *tally.TreeNode) bool {
+	return node.InWorkTree || b.opts.ShowHidden
+}
+
+// Returns the names of the visible children of a node, directories first.
+func (b *Browser) childNames(node *tally.TreeNode) []string {
+	names := slices.SortedFunc(
+		maps.Keys(node.Children),
+		func(x, y string) int {
+			xIsDir := isDir(node.Children[x])
+			yIsDir := isDir(node.Children[y])
+
+			if xIsDir == yIsDir {
+				return strings.Compare(x, y)
+			} else if xIsDir {
+				return -1
+			} else {
+				return 1
+			}
+		},
+	)
+
+	return slices.DeleteFunc(names, func(name string) bool {
+		return name == tally.NoDiffPathname ||
+			!b.isVisible(node.Children[name])
+	})
+}
+
+func joinPath(dir string, name string, node *tally.TreeNode) string {
+	p := dir + name
+	if isDir(node) {
+		p += string(os.PathSeparator)
+	}
+
+	return p
+}
+
+// Flattens the expanded part of the tree into rows.
+func (b *Browser) buildRows() {
+	selected := b.Selected()
+
+	b.rows = []row{{node: b.root, path: "", name: ".", depth: 0}}
+	b.appendRows(b.root, "", 1)
+
+	b.cursor = 0
+	for i, r := range b.rows {
+		if r.path == selected {
+			b.cursor = i
+			break
+		}
+	}
+}
+
+func (b *Browser) appendRows(node *tally.TreeNode, dir string, depth int) {
+	if !b.expanded[dir] {
+		return
+	}
+
+	for _, name := range b.childNames(node) {
+		child := node.Children[name]
+		p := joinPath(dir, name, child)
+		b.rows = append(b.rows, row{
+			node:  child,
+			path:  p,
+			name:  name,
+			depth: depth,
+		})
+
+		if isDir(child) {
+			b.appendRows(child, p, depth+1)
+		}
+	}
+}
+
+// Handles a key press. Returns false once the user asks to quit.
+func (b *Browser) HandleKey(key Key) bool {
+	if key.Code == KeyCtrlC {
+		return false
+	}
+
+	b.message = ""
+
+	if b.searching {
+		b.handleSearchKey(key)
+		return true
+	}
+
+	switch key.Code {
+	case KeyUp:
+		b.move(-1)
+	case KeyDown:
+		b.move(1)
+	case KeyPageUp:
+		b.move(-max(b.height, 1))
+	case KeyPageDown:
+		b.move(max(b.height, 1))
+	case KeyHome:
+		b.cursor = 0
+	case KeyEnd:
+		b.cursor = len(b.rows) - 1
+	case KeyRight:
+		b.expand()
+	case KeyLeft:
+		b.collapse()
+	case KeyEnter:
+		b.toggle()
+	case KeyTab:
+		i := slices.Index(modes, b.opts.Mode)
+		b.setMode(modes[(i+1)%len(modes)])
+	case KeyEsc:
+		b.panel = false
+	case KeyRune:
+		return b.handleRune(key.Rune)
+	}
+
+	return true
+}
+
+func (b *Browser) handleRune(r rune) bool {
+	switch r {
+	case 'q':
+		return false
+	case 'k':
+		b.move(-1)
+	case 'j':
+		b.move(1)
+	case 'g':
+		b.cursor = 0
+	case 'G':
+		b.cursor = len(b.rows) - 1
+	case 'l':
+		b.expand()
+	case 'h':
+		b.collapse()
+	case ' ':
+		b.toggle()
+	case 'p':
+		b.panel = !b.panel
+	case 'a':
+		b.opts.ShowHidden = !b.opts.ShowHidden
+		b.buildRows()
+	case '/':
+		b.searching = true
+		b.query = ""
+	case 'n':
+		b.findNext(1)
+	case 'N':
+		b.findNext(-1)
+	case '1', '2', '3', '4', '5':
+		b.setMode(modes[r-'1'])
+	}
+
+	return true
+}
+
+func (b *Browser) handleSearchKey(key Key) {
+	switch key.Code {
+	case KeyEsc:
+		b.searching = false
+		b.query = ""
+	case KeyEnter:
+		b.searching = false
+		b.findNext(0)
+	case KeyBackspace:
+		if len(b.query) > 0 {
+			runes := []rune(b.query)
+			b.query = string(runes[:len(runes)-1])
+		}
+	case KeyRune:
+		b.query += string(key.Rune)
+	}
+}
+
+func (b *Browser) move(delta int) {
+	b.cursor = max(0, min(len(b.rows)-1, b.cursor+delta))
+}
+
+func (b *Browser) expand() {
+	r := b.rows[b.cursor]
+	if !isDir(r.node) {
+		return
+	}
+
+	if b.expanded[r.path] {
+		b.move(1) // Go to first child
+		return
+	}
+
+	b.expanded[r.path] = true
+	b.buildRows()
+}
+
+func (b *Browser) collapse() {
+	r := b.rows[b.cursor]
+	if isDir(r.node) && b.expanded[r.path] && r.path != "" {
+		b.expanded[r.path] = false
+		b.buildRows()
+		return
+	}
+
+	// Go to parent
+	for i := b.cursor - 1; i >= 0; i-- {
+		if b.rows[i].depth < r.depth {
+			b.cursor = i
+			return
+		}
+	}
+}
+
+func (b *Browser) toggle() {
+	r := b.rows[b.cursor]
+	if !isDir(r.node) || r.path == "" {
+		return
+	}
+
+	b.expanded[r.path] = !b.expanded[r.path]
+	b.buildRows()
+}
+
+func (b *Browser) setMode(mode tally.TallyMode) {
+	b.opts.Mode = mode
+	b.root.Rerank(mode)
+}
+
+// Returns the paths of every visible node in the tree, expanded or not, in the
+// order they would be shown.
+func (b *Browser) allPaths(
+	node *tally.TreeNode,
+	dir string,
+	paths []string,
+) []string {
+	for _, name := range b.childNames(node) {
+		child := node.Children[name]
+		p := joinPath(dir, name, child)
+		paths = append(paths, p)
+		paths = b.allPaths(child, p, paths)
+	}
+
+	return paths
+}
+
+// Moves the cursor to the next path matching the query, expanding its parent
+// directories if necessary. A direction of 0 includes the current path.
+func (b *Browser) findNext(direction int) {
+	if b.query == "" {
+		return
+	}
+
+	paths := b.allPaths(b.root, "", []string{})
+	query := strings.ToLower(b.query)
+
+	start := slices.Index(paths, b.Selected()) // -1 if on root
+	for i := range len(paths) {
+		var j int
+		switch {
+		case direction < 0:
+			j = start - 1 - i
+		case direction > 0:
+			j = start + 1 + i
+		default:
+			j = max(start, 0) + i
+		}
+		j = (j%len(paths) + len(paths)) % len(paths)
+
+		if strings.Contains(strings.ToLower(paths[j]), query) {
+			b.reveal(paths[j])
+			return
+		}
+	}
+
+	b.message = fmt.Sprintf("No match for \"%s\"", b.query)
+}
+
+// Expands all parents of the path and puts the cursor on it.
+func (b *Browser) reveal(path string) {
+	trimmed := strings.TrimSuffix(path, string(os.PathSeparator))
+	parts := strings.Split(trimmed, string(os.PathSeparator))
+
+	dir := ""
+	for _, part := range parts[:len(parts)-1] {
+		dir += part + string(os.PathSeparator)
+		b.expanded[dir] = true
+	}
+
+	b.buildRows()
+	for i, r := range b.rows {
+		if r.path == path {
+			b.cursor = i
+			return
+		}
+	}
+}
+
+// -- Rendering ----------------------------------------------------------------
+
+func (b *Browser) fmtMetric(t tally.FinalTally) string {
+	switch b.opts.Mode {
+	case tally.CommitMode:
+		return format.Number(t.Commits)
+	case tally.FilesMode:
+		return format.Number(t.FileCount)
+	case tally.LinesMode:
+		return fmt.Sprintf(
+			"%s / %s",
+			format.Number(t.LinesAdded),
+			format.Number(t.LinesRemoved),
+		)
+	case tally.LastModifiedMode:
+		return format.RelativeTime(b.opts.Now, t.LastCommitTime)
+	case tally.FirstModifiedMode:
+		return format.RelativeTime(b.opts.Now, t.FirstCommitTime)
+	default:
+		panic("unrecognized mode in switch")
+	}
+}
+
+func (b *Browser) fmtAuthor(t tally.FinalTally) string {
+	if b.opts.ShowEmail {
+		return format.GitEmail(t.AuthorEmail)
+	}
+
+	return t.AuthorName
+}
+
+// Fits a string into exactly the given number of columns.
+func fit(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+
+	return runewidth.FillRight(runewidth.Truncate(s, width, "…"), width)
+}
+
+func (b *Browser) glyphs() pretty.Glyphs {
+	if b.opts.ASCII {
+		return pretty.ASCIIGlyphs
+	}
+
+	return pretty.UnicodeGlyphs
+}
+
+func (b *Browser) treeLine(r row, width int) string {
+	icon := " "
+	if isDir(r.node) {
+		if b.expanded[r.path] {
+			icon = b.glyphs().Expanded
+		} else {
+			icon = b.glyphs().Collapsed
+		}
+	}
+
+	name := r.name
+	if isDir(r.node) {
+		name += string(os.PathSeparator)
+	}
+
+	left := strings.Repeat("  ", r.depth) + icon + " " + name
+	right := fmt.Sprintf(
+		"%s (%s)",
+		format.Abbrev(b.fmtAuthor(r.node.Tally), 25),
+		b.fmtMetric(r.node.Tally),
+	)
+
+	rightWidth := min(runewidth.StringWidth(right), width/2)
+	leftWidth := width - rightWidth - 1
+	return fit(left, leftWidth) + " " + fit(right, rightWidth)
+}
+
+func (b *Browser) panelLines(height int, width int) []string {
+	r := b.rows[b.cursor]
+	path := r.path
+	if path == "" {
+		path = "." + string(os.PathSeparator)
+	}
+
+	lines := []string{
+		fit(path, width),
+		fit(strings.Repeat(b.glyphs().Horizontal, width), width),
+	}
+
+	authors := r.node.Authors(b.opts.Mode)
+	for i, t := range authors {
+		if len(lines) == height-1 && i < len(authors)-1 {
+			more := fmt.Sprintf("...%s more...", format.Number(len(authors)-i))
+			lines = append(lines, fit(more, width))
+			break
+		}
+
+		metric := b.fmtMetric(t)
+		metricWidth := runewidth.StringWidth(metric)
+		lines = append(
+			lines,
+			fit(b.fmtAuthor(t), width-metricWidth-1)+" "+metric,
+		)
+	}
+
+	return lines
+}
+
+// Draws the browser to fill a screen of the given size.
+func (b *Browser) Render(w io.Writer, width int, height int) error {
+	b.height = max(height-2, 1) // Leave room for header and footer
+
+	// Scroll so that cursor is on screen
+	if b.cursor < b.offset {
+		b.offset = b.cursor
+	} else if b.cursor >= b.offset+b.height {
+		b.offset = b.cursor - b.height + 1
+	}
+
+	treeWidth := width
+	panelWidth := 0
+	var panel []string
+	if b.panel && width >= panelMinWidth*2 {
+		panelWidth = max(panelMinWidth, width*2/5)
+		treeWidth = width - panelWidth - 3
+		panel = b.panelLines(b.height, panelWidth)
+	}
+
+	var out strings.Builder
+	out.WriteString(pretty.CursorHome)
+	out.WriteString(pretty.EraseScreen)
+
+	header := fmt.Sprintf(
+		"git-author tree — %s   [tab] mode  [/] search  [p] authors  [q] quit",
+		modeNames[b.opts.Mode],
+	)
+	out.WriteString(pretty.Reverse + fit(header, width) + pretty.Reset + "\r\n")
+
+	for i := range b.height {
+		idx := b.offset + i
+
+		line := fit("", treeWidth)
+		if idx < len(b.rows) {
+			r := b.rows[idx]
+			line = b.treeLine(r, treeWidth)
+			if idx == b.cursor {
+				line = pretty.Reverse + line + pretty.Reset
+			} else if !r.node.InWorkTree {
+				line = pretty.Dim + line + pretty.Reset
+			}
+		}
+		out.WriteString(line)
+
+		if panelWidth > 0 {
+			out.WriteString(" " + b.glyphs().Vertical + " ")
+			if i < len(panel) {
+				out.WriteString(panel[i])
+			}
+		}
+
+		out.WriteString("\r\n")
+	}
+
+	footer := b.message
+	if b.searching {
+		footer = "/" + b.query
+	}
+	out.WriteString(fit(footer, width))
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// Runs the browser, reading keys from in and drawing to out, until the user
+// quits or the input is exhausted. The size function reports the size of the
+// screen.
+func (b *Browser) Run(
+	in io.Reader,
+	out io.Writer,
+	size func() (width int, height int),
+) error {
+	buf := make([]byte, 256)
+
+	for {
+		width, height := size()
+		err := b.Render(out, width, height)
+		if err != nil {
+			return err
+		}
+
+		n, readErr := in.Read(buf)
+		for _, key := range DecodeKeys(buf[:n]) {
+			if !b.HandleKey(key) {
+				return nil
+			}
+		}
+
+		if readErr == io.EOF {
+			return nil
+		} else if readErr != nil {
+			return readErr
+		}
+	}
+}
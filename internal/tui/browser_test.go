@@ -0,0 +1,204 @@
+package tui_test
+
+import (
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trinhminhtriet/git-author/internal/git"
+	"github.com/trinhminhtriet/git-author/internal/tally"
+	"github.com/trinhminhtriet/git-author/internal/tui"
+	"github.com/trinhminhtriet/git-author/internal/utils/iterutils"
+)
+
+func testTree(t *testing.T) *tally.TreeNode {
+	commits := []git.Commit{
+		git.Commit{
+			Hash:        "baa",
+			ShortHash:   "baa",
+			AuthorName:  "bob",
+			AuthorEmail: "bob@mail.com",
+			FileDiffs: []git.FileDiff{
+				git.FileDiff{
+					Path:         "foo/bim.txt",
+					LinesAdded:   4,
+					LinesRemoved: 0,
+				},
+				git.FileDiff{
+					Path:         "foo/bar.txt",
+					LinesAdded:   8,
+					LinesRemoved: 2,
+				},
+			},
+		},
+		git.Commit{
+			Hash:        "bab",
+			ShortHash:   "bab",
+			AuthorName:  "jim",
+			AuthorEmail: "jim@mail.com",
+			FileDiffs: []git.FileDiff{
+				git.FileDiff{
+					Path:         "foo/baz/qux.txt",
+					LinesAdded:   300,
+					LinesRemoved: 1,
+				},
+				git.FileDiff{
+					Path:         "README.md",
+					LinesAdded:   3,
+					LinesRemoved: 1,
+				},
+			},
+		},
+	}
+
+	worktreeset := map[string]bool{
+		"foo/bim.txt":     true,
+		"foo/bar.txt":     true,
+		"foo/baz/qux.txt": true,
+		"README.md":       true,
+	}
+	seq := iterutils.WithoutErrors(slices.Values(commits))
+	opts := tally.TallyOpts{
+		Mode: tally.CommitMode,
+		Key:  func(c git.Commit) string { return c.AuthorEmail },
+	}
+
+	root, err := tally.TallyCommitsTree(seq, opts, worktreeset, "")
+	if err != nil {
+		t.Fatalf("TallyCommitsTree() returned error: %v", err)
+	}
+
+	return root.Rank(opts.Mode)
+}
+
+func run(t *testing.T, b *tui.Browser, input string) string {
+	var out strings.Builder
+	size := func() (int, int) { return 100, 20 }
+
+	err := b.Run(strings.NewReader(input), &out, size)
+	if err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+
+	return out.String()
+}
+
+func TestDecodeKeys(t *testing.T) {
+	keys := tui.DecodeKeys([]byte("j\x1b[A\x1b[6~\x1b\r\té"))
+	expected := []tui.Key{
+		{Code: tui.KeyRune, Rune: 'j'},
+		{Code: tui.KeyUp},
+		{Code: tui.KeyPageDown},
+		{Code: tui.KeyEsc},
+		{Code: tui.KeyEnter},
+		{Code: tui.KeyTab},
+		{Code: tui.KeyRune, Rune: 'é'},
+	}
+
+	if !slices.Equal(keys, expected) {
+		t.Errorf("expected keys %v but got %v", expected, keys)
+	}
+}
+
+func TestBrowserNavigate(t *testing.T) {
+	b := tui.NewBrowser(testTree(t), tui.BrowserOpts{Now: time.Now()})
+
+	// Root, then foo/ (directories first), then README.md
+	run(t, b, "j")
+	if b.Selected() != "foo/" {
+		t.Fatalf("expected \"foo/\" to be selected but got \"%s\"", b.Selected())
+	}
+
+	// Expand foo/ and move onto its first child
+	run(t, b, "ll")
+	if b.Selected() != "foo/baz/" {
+		t.Fatalf(
+			"expected \"foo/baz/\" to be selected but got \"%s\"",
+			b.Selected(),
+		)
+	}
+
+	// Back up to foo/ and collapse it
+	run(t, b, "\x1b[Dh\x1b[B")
+	if b.Selected() != "README.md" {
+		t.Errorf(
+			"expected \"README.md\" to be selected but got \"%s\"",
+			b.Selected(),
+		)
+	}
+}
+
+func TestBrowserSearch(t *testing.T) {
+	b := tui.NewBrowser(testTree(t), tui.BrowserOpts{Now: time.Now()})
+
+	out := run(t, b, "/qux\r")
+	if b.Selected() != "foo/baz/qux.txt" {
+		t.Fatalf(
+			"expected \"foo/baz/qux.txt\" to be selected but got \"%s\"",
+			b.Selected(),
+		)
+	}
+
+	if !strings.Contains(out, "qux.txt") {
+		t.Errorf("expected match to be drawn to screen")
+	}
+
+	out = run(t, b, "/nope\r")
+	if !strings.Contains(out, "No match") {
+		t.Errorf("expected message saying there is no match")
+	}
+}
+
+func TestBrowserSwitchMode(t *testing.T) {
+	b := tui.NewBrowser(testTree(t), tui.BrowserOpts{Now: time.Now()})
+
+	out := run(t, b, "\t")
+	if b.Mode() != tally.LinesMode {
+		t.Fatalf("expected tab to switch to lines mode")
+	}
+
+	if !strings.Contains(out, "jim (303 / 2)") {
+		t.Errorf("expected root to be annotated with jim's lines")
+	}
+
+	run(t, b, "1")
+	if b.Mode() != tally.CommitMode {
+		t.Errorf("expected \"1\" to switch to commit mode")
+	}
+}
+
+func TestBrowserPanel(t *testing.T) {
+	b := tui.NewBrowser(testTree(t), tui.BrowserOpts{Now: time.Now()})
+
+	out := run(t, b, "p")
+	if !b.PanelOpen() {
+		t.Fatalf("expected panel to be open")
+	}
+
+	if !strings.Contains(out, "bob") || !strings.Contains(out, "jim") {
+		t.Errorf("expected panel to list both authors")
+	}
+
+	run(t, b, "\x1b")
+	if b.PanelOpen() {
+		t.Errorf("expected escape to close panel")
+	}
+}
+
+func TestBrowserQuit(t *testing.T) {
+	b := tui.NewBrowser(testTree(t), tui.BrowserOpts{Now: time.Now()})
+
+	// Keys after "q" should be ignored
+	err := b.Run(strings.NewReader("qj"), io.Discard, func() (int, int) {
+		return 80, 24
+	})
+	if err != nil {
+		t.Fatalf("Run() returned error: %v", err)
+	}
+
+	if b.Selected() != "" {
+		t.Errorf("expected cursor to stay on root after quitting")
+	}
+}
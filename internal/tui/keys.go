@@ -0,0 +1,111 @@
+package tui
+
+import (
+	"unicode/utf8"
+)
+
+type KeyCode int
+
+const (
+	KeyRune KeyCode = iota // A printable character
+	KeyUp
+	KeyDown
+	KeyLeft
+	KeyRight
+	KeyHome
+	KeyEnd
+	KeyPageUp
+	KeyPageDown
+	KeyEnter
+	KeyTab
+	KeyBackspace
+	KeyEsc
+	KeyCtrlC
+	KeyUnknown
+)
+
+type Key struct {
+	Code KeyCode
+	Rune rune // Only set for KeyRune
+}
+
+// Escape sequences sent by terminals for special keys, minus the leading ESC.
+var escapeSequences = map[string]KeyCode{
+	"[A":  KeyUp,
+	"[B":  KeyDown,
+	"[C":  KeyRight,
+	"[D":  KeyLeft,
+	"[H":  KeyHome,
+	"[F":  KeyEnd,
+	"[1~": KeyHome,
+	"[4~": KeyEnd,
+	"[5~": KeyPageUp,
+	"[6~": KeyPageDown,
+	"OA":  KeyUp,
+	"OB":  KeyDown,
+	"OC":  KeyRight,
+	"OD":  KeyLeft,
+	"OH":  KeyHome,
+	"OF":  KeyEnd,
+}
+
+// Turns raw terminal input into keys.
+//
+// We assume that an escape sequence is never split across two reads, which
+// holds for input typed at a terminal. A lone ESC is the escape key.
+func DecodeKeys(data []byte) []Key {
+	keys := []Key{}
+
+	for len(data) > 0 {
+		b := data[0]
+
+		switch {
+		case b == 0x1b:
+			key, n := decodeEscape(data[1:])
+			keys = append(keys, key)
+			data = data[1+n:]
+			continue
+		case b == '\r' || b == '\n':
+			keys = append(keys, Key{Code: KeyEnter})
+		case b == '\t':
+			keys = append(keys, Key{Code: KeyTab})
+		case b == 0x7f || b == 0x08:
+			keys = append(keys, Key{Code: KeyBackspace})
+		case b == 0x03:
+			keys = append(keys, Key{Code: KeyCtrlC})
+		case b < 0x20:
+			keys = append(keys, Key{Code: KeyUnknown})
+		default:
+			r, size := utf8.DecodeRune(data)
+			keys = append(keys, Key{Code: KeyRune, Rune: r})
+			data = data[size:]
+			continue
+		}
+
+		data = data[1:]
+	}
+
+	return keys
+}
+
+// Decodes the rest of an escape sequence, returning the key and the number of
+// bytes consumed after the ESC.
+func decodeEscape(data []byte) (Key, int) {
+	if len(data) == 0 || (data[0] != '[' && data[0] != 'O') {
+		return Key{Code: KeyEsc}, 0
+	}
+
+	// Sequences end with a byte in the range 0x40–0x7E
+	for i := 1; i < len(data); i++ {
+		if data[i] >= 0x40 && data[i] <= 0x7e {
+			code, ok := escapeSequences[string(data[:i+1])]
+			if !ok {
+				code = KeyUnknown
+			}
+
+			return Key{Code: code}, i + 1
+		}
+	}
+
+	return Key{Code: KeyUnknown}, len(data)
+}
@@ -0,0 +1,47 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+
+	"github.com/trinhminhtriet/git-author/internal/pretty"
+)
+
+// Runs the browser full-screen in the terminal attached to stdin and stdout.
+func RunTerminal(b *Browser) (err error) {
+	inFd := int(os.Stdin.Fd())
+	outFd := int(os.Stdout.Fd())
+
+	if !term.IsTerminal(inFd) || !term.IsTerminal(outFd) {
+		return errors.New("interactive mode requires a terminal")
+	}
+
+	state, err := term.MakeRaw(inFd)
+	if err != nil {
+		return fmt.Errorf("could not put terminal into raw mode: %w", err)
+	}
+	defer func() {
+		fmt.Print(pretty.ShowCursor + pretty.ExitAltScreen)
+
+		restoreErr := term.Restore(inFd, state)
+		if err == nil && restoreErr != nil {
+			err = fmt.Errorf("could not restore terminal: %w", restoreErr)
+		}
+	}()
+
+	fmt.Print(pretty.EnterAltScreen + pretty.HideCursor)
+
+	size := func() (int, int) {
+		width, height, err := term.GetSize(outFd)
+		if err != nil {
+			return 80, 24
+		}
+
+		return width, height
+	}
+
+	return b.Run(os.Stdin, os.Stdout, size)
+}
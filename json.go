@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/trinhminhtriet/git-author/internal/git"
+	"github.com/trinhminhtriet/git-author/internal/tally"
+)
+
+// Version of the JSON output schema. Bump this whenever a field is removed or
+// changes meaning; adding fields is fine.
+//
+// lines_added, lines_removed and files are zero when they weren't counted:
+// table and hist only count them in lines and files mode, while tree (and
+// tree --compare) always counts them.
+const jsonSchemaVersion = 1
+
+// JSON representation of a tally.FinalTally.
+type jsonTally struct {
+	AuthorName      string    `json:"author_name"`
+	AuthorEmail     string    `json:"author_email"`
+	Commits         int       `json:"commits"`
+	LinesAdded      int       `json:"lines_added"`
+	LinesRemoved    int       `json:"lines_removed"`
+	FileCount       int       `json:"files"`
+	FirstCommitTime time.Time `json:"first_commit_time,omitzero"`
+	LastCommitTime  time.Time `json:"last_commit_time,omitzero"`
+}
+
+// Lines and files are left as zero unless withDiffs says the tally was made
+// from commits with their diffs.
+func toJSONTally(t tally.FinalTally, withDiffs bool) jsonTally {
+	jt := jsonTally{
+		AuthorName:      t.AuthorName,
+		AuthorEmail:     t.AuthorEmail,
+		Commits:         t.Commits,
+		FirstCommitTime: t.FirstCommitTime,
+		LastCommitTime:  t.LastCommitTime,
+	}
+
+	if withDiffs {
+		jt.LinesAdded = t.LinesAdded
+		jt.LinesRemoved = t.LinesRemoved
+		jt.FileCount = t.FileCount
+	}
+
+	return jt
+}
+
+// Totals across all authors. Like jsonTally but without an author.
+type jsonTotals struct {
+	Commits         int       `json:"commits"`
+	LinesAdded      int       `json:"lines_added"`
+	LinesRemoved    int       `json:"lines_removed"`
+	FileCount       int       `json:"files"`
+	FirstCommitTime time.Time `json:"first_commit_time,omitzero"`
+	LastCommitTime  time.Time `json:"last_commit_time,omitzero"`
+}
+
+// Like toJSONTally(), leaves lines and files as zero unless withDiffs is set.
+func toJSONTotals(t tally.FinalTally, withDiffs bool) jsonTotals {
+	totals := jsonTotals{
+		Commits:         t.Commits,
+		FirstCommitTime: t.FirstCommitTime,
+		LastCommitTime:  t.LastCommitTime,
+	}
+
+	if withDiffs {
+		totals.LinesAdded = t.LinesAdded
+		totals.LinesRemoved = t.LinesRemoved
+		totals.FileCount = t.FileCount
+	}
+
+	return totals
+}
+
+// One line of "parse --format ndjson".
+type jsonCommit struct {
+	Hash        string         `json:"hash"`
+	ShortHash   string         `json:"short_hash"`
+	Parents     []string       `json:"parents"`
+	IsMerge     bool           `json:"is_merge"`
+	AuthorName  string         `json:"author_name"`
+	AuthorEmail string         `json:"author_email"`
+	AuthorDate  time.Time      `json:"author_date"`
+	CommitDate  time.Time      `json:"commit_date"`
+	Files       []jsonFileDiff `json:"files"`
+}
+
+type jsonFileDiff struct {
+	Path         string `json:"path"`
+	LinesAdded   int    `json:"lines_added"`
+	LinesRemoved int    `json:"lines_removed"`
+}
+
+func toJSONCommit(c git.Commit) jsonCommit {
+	commit := jsonCommit{
+		Hash:        c.Hash,
+		ShortHash:   c.ShortHash,
+		Parents:     c.Parents,
+		IsMerge:     c.IsMerge,
+		AuthorName:  c.AuthorName,
+		AuthorEmail: c.AuthorEmail,
+		AuthorDate:  c.Date,
+		CommitDate:  c.CommitDate,
+		Files:       []jsonFileDiff{},
+	}
+
+	if commit.Parents == nil {
+		commit.Parents = []string{}
+	}
+
+	for _, diff := range c.FileDiffs {
+		commit.Files = append(commit.Files, jsonFileDiff{
+			Path:         diff.Path,
+			LinesAdded:   diff.LinesAdded,
+			LinesRemoved: diff.LinesRemoved,
+		})
+	}
+
+	return commit
+}
+
+func fromJSONCommit(c jsonCommit) git.Commit {
+	commit := git.Commit{
+		Hash:        c.Hash,
+		ShortHash:   c.ShortHash,
+		Parents:     c.Parents,
+		IsMerge:     c.IsMerge,
+		AuthorName:  c.AuthorName,
+		AuthorEmail: c.AuthorEmail,
+		Date:        c.AuthorDate,
+		CommitDate:  c.CommitDate,
+	}
+
+	for _, diff := range c.Files {
+		commit.FileDiffs = append(commit.FileDiffs, git.FileDiff{
+			Path:         diff.Path,
+			LinesAdded:   diff.LinesAdded,
+			LinesRemoved: diff.LinesRemoved,
+		})
+	}
+
+	return commit
+}
+
+// Output of "table --format json".
+type jsonTable struct {
+	Version int         `json:"version"`
+	Mode    string      `json:"mode"`
+	Authors []jsonTally `json:"authors"`
+}
+
+// Output of "tree --format json". Trees are always tallied from commits with
+// their diffs, so lines and files are filled in whatever the mode.
+type jsonTree struct {
+	Version int          `json:"version"`
+	Mode    string       `json:"mode"`
+	Root    jsonTreeNode `json:"root"`
+}
+
+type jsonTreeNode struct {
+	Path       string         `json:"path"`
+	InWorkTree bool           `json:"in_work_tree"`
+	Tally      jsonTally      `json:"tally"`   // Top author
+	Authors    []jsonTally    `json:"authors"` // Every author, ranked
+	Children   []jsonTreeNode `json:"children"`
+}
+
+// Output of "hist --format json".
+type jsonHist struct {
+	Version int          `json:"version"`
+	Mode    string       `json:"mode"`
+	Buckets []jsonBucket `json:"buckets"`
+}
+
+type jsonBucket struct {
+	Name   string     `json:"name"`
+	Time   time.Time  `json:"time"`
+	Winner *jsonTally `json:"winner"` // Null if there were no commits
+	Totals jsonTotals `json:"totals"`
+}
+
+// Output of "tree --compare --format json".
+type jsonCompare struct {
+	Version int             `json:"version"`
+	Mode    string          `json:"mode"`
+	Changes []compareRecord `json:"changes"`
+}
+
+func modeName(mode tally.TallyMode) string {
+	switch mode {
+	case tally.CommitMode:
+		return "commits"
+	case tally.LinesMode:
+		return "lines"
+	case tally.FilesMode:
+		return "files"
+	case tally.LastModifiedMode:
+		return "last-modified"
+	case tally.FirstModifiedMode:
+		return "first-modified"
+	default:
+		panic("unrecognized mode in switch")
+	}
+}
+
+func writeJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("error writing JSON to stdout: %w", err)
+	}
+
+	return nil
+}
+
+func writeTableJSON(tallies []tally.FinalTally, mode tally.TallyMode) error {
+	withDiffs := tally.TallyOpts{Mode: mode}.IsDiffMode()
+
+	authors := []jsonTally{}
+	for _, t := range tallies {
+		authors = append(authors, toJSONTally(t, withDiffs))
+	}
+
+	return writeJSON(jsonTable{
+		Version: jsonSchemaVersion,
+		Mode:    modeName(mode),
+		Authors: authors,
+	})
+}
+
+func writeTreeJSON(root *tally.TreeNode, opts printTreeOpts) error {
+	return writeJSON(jsonTree{
+		Version: jsonSchemaVersion,
+		Mode:    modeName(opts.mode),
+		Root:    toJSONTreeNode(root, ".", 0, opts),
+	})
+}
+
+func toJSONTreeNode(
+	node *tally.TreeNode,
+	path string,
+	depth int,
+	opts printTreeOpts,
+) jsonTreeNode {
+	jsonNode := jsonTreeNode{
+		Path:       filepath.ToSlash(path),
+		InWorkTree: node.InWorkTree,
+		Tally:      toJSONTally(node.Tally, true),
+		Authors:    []jsonTally{},
+		Children:   []jsonTreeNode{},
+	}
+
+	for _, t := range node.Authors(opts.mode) {
+		jsonNode.Authors = append(jsonNode.Authors, toJSONTally(t, true))
+	}
+
+	if depth >= opts.maxDepth {
+		return jsonNode
+	}
+
+	childPaths := sortChildPaths(
+		node.Children,
+		func(child *tally.TreeNode) bool { return len(child.Children) > 0 },
+	)
+	for _, p := range childPaths {
+		if p == tally.NoDiffPathname {
+			continue
+		}
+
+		jsonNode.Children = append(
+			jsonNode.Children,
+			toJSONTreeNode(
+				node.Children[p],
+				filepath.Join(path, p),
+				depth+1,
+				opts,
+			),
+		)
+	}
+
+	return jsonNode
+}
+
+func writeHistJSON(buckets []tally.TimeBucket, mode tally.TallyMode) error {
+	withDiffs := tally.TallyOpts{Mode: mode}.IsDiffMode()
+
+	jsonBuckets := []jsonBucket{}
+	for _, bucket := range buckets {
+		jsonB := jsonBucket{
+			Name:   bucket.Name,
+			Time:   bucket.Time,
+			Totals: toJSONTotals(bucket.TotalTally, withDiffs),
+		}
+
+		if bucket.TotalTally.Commits > 0 {
+			winner := toJSONTally(bucket.Tally, withDiffs)
+			jsonB.Winner = &winner
+		}
+
+		jsonBuckets = append(jsonBuckets, jsonB)
+	}
+
+	return writeJSON(jsonHist{
+		Version: jsonSchemaVersion,
+		Mode:    modeName(mode),
+		Buckets: jsonBuckets,
+	})
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/trinhminhtriet/git-author/internal/git"
+	"github.com/trinhminhtriet/git-author/internal/tally"
+	"github.com/trinhminhtriet/git-author/internal/utils/iterutils"
+)
+
+func TestJSONTallyCommitMode(t *testing.T) {
+	commits := []git.Commit{
+		{
+			Hash:        "1e9ea7662b1001d860471a4cece5e2f1de8062fb",
+			ShortHash:   "1e9ea76",
+			AuthorName:  "Alice",
+			AuthorEmail: "alice@mail.com",
+			Date:        time.Unix(1700000000, 0).UTC(),
+			FileDiffs: []git.FileDiff{
+				{Path: "foo.txt", LinesAdded: 3, LinesRemoved: 1},
+			},
+		},
+		{
+			Hash:        "2e9ea7662b1001d860471a4cece5e2f1de8062fb",
+			ShortHash:   "2e9ea76",
+			AuthorName:  "Alice",
+			AuthorEmail: "alice@mail.com",
+			Date:        time.Unix(1700000100, 0).UTC(),
+			FileDiffs: []git.FileDiff{
+				{Path: "foo.txt", LinesAdded: 2},
+			},
+		},
+	}
+
+	tallyAs := func(mode tally.TallyMode) tally.FinalTally {
+		opts := tally.TallyOpts{
+			Mode: mode,
+			Key:  func(c git.Commit) string { return c.AuthorName },
+		}
+
+		tallies, err := tally.TallyCommits(
+			iterutils.WithoutErrors(slices.Values(commits)),
+			opts,
+		)
+		if err != nil {
+			t.Fatalf("TallyCommits() returned error: %v", err)
+		}
+
+		return tally.Rank(tallies, mode)[0]
+	}
+
+	// Commit mode tallies without diffs, so lines and files are left out
+	// rather than showing the commit count as the number of files
+	expected := jsonTally{
+		AuthorName:      "Alice",
+		AuthorEmail:     "alice@mail.com",
+		Commits:         2,
+		FirstCommitTime: time.Unix(1700000000, 0).UTC(),
+		LastCommitTime:  time.Unix(1700000100, 0).UTC(),
+	}
+
+	got := toJSONTally(tallyAs(tally.CommitMode), false)
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("commit mode tally is wrong:\n%s", diff)
+	}
+
+	totals := toJSONTotals(tallyAs(tally.CommitMode), false)
+	if totals.LinesAdded != 0 || totals.LinesRemoved != 0 || totals.FileCount != 0 {
+		t.Errorf("expected no lines or files in commit mode totals, got %+v", totals)
+	}
+
+	// Lines mode does
+	expected.LinesAdded = 5
+	expected.LinesRemoved = 1
+	expected.FileCount = 1
+
+	got = toJSONTally(tallyAs(tally.LinesMode), true)
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Errorf("lines mode tally is wrong:\n%s", diff)
+	}
+}
+
+func TestJSONTreeCountsLinesInCommitMode(t *testing.T) {
+	commits := []git.Commit{
+		{
+			Hash:        "1e9ea7662b1001d860471a4cece5e2f1de8062fb",
+			ShortHash:   "1e9ea76",
+			AuthorName:  "Alice",
+			AuthorEmail: "alice@mail.com",
+			Date:        time.Unix(1700000000, 0).UTC(),
+			FileDiffs: []git.FileDiff{
+				{Path: "foo.txt", LinesAdded: 3, LinesRemoved: 1},
+				{Path: "bar.txt", LinesAdded: 4},
+			},
+		},
+		{
+			Hash:        "2e9ea7662b1001d860471a4cece5e2f1de8062fb",
+			ShortHash:   "2e9ea76",
+			AuthorName:  "Alice",
+			AuthorEmail: "alice@mail.com",
+			Date:        time.Unix(1700000100, 0).UTC(),
+			FileDiffs: []git.FileDiff{
+				{Path: "foo.txt", LinesAdded: 2},
+			},
+		},
+	}
+
+	opts := tally.TallyOpts{
+		Mode: tally.CommitMode,
+		Key:  func(c git.Commit) string { return c.AuthorName },
+	}
+	root, err := tally.TallyCommitsTree(
+		iterutils.WithoutErrors(slices.Values(commits)),
+		opts,
+		map[string]bool{"foo.txt": true, "bar.txt": true},
+		"",
+	)
+	if err != nil {
+		t.Fatalf("TallyCommitsTree() returned error: %v", err)
+	}
+	root = root.Rank(opts.Mode)
+
+	out := captureStdout(t, func() error {
+		return writeTreeJSON(root, printTreeOpts{mode: opts.Mode, maxDepth: 10})
+	})
+
+	var tree jsonTree
+	if err := json.Unmarshal([]byte(out), &tree); err != nil {
+		t.Fatalf("could not parse JSON output: %v", err)
+	}
+
+	// Trees are always tallied with diffs, so lines and files are known even
+	// when ranking by commits
+	expected := jsonTally{
+		AuthorName:      "Alice",
+		AuthorEmail:     "alice@mail.com",
+		Commits:         2,
+		LinesAdded:      9,
+		LinesRemoved:    1,
+		FileCount:       2,
+		FirstCommitTime: time.Unix(1700000000, 0).UTC(),
+		LastCommitTime:  time.Unix(1700000100, 0).UTC(),
+	}
+	if diff := cmp.Diff(expected, tree.Root.Tally); diff != "" {
+		t.Errorf("root tally is wrong:\n%s", diff)
+	}
+
+	files := map[string]int{}
+	for _, child := range tree.Root.Children {
+		files[child.Path] = child.Tally.LinesAdded
+	}
+	expectedFiles := map[string]int{"bar.txt": 4, "foo.txt": 5}
+	if diff := cmp.Diff(expectedFiles, files); diff != "" {
+		t.Errorf("lines added per file are wrong:\n%s", diff)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/trinhminhtriet/git-author/internal/git"
+	"github.com/trinhminhtriet/git-author/internal/pretty"
 	"github.com/trinhminhtriet/git-author/internal/tally"
 	"github.com/trinhminhtriet/git-author/internal/utils/flagutils"
 )
@@ -30,11 +31,13 @@ type command struct {
 // If no subcommand was specified, we default to the "table" subcommand.
 func main() {
 	subcommands := map[string]command{ // Available subcommands
-		"dump":  dumpCmd(),
-		"parse": parseCmd(),
-		"table": tableCmd(),
-		"tree":  treeCmd(),
-		"hist":  histCmd(),
+		"dump":   dumpCmd(),
+		"parse":  parseCmd(),
+		"table":  tableCmd(),
+		"tree":   treeCmd(),
+		"hist":   histCmd(),
+		"report": reportCmd(),
+		"cache":  cacheCmd(),
 	}
 
 	// --- Handle top-level flags ---
@@ -54,7 +57,7 @@ func main() {
 		fmt.Println()
 		fmt.Println("Subcommands:")
 
-		helpSubcommands := []string{"table", "tree", "hist"}
+		helpSubcommands := []string{"table", "tree", "hist", "report", "cache"}
 		for _, name := range helpSubcommands {
 			cmd := subcommands[name]
 
@@ -121,7 +124,10 @@ loop:
 func tableCmd() command {
 	flagSet := flag.NewFlagSet("git-author table", flag.ExitOnError)
 
-	useCsv := flagSet.Bool("csv", false, "Output as csv")
+	useCsv := flagSet.Bool("csv", false, "Output as csv (same as --format csv)")
+	outputFormat := flagSet.String("format", "text", strings.TrimSpace(`
+Output format. One of: text, csv, json, markdown, openmetrics
+	`))
 	showEmail := flagSet.Bool("e", false, "Show email address of each author")
 	countMerges := flagSet.Bool("merges", false, "Count merge commits toward commit total")
 	linesMode := flagSet.Bool("l", false, "Sort by lines added + removed")
@@ -129,7 +135,16 @@ func tableCmd() command {
 	firstModifiedMode := flagSet.Bool("c", false, "Sort by first modified (created)")
 	lastModifiedMode := flagSet.Bool("m", false, "Sort by last modified")
 	limit := flagSet.Int("n", 10, "Limit rows in table (set to 0 for no limit)")
+	fromPath := flagSet.String("from", "", strings.TrimSpace(`
+Tally commits saved by "dump" or "parse --format ndjson" in this file instead
+of running git log. Use - for stdin
+	`))
+	includeGenerated := flagSet.Bool("include-generated", false, strings.TrimSpace(`
+Count generated, vendored, and binary files and lockfiles toward lines and files
+	`))
 
+	templateFlags := addTemplateFlags(flagSet)
+	renderFlags := addRenderFlags(flagSet)
 	filterFlags := addFilterFlags(flagSet)
 
 	description := "Print out a table showing total contributions by author"
@@ -172,7 +187,34 @@ Usage: git-author table [options...] [revisions...] [[--] paths...]
 				return errors.New("-n flag must be a positive integer")
 			}
 
-			revs, pathspecs, err := git.ParseArgs(args)
+			if *useCsv {
+				if *outputFormat != "text" && *outputFormat != "csv" {
+					return errors.New("--csv cannot be combined with --format")
+				}
+				*outputFormat = "csv"
+			}
+
+			switch *outputFormat {
+			case "text", "csv", "json", "markdown", "openmetrics":
+			default:
+				return fmt.Errorf("unknown output format: %s", *outputFormat)
+			}
+
+			tmpl, err := templateFlags.parse()
+			if err != nil {
+				return err
+			}
+
+			renderer, err := renderFlags.renderer()
+			if err != nil {
+				return err
+			}
+
+			if tmpl != nil && *outputFormat != "text" {
+				return errors.New("--template cannot be combined with --format")
+			}
+
+			revs, pathspecs, err := parseLogArgs(args, *fromPath)
 			if err != nil {
 				return err
 			}
@@ -182,13 +224,22 @@ Usage: git-author table [options...] [revisions...] [[--] paths...]
 				return err
 			}
 
+			err = checkFromFilters(*fromPath, filterFlags)
+			if err != nil {
+				return err
+			}
+
 			return table(
 				revs,
 				pathspecs,
+				*fromPath,
 				mode,
-				*useCsv,
+				*outputFormat,
+				tmpl,
+				renderer,
 				*showEmail,
 				*countMerges,
+				*includeGenerated,
 				*limit,
 				*filterFlags.since,
 				*filterFlags.until,
@@ -214,7 +265,40 @@ func treeCmd() command {
 		"Rank authors by last commit time",
 	)
 	depth := flagSet.Int("d", 0, "Limit on tree depth")
+	interactive := flagSet.Bool("interactive", false, strings.TrimSpace(`
+Browse the tree interactively in the terminal
+	`))
+	compare := flagSet.String("compare", "", strings.TrimSpace(`
+Compare ownership in the given revisions against ownership in this revision range
+	`))
+	outputFormat := flagSet.String("format", "text", strings.TrimSpace(`
+Output format. One of: text, csv, json, markdown, openmetrics
+	`))
+	allAuthors := flagSet.Bool("all-authors", false, strings.TrimSpace(`
+With --format csv, write a row for every author of each path, not just the top
+one
+	`))
+	includeGenerated := flagSet.Bool("include-generated", false, strings.TrimSpace(`
+Count generated, vendored, and binary files and lockfiles toward lines and files
+	`))
+	at := flagSet.String("at", "", strings.TrimSpace(`
+Show files as they are in the given revision (default: tip of the range, or of
+the --compare range)
+	`))
+	columnsFlag := flagSet.String("columns", "", strings.TrimSpace(`
+Comma-separated extra columns to show. Any of: contributors, last, total, share
+	`))
+	fromPath := flagSet.String("from", "", strings.TrimSpace(`
+Tally commits saved by "dump" or "parse --format ndjson" in this file instead
+of running git log. Use - for stdin
+	`))
+	filesPath := flagSet.String("files", "", strings.TrimSpace(`
+With --from, treat the paths listed in this file (as printed by git ls-files)
+as the working tree
+	`))
 
+	templateFlags := addTemplateFlags(flagSet)
+	renderFlags := addRenderFlags(flagSet)
 	filterFlags := addFilterFlags(flagSet)
 
 	description := "Print out a file tree showing most contributions by path"
@@ -232,7 +316,7 @@ Usage: git-author tree [options...] [revisions...] [[--] paths...]
 		flagSet:     flagSet,
 		description: description,
 		run: func(args []string) error {
-			revs, pathspecs, err := git.ParseArgs(args)
+			revs, pathspecs, err := parseLogArgs(args, *fromPath)
 			if err != nil {
 				return fmt.Errorf("could not parse args: %w", err)
 			}
@@ -242,6 +326,11 @@ Usage: git-author tree [options...] [revisions...] [[--] paths...]
 				return err
 			}
 
+			err = checkFromFilters(*fromPath, filterFlags)
+			if err != nil {
+				return err
+			}
+
 			if !isOnlyOne(
 				*useLines,
 				*useFiles,
@@ -262,6 +351,87 @@ Usage: git-author tree [options...] [revisions...] [[--] paths...]
 				mode = tally.FirstModifiedMode
 			}
 
+			switch *outputFormat {
+			case "text", "json", "csv":
+			case "markdown", "openmetrics":
+				if *compare != "" {
+					return fmt.Errorf(
+						"--format %s cannot be combined with --compare",
+						*outputFormat,
+					)
+				}
+			default:
+				return fmt.Errorf("unknown output format: %s", *outputFormat)
+			}
+
+			if *allAuthors && (*compare != "" || *outputFormat != "csv") {
+				return errors.New(
+					"--all-authors requires --format csv and cannot be " +
+						"combined with --compare",
+				)
+			}
+
+			if *interactive && (*compare != "" || *outputFormat != "text") {
+				return errors.New(
+					"--interactive cannot be combined with --compare or --format",
+				)
+			}
+
+			columns, err := parseTreeColumns(*columnsFlag)
+			if err != nil {
+				return err
+			}
+
+			if len(columns) > 0 &&
+				(*interactive || *compare != "" || *outputFormat != "text") {
+				return errors.New(
+					"--columns cannot be combined with --interactive, " +
+						"--compare or --format",
+				)
+			}
+
+			tmpl, err := templateFlags.parse()
+			if err != nil {
+				return err
+			}
+
+			renderer, err := renderFlags.renderer()
+			if err != nil {
+				return err
+			}
+
+			if tmpl != nil &&
+				(*interactive || *compare != "" || *outputFormat != "text" ||
+					len(columns) > 0) {
+				return errors.New(
+					"--template cannot be combined with --interactive, " +
+						"--compare, --format or --columns",
+				)
+			}
+
+			if *fromPath != "" && (*compare != "" || *at != "") {
+				return errors.New("--from cannot be combined with --compare or --at")
+			}
+
+			if *filesPath != "" && *fromPath == "" {
+				return errors.New("--files requires --from")
+			}
+
+			var compareRevs []string
+			if *compare != "" {
+				var comparePaths []string
+				compareRevs, comparePaths, err = git.ParseArgs(
+					[]string{*compare},
+				)
+				if err != nil {
+					return fmt.Errorf("could not parse --compare: %w", err)
+				}
+
+				if len(comparePaths) > 0 {
+					return errors.New("--compare must be a revision range")
+				}
+			}
+
 			return tree(
 				revs,
 				pathspecs,
@@ -270,6 +440,17 @@ Usage: git-author tree [options...] [revisions...] [[--] paths...]
 				*showEmail,
 				*showHidden,
 				*countMerges,
+				*includeGenerated,
+				*interactive,
+				columns,
+				*allAuthors,
+				compareRevs,
+				*at,
+				*fromPath,
+				*filesPath,
+				*outputFormat,
+				tmpl,
+				renderer,
 				*filterFlags.since,
 				*filterFlags.until,
 				filterFlags.authors,
@@ -286,7 +467,20 @@ func histCmd() command {
 	useFiles := flagSet.Bool("f", false, "Rank authors by files touched")
 	showEmail := flagSet.Bool("e", false, "Show email address of each author")
 	countMerges := flagSet.Bool("merges", false, "Count merge commits toward commit total")
+	includeGenerated := flagSet.Bool("include-generated", false, strings.TrimSpace(`
+Count generated, vendored, and binary files and lockfiles toward lines and files
+	`))
+	outputFormat := flagSet.String("format", "text", strings.TrimSpace(`
+Output format. One of: text, csv, json, markdown, svg
+	`))
+	size := flagSet.String("size", "800x300", "Width and height of svg output")
+	fromPath := flagSet.String("from", "", strings.TrimSpace(`
+Tally commits saved by "dump" or "parse --format ndjson" in this file instead
+of running git log. Use - for stdin
+	`))
 
+	templateFlags := addTemplateFlags(flagSet)
+	renderFlags := addRenderFlags(flagSet)
 	filterFlags := addFilterFlags(flagSet)
 
 	description := "Print out a timeline showing most contributions by date"
@@ -304,7 +498,7 @@ Usage: git-author hist [options...] [revisions...] [[--] paths...]
 		flagSet:     flagSet,
 		description: description,
 		run: func(args []string) error {
-			revs, pathspecs, err := git.ParseArgs(args)
+			revs, pathspecs, err := parseLogArgs(args, *fromPath)
 			if err != nil {
 				return fmt.Errorf("could not parse args: %w", err)
 			}
@@ -314,6 +508,11 @@ Usage: git-author hist [options...] [revisions...] [[--] paths...]
 				return err
 			}
 
+			err = checkFromFilters(*fromPath, filterFlags)
+			if err != nil {
+				return err
+			}
+
 			if !isOnlyOne(*useLines, *useFiles) {
 				return errors.New("all ranking flags are mutually exclusive")
 			}
@@ -325,12 +524,115 @@ Usage: git-author hist [options...] [revisions...] [[--] paths...]
 				mode = tally.FilesMode
 			}
 
+			switch *outputFormat {
+			case "text", "csv", "json", "markdown", "svg":
+			default:
+				return fmt.Errorf("unknown output format: %s", *outputFormat)
+			}
+
+			tmpl, err := templateFlags.parse()
+			if err != nil {
+				return err
+			}
+
+			renderer, err := renderFlags.renderer()
+			if err != nil {
+				return err
+			}
+
+			if tmpl != nil && *outputFormat != "text" {
+				return errors.New("--template cannot be combined with --format")
+			}
+
+			chartWidth, chartHeight, err := parseChartSize(*size)
+			if err != nil {
+				return err
+			}
+
 			return hist(
+				revs,
+				pathspecs,
+				*fromPath,
+				mode,
+				*showEmail,
+				*countMerges,
+				*includeGenerated,
+				*outputFormat,
+				tmpl,
+				renderer,
+				chartWidth,
+				chartHeight,
+				*filterFlags.since,
+				*filterFlags.until,
+				filterFlags.authors,
+				filterFlags.nauthors,
+			)
+		},
+	}
+}
+
+func reportCmd() command {
+	flagSet := flag.NewFlagSet("git-author report", flag.ExitOnError)
+
+	outPath := flagSet.String("o", "report.html", "File to write the report to")
+	useLines := flagSet.Bool("l", false, "Rank authors by lines added/changed")
+	useFiles := flagSet.Bool("f", false, "Rank authors by files touched")
+	showEmail := flagSet.Bool("e", false, "Show email address of each author")
+	countMerges := flagSet.Bool("merges", false, "Count merge commits toward commit total")
+	includeGenerated := flagSet.Bool("include-generated", false, strings.TrimSpace(`
+Count generated, vendored, and binary files and lockfiles toward lines and files
+	`))
+
+	filterFlags := addFilterFlags(flagSet)
+
+	description := "Write an HTML report with the table, tree and timeline"
+
+	flagSet.Usage = func() {
+		fmt.Println(strings.TrimSpace(`
+Usage: git-author report [options...] [revisions...] [[--] paths...]
+		`))
+		fmt.Println(description)
+		fmt.Println()
+		flagSet.PrintDefaults()
+	}
+
+	return command{
+		flagSet:     flagSet,
+		description: description,
+		run: func(args []string) error {
+			revs, pathspecs, err := git.ParseArgs(args)
+			if err != nil {
+				return fmt.Errorf("could not parse args: %w", err)
+			}
+
+			err = checkPathspecs(pathspecs)
+			if err != nil {
+				return err
+			}
+
+			if !isOnlyOne(*useLines, *useFiles) {
+				return errors.New("all ranking flags are mutually exclusive")
+			}
+
+			mode := tally.CommitMode
+			if *useLines {
+				mode = tally.LinesMode
+			} else if *useFiles {
+				mode = tally.FilesMode
+			}
+
+			if *outPath == "" {
+				return errors.New("-o must not be empty")
+			}
+
+			return report(
 				revs,
 				pathspecs,
 				mode,
+				*outPath,
 				*showEmail,
 				*countMerges,
+				*includeGenerated,
 				*filterFlags.since,
 				*filterFlags.until,
 				filterFlags.authors,
@@ -340,6 +642,122 @@ Usage: git-author hist [options...] [revisions...] [[--] paths...]
 	}
 }
 
+func cacheCmd() command {
+	flagSet := flag.NewFlagSet("git-author cache", flag.ExitOnError)
+
+	description := "Inspect and manage the cache of parsed commits"
+
+	flagSet.Usage = func() {
+		fmt.Println(strings.TrimSpace(`
+Usage: git-author cache <action> [options...]
+		`))
+		fmt.Println(description)
+		fmt.Println()
+		fmt.Println(strings.TrimSpace(`
+Actions:
+  status              Print the path, size, number of commits and state hash
+                      of this repository's cache
+  clear [-all]        Delete this repository's cache, or with -all the caches
+                      of every repository
+  prune               Drop cached commits no longer reachable from any ref
+  verify [-repair]    Check the cache for damaged entries, or with -repair
+                      drop them and keep the rest
+  warm [revisions...] Diff and cache the commits in revisions (default: HEAD),
+                      e.g. "git-author cache warm --all"
+  export <file>       Write the cached commits reachable from any ref to a
+                      bundle that can be imported into another checkout
+  import <file>       Add the commits in a bundle that are reachable from a
+                      ref in this repository to its cache
+		`))
+	}
+
+	return command{
+		flagSet:     flagSet,
+		description: description,
+		run: func(args []string) error {
+			if len(args) == 0 {
+				flagSet.Usage()
+				return errors.New("missing cache action")
+			}
+
+			action, args := args[0], args[1:]
+			switch action {
+			case "status":
+				if len(args) > 0 {
+					return errors.New("\"cache status\" takes no arguments")
+				}
+
+				return cacheStatus()
+			case "clear":
+				clearFlagSet := flag.NewFlagSet(
+					"git-author cache clear",
+					flag.ExitOnError,
+				)
+				allRepos := clearFlagSet.Bool(
+					"all",
+					false,
+					"Clear the caches of all repositories",
+				)
+				clearFlagSet.Parse(args)
+
+				if clearFlagSet.NArg() > 0 {
+					return errors.New("\"cache clear\" takes no arguments")
+				}
+
+				return cacheClear(*allRepos)
+			case "prune":
+				if len(args) > 0 {
+					return errors.New("\"cache prune\" takes no arguments")
+				}
+
+				return cachePrune()
+			case "verify":
+				verifyFlagSet := flag.NewFlagSet(
+					"git-author cache verify",
+					flag.ExitOnError,
+				)
+				repair := verifyFlagSet.Bool(
+					"repair",
+					false,
+					"Drop damaged entries from the cache",
+				)
+				verifyFlagSet.Parse(args)
+
+				if verifyFlagSet.NArg() > 0 {
+					return errors.New("\"cache verify\" takes no arguments")
+				}
+
+				return cacheVerify(*repair)
+			case "warm":
+				revs, pathspecs, err := git.ParseArgs(args)
+				if err != nil {
+					return fmt.Errorf("could not parse args: %w", err)
+				}
+
+				if len(pathspecs) > 0 {
+					return errors.New("\"cache warm\" does not take paths")
+				}
+
+				return cacheWarm(revs)
+			case "export":
+				if len(args) != 1 {
+					return errors.New("\"cache export\" takes one file")
+				}
+
+				return cacheExport(args[0])
+			case "import":
+				if len(args) != 1 {
+					return errors.New("\"cache import\" takes one file")
+				}
+
+				return cacheImport(args[0])
+			default:
+				return fmt.Errorf("unknown cache action: %s", action)
+			}
+		},
+	}
+}
+
 func dumpCmd() command {
 	flagSet := flag.NewFlagSet("git-author dump", flag.ExitOnError)
 
@@ -377,6 +795,9 @@ func parseCmd() command {
 	flagSet := flag.NewFlagSet("git-author parse", flag.ExitOnError)
 
 	short := flagSet.Bool("s", false, "Use short log")
+	outputFormat := flagSet.String("format", "text", strings.TrimSpace(`
+Output format. One of: text, ndjson
+	`))
 
 	filterFlags := addFilterFlags(flagSet)
 
@@ -393,10 +814,17 @@ func parseCmd() command {
 				return err
 			}
 
+			switch *outputFormat {
+			case "text", "ndjson":
+			default:
+				return fmt.Errorf("unknown output format: %s", *outputFormat)
+			}
+
 			return parse(
 				revs,
 				pathspecs,
 				*short,
+				*outputFormat,
 				*filterFlags.since,
 				*filterFlags.until,
 				filterFlags.authors,
@@ -463,6 +891,77 @@ Exclude commits by these authors. Can be specified multiple times
 	return &flags
 }
 
+type renderFlags struct {
+	color *string
+	ascii *bool
+	width *int
+}
+
+func addRenderFlags(set *flag.FlagSet) *renderFlags {
+	return &renderFlags{
+		color: set.String("color", "auto", strings.TrimSpace(`
+When to color output. One of: auto, always, never
+		`)),
+		ascii: set.Bool("ascii", false, strings.TrimSpace(`
+Draw tables, trees and charts with ASCII characters only
+		`)),
+		width: set.Int("width", 0, strings.TrimSpace(`
+Fit output in this many columns (default: $COLUMNS or the terminal width)
+		`)),
+	}
+}
+
+// Returns a renderer for stdout that follows --color, --ascii and --width.
+func (f *renderFlags) renderer() (*pretty.Renderer, error) {
+	if *f.width < 0 {
+		return nil, errors.New("--width must be a positive integer")
+	}
+
+	width := *f.width
+	if width == 0 {
+		width = pretty.TerminalWidth(os.Stdout)
+	}
+
+	var colorUI string
+	switch *f.color {
+	case "auto":
+		var err error
+		colorUI, err = git.GetConfig("color.ui")
+		if err != nil {
+			logger().Debug("could not read color.ui", "err", err)
+		}
+	case "always", "never":
+	default:
+		return nil, fmt.Errorf("unknown color mode: %s", *f.color)
+	}
+
+	return pretty.NewRenderer(
+		os.Stdout,
+		pretty.UseColor(*f.color, colorUI, os.Stdout),
+		*f.ascii,
+		width,
+	), nil
+}
+
+// The filters are passed to git log, so they can't be used with a saved log.
+func checkFromFilters(fromPath string, flags *filterFlags) error {
+	if fromPath == "" {
+		return nil
+	}
+
+	if *flags.since != "" ||
+		*flags.until != "" ||
+		len(flags.authors) > 0 ||
+		len(flags.nauthors) > 0 {
+		return errors.New(
+			"--since, --until, --author and --nauthor cannot be combined " +
+				"with --from",
+		)
+	}
+
+	return nil
+}
+
 /*
 * The "flag" package treats `--` as a terminator and doesn't return it as an
 * arg. We aren't really using it as a terminator though; we want to use it like
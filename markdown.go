@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/trinhminhtriet/git-author/internal/format"
+	"github.com/trinhminhtriet/git-author/internal/tally"
+)
+
+// Characters with special meaning in GitHub-flavored markdown
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"`", "\\`",
+	"|", `\|`,
+	"*", `\*`,
+	"_", `\_`,
+	"[", `\[`,
+	"]", `\]`,
+	"<", `\<`,
+	">", `\>`,
+	"#", `\#`,
+)
+
+func mdEscape(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+func mdAuthor(t tally.FinalTally, showEmail bool) string {
+	if showEmail {
+		return mdEscape(
+			fmt.Sprintf("%s %s", t.AuthorName, format.GitEmail(t.AuthorEmail)),
+		)
+	}
+
+	return mdEscape(t.AuthorName)
+}
+
+// Like fmtTallyMetric() but without any color.
+func mdMetric(t tally.FinalTally, mode tally.TallyMode) string {
+	switch mode {
+	case tally.CommitMode:
+		return fmt.Sprintf("(%s)", format.Number(t.Commits))
+	case tally.FilesMode:
+		return fmt.Sprintf("(%s)", format.Number(t.FileCount))
+	case tally.LinesMode:
+		return fmt.Sprintf(
+			"(%s / %s)",
+			format.Number(t.LinesAdded),
+			format.Number(t.LinesRemoved),
+		)
+	case tally.LastModifiedMode:
+		return fmt.Sprintf(
+			"(%s)",
+			format.RelativeTime(progStart, t.LastCommitTime),
+		)
+	case tally.FirstModifiedMode:
+		return fmt.Sprintf(
+			"(%s)",
+			format.RelativeTime(progStart, t.FirstCommitTime),
+		)
+	default:
+		panic("unrecognized mode in switch")
+	}
+}
+
+func writeTableMarkdown(
+	tallies []tally.FinalTally,
+	showEmail bool,
+	mode tally.TallyMode,
+	numFilteredOut int,
+) {
+	if len(tallies) == 0 {
+		return
+	}
+
+	diffMode := mode == tally.LinesMode || mode == tally.FilesMode
+
+	editHeader := "Last Edit"
+	if mode == tally.FirstModifiedMode {
+		editHeader = "First Edit"
+	}
+
+	if diffMode {
+		fmt.Printf(
+			"| Author | %s | Commits | Files | Lines (+/-) |\n",
+			editHeader,
+		)
+		fmt.Println("| --- | --- | ---: | ---: | ---: |")
+	} else {
+		fmt.Printf("| Author | %s | Commits |\n", editHeader)
+		fmt.Println("| --- | --- | ---: |")
+	}
+
+	for _, t := range tallies {
+		edit := t.LastCommitTime
+		if mode == tally.FirstModifiedMode {
+			edit = t.FirstCommitTime
+		}
+
+		if diffMode {
+			fmt.Printf(
+				"| %s | %s | %s | %s | %s / %s |\n",
+				mdAuthor(t, showEmail),
+				format.RelativeTime(progStart, edit),
+				format.Number(t.Commits),
+				format.Number(t.FileCount),
+				format.Number(t.LinesAdded),
+				format.Number(t.LinesRemoved),
+			)
+		} else {
+			fmt.Printf(
+				"| %s | %s | %s |\n",
+				mdAuthor(t, showEmail),
+				format.RelativeTime(progStart, edit),
+				format.Number(t.Commits),
+			)
+		}
+	}
+
+	if numFilteredOut > 0 {
+		fmt.Printf("\n*...%s more...*\n", format.Number(numFilteredOut))
+	}
+}
+
+// Prints the tree as a nested list. Annotations follow the same rules as in
+// printTree().
+func writeTreeMarkdown(
+	lines []treeOutputLine,
+	showEmail bool,
+	mode tally.TallyMode,
+) {
+	for _, line := range lines {
+		if !line.showLine {
+			continue
+		}
+
+		item := fmt.Sprintf(
+			"%s- `%s`",
+			strings.Repeat("  ", line.depth),
+			strings.ReplaceAll(line.path, "`", "'"),
+		)
+
+		if line.showTally {
+			item += fmt.Sprintf(
+				" — %s %s",
+				mdAuthor(line.tally, showEmail),
+				mdMetric(line.tally, mode),
+			)
+		}
+
+		fmt.Println(item)
+	}
+}
+
+// Prints the timeline as a table, using block characters for the bars.
+func writeHistMarkdown(
+	buckets []tally.TimeBucket,
+	maxVal int,
+	mode tally.TallyMode,
+	showEmail bool,
+) {
+	fmt.Println("| Date | | Top Author | Total |")
+	fmt.Println("| --- | --- | --- | ---: |")
+
+	for _, bucket := range buckets {
+		value := bucket.Value(mode)
+		if value == 0 {
+			fmt.Printf("| %s | | | |\n", bucket.Name)
+			continue
+		}
+
+		total := bucket.TotalValue(mode)
+		clampedValue := int(math.Ceil(
+			(float64(value) / float64(maxVal)) * float64(barWidth),
+		))
+		clampedTotal := int(math.Ceil(
+			(float64(total) / float64(maxVal)) * float64(barWidth),
+		))
+
+		fmt.Printf(
+			"| %s | %s%s | %s %s | %s |\n",
+			bucket.Name,
+			strings.Repeat("█", clampedValue),
+			strings.Repeat("░", clampedTotal-clampedValue),
+			mdAuthor(bucket.Tally, showEmail),
+			mdMetric(bucket.Tally, mode),
+			format.Number(total),
+		)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/trinhminhtriet/git-author/internal/git"
+	"github.com/trinhminhtriet/git-author/internal/tally"
+	"github.com/trinhminhtriet/git-author/internal/utils/iterutils"
+)
+
+// Pins the time relative edit times are measured from.
+func setProgStart(t *testing.T, start time.Time) {
+	saved := progStart
+	progStart = start
+	t.Cleanup(func() { progStart = saved })
+}
+
+func TestMdEscape(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		exp  string
+	}{
+		{"plain", "Alice Smith", "Alice Smith"},
+		{"pipe", "Alice | Bob", `Alice \| Bob`},
+		{"backtick", "`rm -rf`", "\\`rm -rf\\`"},
+		{"backslash", `C:\Users`, `C:\\Users`},
+		{"emphasis", "*bold* _it_", `\*bold\* \_it\_`},
+		{"link", "[x](y)", `\[x\](y)`},
+		{"html", "<b>", `\<b\>`},
+		{"heading", "#1", `\#1`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := mdEscape(test.s); got != test.exp {
+				t.Errorf("mdEscape(%q) = %q, expected %q", test.s, got, test.exp)
+			}
+		})
+	}
+}
+
+func TestWriteTableMarkdown(t *testing.T) {
+	now := time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)
+	setProgStart(t, now)
+
+	tallies := []tally.FinalTally{
+		{
+			AuthorName:      "Ali|ce",
+			AuthorEmail:     "alice@mail.com",
+			Commits:         1234,
+			LinesAdded:      10,
+			LinesRemoved:    2,
+			FileCount:       3,
+			FirstCommitTime: now.Add(-14 * 24 * time.Hour),
+			LastCommitTime:  now.Add(-2 * 24 * time.Hour),
+		},
+		{
+			AuthorName:      "`Bob`",
+			AuthorEmail:     "bob@mail.com",
+			Commits:         1,
+			LinesAdded:      1,
+			FileCount:       1,
+			FirstCommitTime: now.Add(-3 * time.Hour),
+			LastCommitTime:  now.Add(-3 * time.Hour),
+		},
+	}
+
+	tests := []struct {
+		name           string
+		tallies        []tally.FinalTally
+		showEmail      bool
+		mode           tally.TallyMode
+		numFilteredOut int
+		exp            []string
+	}{
+		{
+			name:    "commits",
+			tallies: tallies,
+			mode:    tally.CommitMode,
+			exp: []string{
+				"| Author | Last Edit | Commits |",
+				"| --- | --- | ---: |",
+				`| Ali\|ce | 2 days ago | 1,234 |`,
+				"| \\`Bob\\` | 3 hr. ago | 1 |",
+			},
+		},
+		{
+			name:    "lines",
+			tallies: tallies,
+			mode:    tally.LinesMode,
+			exp: []string{
+				"| Author | Last Edit | Commits | Files | Lines (+/-) |",
+				"| --- | --- | ---: | ---: | ---: |",
+				`| Ali\|ce | 2 days ago | 1,234 | 3 | 10 / 2 |`,
+				"| \\`Bob\\` | 3 hr. ago | 1 | 1 | 1 / 0 |",
+			},
+		},
+		{
+			name:      "first_modified_with_email",
+			tallies:   tallies[:1],
+			showEmail: true,
+			mode:      tally.FirstModifiedMode,
+			exp: []string{
+				"| Author | First Edit | Commits |",
+				"| --- | --- | ---: |",
+				`| Ali\|ce \<alice@mail.com\> | 2 weeks ago | 1,234 |`,
+			},
+		},
+		{
+			name:           "filtered_out",
+			tallies:        tallies[1:],
+			mode:           tally.CommitMode,
+			numFilteredOut: 1500,
+			exp: []string{
+				"| Author | Last Edit | Commits |",
+				"| --- | --- | ---: |",
+				"| \\`Bob\\` | 3 hr. ago | 1 |",
+				"",
+				"*...1,500 more...*",
+			},
+		},
+		{
+			name:    "empty",
+			tallies: []tally.FinalTally{},
+			mode:    tally.CommitMode,
+			exp:     []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := captureStdout(t, func() error {
+				writeTableMarkdown(
+					test.tallies,
+					test.showEmail,
+					test.mode,
+					test.numFilteredOut,
+				)
+				return nil
+			})
+
+			if diff := cmp.Diff(test.exp, outputLines(out)); diff != "" {
+				t.Errorf("markdown is wrong:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteTreeMarkdown(t *testing.T) {
+	alice := tally.FinalTally{AuthorName: "Ali|ce", Commits: 3, LinesAdded: 5}
+	bob := tally.FinalTally{AuthorName: "Bob", Commits: 1, LinesRemoved: 2}
+
+	lines := []treeOutputLine{
+		{path: "./", tally: alice, showLine: true, showTally: true},
+		{path: "src/", tally: alice, showLine: true, depth: 1},
+		{path: "a|b.go", tally: bob, showLine: true, showTally: true, depth: 2},
+		{path: "`odd`.go", tally: alice, showLine: true, showTally: true, depth: 2},
+		{path: "gone.go", tally: bob, showTally: true, depth: 1},
+	}
+
+	tests := []struct {
+		name string
+		mode tally.TallyMode
+		exp  []string
+	}{
+		{
+			name: "commits",
+			mode: tally.CommitMode,
+			exp: []string{
+				"- `./` — Ali\\|ce (3)",
+				"  - `src/`",
+				"    - `a|b.go` — Bob (1)",
+				"    - `'odd'.go` — Ali\\|ce (3)",
+			},
+		},
+		{
+			name: "lines",
+			mode: tally.LinesMode,
+			exp: []string{
+				"- `./` — Ali\\|ce (5 / 0)",
+				"  - `src/`",
+				"    - `a|b.go` — Bob (0 / 2)",
+				"    - `'odd'.go` — Ali\\|ce (5 / 0)",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := captureStdout(t, func() error {
+				writeTreeMarkdown(lines, false, test.mode)
+				return nil
+			})
+
+			if diff := cmp.Diff(test.exp, outputLines(out)); diff != "" {
+				t.Errorf("markdown is wrong:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteHistMarkdown(t *testing.T) {
+	commit := func(hash string, author string, day int) git.Commit {
+		return git.Commit{
+			Hash:       hash,
+			ShortHash:  hash[:7],
+			AuthorName: author,
+			Date:       time.Date(2025, 1, day, 12, 0, 0, 0, time.UTC),
+			FileDiffs: []git.FileDiff{
+				{Path: "foo.txt", LinesAdded: 1},
+			},
+		}
+	}
+
+	commits := []git.Commit{
+		commit("1e9ea7662b1001d860471a4cece5e2f1de8062fb", "Ali|ce", 1),
+		commit("2e9ea7662b1001d860471a4cece5e2f1de8062fb", "Ali|ce", 1),
+		commit("3e9ea7662b1001d860471a4cece5e2f1de8062fb", "`Bob`", 1),
+		commit("4e9ea7662b1001d860471a4cece5e2f1de8062fb", "`Bob`", 3),
+	}
+
+	opts := tally.TallyOpts{
+		Mode: tally.CommitMode,
+		Key:  func(c git.Commit) string { return c.AuthorName },
+	}
+	buckets, err := tally.TallyCommitsTimeline(
+		iterutils.WithoutErrors(slices.Values(commits)),
+		opts,
+		time.Time{},
+	)
+	if err != nil {
+		t.Fatalf("TallyCommitsTimeline() returned error: %v", err)
+	}
+	for i, bucket := range buckets {
+		buckets[i] = bucket.Rank(opts.Mode)
+	}
+
+	out := captureStdout(t, func() error {
+		writeHistMarkdown(buckets, 3, opts.Mode, false)
+		return nil
+	})
+
+	expected := []string{
+		"| Date | | Top Author | Total |",
+		"| --- | --- | --- | ---: |",
+		"| 2025-01-01 | " + strings.Repeat("█", 24) + strings.Repeat("░", 12) +
+			` | Ali\|ce (2) | 3 |`,
+		"| 2025-01-02 | | | |",
+		"| 2025-01-03 | " + strings.Repeat("█", 12) + " | \\`Bob\\` (1) | 1 |",
+	}
+	if diff := cmp.Diff(expected, outputLines(out)); diff != "" {
+		t.Errorf("markdown is wrong:\n%s", diff)
+	}
+}
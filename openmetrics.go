@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/trinhminhtriet/git-author/internal/tally"
+)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// A label on an OpenMetrics sample. We keep labels in a slice so that they
+// are always printed in the same order.
+type metricLabel struct {
+	name  string
+	value string
+}
+
+// Writes metrics in the OpenMetrics text format.
+type metricsWriter struct {
+	w          *bufio.Writer
+	pathLabels []metricLabel // Added to every per-author sample
+}
+
+func newMetricsWriter(w io.Writer, pathspecs []string) *metricsWriter {
+	mw := metricsWriter{w: bufio.NewWriter(w)}
+	if len(pathspecs) > 0 {
+		mw.pathLabels = []metricLabel{
+			{"path", strings.Join(pathspecs, " ")},
+		}
+	}
+
+	return &mw
+}
+
+// Starts a metric family of the given type, e.g. "gauge" or "info".
+func (mw *metricsWriter) family(name string, metricType string, help string) {
+	fmt.Fprintf(mw.w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(mw.w, "# TYPE %s %s\n", name, metricType)
+}
+
+func (mw *metricsWriter) sample(name string, labels []metricLabel, value any) {
+	mw.w.WriteString(name)
+
+	if len(labels) > 0 {
+		mw.w.WriteString("{")
+		for i, label := range labels {
+			if i > 0 {
+				mw.w.WriteString(",")
+			}
+			fmt.Fprintf(
+				mw.w,
+				"%s=\"%s\"",
+				label.name,
+				labelEscaper.Replace(label.value),
+			)
+		}
+		mw.w.WriteString("}")
+	}
+
+	fmt.Fprintf(mw.w, " %v\n", value)
+}
+
+// Writes information about this run of git-author.
+func (mw *metricsWriter) runInfo(revision string) {
+	// The sample of an info metric is named after its family, plus "_info"
+	mw.family("git_author_run", "info", "Information about the git-author run.")
+	mw.sample(
+		"git_author_run_info",
+		[]metricLabel{{"version", Version}, {"revision", revision}},
+		1,
+	)
+
+	mw.family(
+		"git_author_run_timestamp_seconds",
+		"gauge",
+		"When git-author was run, in seconds since the epoch.",
+	)
+	mw.sample("git_author_run_timestamp_seconds", nil, progStart.Unix())
+
+	mw.family(
+		"git_author_run_duration_seconds",
+		"gauge",
+		"How long git-author took to tally commits.",
+	)
+	mw.sample(
+		"git_author_run_duration_seconds",
+		nil,
+		time.Since(progStart).Seconds(),
+	)
+}
+
+// Writes commit, line and file gauges for each author.
+func (mw *metricsWriter) authors(tallies []tally.FinalTally) {
+	families := []struct {
+		name  string
+		help  string
+		value func(t tally.FinalTally) int
+	}{
+		{
+			"git_author_commits",
+			"Number of commits by the author.",
+			func(t tally.FinalTally) int { return t.Commits },
+		},
+		{
+			"git_author_lines_added",
+			"Number of lines added by the author.",
+			func(t tally.FinalTally) int { return t.LinesAdded },
+		},
+		{
+			"git_author_lines_removed",
+			"Number of lines removed by the author.",
+			func(t tally.FinalTally) int { return t.LinesRemoved },
+		},
+		{
+			"git_author_files",
+			"Number of files edited by the author.",
+			func(t tally.FinalTally) int { return t.FileCount },
+		},
+	}
+
+	for _, f := range families {
+		mw.family(f.name, "gauge", f.help)
+		for _, t := range tallies {
+			labels := append(
+				[]metricLabel{
+					{"author", t.AuthorName},
+					{"email", t.AuthorEmail},
+				},
+				mw.pathLabels...,
+			)
+			mw.sample(f.name, labels, f.value(t))
+		}
+	}
+}
+
+// Writes the bus factor of each directory in the working tree.
+func (mw *metricsWriter) busFactors(
+	root *tally.TreeNode,
+	opts printTreeOpts,
+) {
+	mw.family(
+		"git_author_bus_factor",
+		"gauge",
+		"Fewest authors who together made half of the contributions.",
+	)
+	mw.writeBusFactors(root, ".", 0, opts)
+}
+
+func (mw *metricsWriter) writeBusFactors(
+	node *tally.TreeNode,
+	path string,
+	depth int,
+	opts printTreeOpts,
+) {
+	if len(node.Children) == 0 || !node.InWorkTree || depth > opts.maxDepth {
+		return
+	}
+
+	label := filepath.ToSlash(path)
+	if label != "." {
+		label += "/"
+	}
+
+	mw.sample(
+		"git_author_bus_factor",
+		[]metricLabel{{"directory", label}},
+		node.BusFactor(opts.mode),
+	)
+
+	childPaths := sortChildPaths(
+		node.Children,
+		func(child *tally.TreeNode) bool { return len(child.Children) > 0 },
+	)
+	for _, p := range childPaths {
+		mw.writeBusFactors(
+			node.Children[p],
+			filepath.Join(path, p),
+			depth+1,
+			opts,
+		)
+	}
+}
+
+func (mw *metricsWriter) close() error {
+	mw.w.WriteString("# EOF\n")
+	if err := mw.w.Flush(); err != nil {
+		return fmt.Errorf("error writing metrics to stdout: %w", err)
+	}
+
+	return nil
+}
+
+func writeTableMetrics(
+	tallies []tally.FinalTally,
+	revs []string,
+	pathspecs []string,
+) error {
+	mw := newMetricsWriter(os.Stdout, pathspecs)
+	mw.runInfo(rangeTip(revs))
+	mw.authors(tallies)
+	return mw.close()
+}
+
+func writeTreeMetrics(
+	root *tally.TreeNode,
+	opts printTreeOpts,
+	revs []string,
+	pathspecs []string,
+) error {
+	mw := newMetricsWriter(os.Stdout, pathspecs)
+	mw.runInfo(rangeTip(revs))
+	mw.authors(root.Authors(opts.mode))
+	mw.busFactors(root, opts)
+	return mw.close()
+}
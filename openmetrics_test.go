@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/trinhminhtriet/git-author/internal/tally"
+)
+
+func TestMetricsLabelEscaping(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		exp   string
+	}{
+		{"plain", "Alice", `git_author_commits{author="Alice"} 1`},
+		{"backslash", `DOMAIN\alice`, `git_author_commits{author="DOMAIN\\alice"} 1`},
+		{"quote", `Alice "Al" Smith`, `git_author_commits{author="Alice \"Al\" Smith"} 1`},
+		{"newline", "Alice\nSmith", `git_author_commits{author="Alice\nSmith"} 1`},
+		{"all", "\\\"\n", `git_author_commits{author="\\\"\n"} 1`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out strings.Builder
+			mw := newMetricsWriter(&out, nil)
+			mw.sample(
+				"git_author_commits",
+				[]metricLabel{{"author", test.value}},
+				1,
+			)
+			if err := mw.close(); err != nil {
+				t.Fatalf("close() returned error: %v", err)
+			}
+
+			expected := []string{test.exp, "# EOF"}
+			if diff := cmp.Diff(expected, outputLines(out.String())); diff != "" {
+				t.Errorf("sample is wrong:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMetricsTableOutput(t *testing.T) {
+	setProgStart(t, time.Unix(1700000000, 0))
+
+	tallies := []tally.FinalTally{
+		{
+			AuthorName:   "Alice",
+			AuthorEmail:  "alice@mail.com",
+			Commits:      3,
+			LinesAdded:   10,
+			LinesRemoved: 2,
+			FileCount:    1,
+		},
+	}
+
+	var out strings.Builder
+	mw := newMetricsWriter(&out, []string{"src", "docs"})
+	mw.runInfo("HEAD")
+	mw.authors(tallies)
+	if err := mw.close(); err != nil {
+		t.Fatalf("close() returned error: %v", err)
+	}
+
+	lines := outputLines(out.String())
+
+	// Run duration changes from run to run
+	for i, line := range lines {
+		if strings.HasPrefix(line, "git_author_run_duration_seconds ") {
+			lines[i] = "git_author_run_duration_seconds X"
+		}
+	}
+
+	versionLabel := `version="` + labelEscaper.Replace(Version) + `"`
+	expected := []string{
+		"# HELP git_author_run Information about the git-author run.",
+		"# TYPE git_author_run info",
+		`git_author_run_info{` + versionLabel + `,revision="HEAD"} 1`,
+		"# HELP git_author_run_timestamp_seconds When git-author was run, " +
+			"in seconds since the epoch.",
+		"# TYPE git_author_run_timestamp_seconds gauge",
+		"git_author_run_timestamp_seconds 1700000000",
+		"# HELP git_author_run_duration_seconds How long git-author took to " +
+			"tally commits.",
+		"# TYPE git_author_run_duration_seconds gauge",
+		"git_author_run_duration_seconds X",
+		"# HELP git_author_commits Number of commits by the author.",
+		"# TYPE git_author_commits gauge",
+		`git_author_commits{author="Alice",email="alice@mail.com",path="src docs"} 3`,
+		"# HELP git_author_lines_added Number of lines added by the author.",
+		"# TYPE git_author_lines_added gauge",
+		`git_author_lines_added{author="Alice",email="alice@mail.com",path="src docs"} 10`,
+		"# HELP git_author_lines_removed Number of lines removed by the author.",
+		"# TYPE git_author_lines_removed gauge",
+		`git_author_lines_removed{author="Alice",email="alice@mail.com",path="src docs"} 2`,
+		"# HELP git_author_files Number of files edited by the author.",
+		"# TYPE git_author_files gauge",
+		`git_author_files{author="Alice",email="alice@mail.com",path="src docs"} 1`,
+		"# EOF",
+	}
+
+	if diff := cmp.Diff(expected, lines); diff != "" {
+		t.Errorf("metrics are wrong:\n%s", diff)
+	}
+}
+
+func TestMetricsEndWithEOF(t *testing.T) {
+	out := captureStdout(t, func() error {
+		return writeTableMetrics([]tally.FinalTally{}, []string{"HEAD"}, nil)
+	})
+
+	if !strings.HasSuffix(out, "\n# EOF\n") {
+		t.Errorf("expected metrics to end with # EOF, got:\n%s", out)
+	}
+	if strings.Count(out, "# EOF") != 1 {
+		t.Errorf("expected exactly one # EOF, got:\n%s", out)
+	}
+}
@@ -3,19 +3,22 @@ package main
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
+	"iter"
 	"os"
 	"time"
 
 	"github.com/trinhminhtriet/git-author/internal/git"
 )
 
-// Just prints out a simple representation of the commits parsed from `git log`
-// for debugging.
+// Prints out the commits parsed from `git log`, either as a simple
+// representation for debugging or as one JSON object per line for export.
 func parse(
 	revs []string,
 	pathspecs []string,
 	short bool,
+	outputFormat string,
 	since string,
 	until string,
 	authors []string,
@@ -35,6 +38,8 @@ func parse(
 		pathspecs,
 		"short",
 		short,
+		"outputFormat",
+		outputFormat,
 		"since",
 		since,
 		"until",
@@ -70,6 +75,15 @@ func parse(
 
 	w := bufio.NewWriter(os.Stdout)
 
+	if outputFormat == "ndjson" {
+		err = writeCommitsNDJSON(w, commits)
+		if err != nil {
+			return err
+		}
+
+		return closer()
+	}
+
 	numCommits := 0
 	for commit, err := range commits {
 		if err != nil {
@@ -101,3 +115,28 @@ func parse(
 
 	return nil
 }
+
+// Writes each commit as it is parsed, so that large histories can be exported
+// without holding them in memory.
+func writeCommitsNDJSON(
+	w *bufio.Writer,
+	commits iter.Seq2[git.Commit, error],
+) error {
+	enc := json.NewEncoder(w)
+	for commit, err := range commits {
+		if err != nil {
+			w.Flush()
+			return fmt.Errorf("Error iterating commits: %w", err)
+		}
+
+		if err := enc.Encode(toJSONCommit(commit)); err != nil {
+			return fmt.Errorf("error writing JSON to stdout: %w", err)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error writing JSON to stdout: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/trinhminhtriet/git-author/internal/format"
+	"github.com/trinhminhtriet/git-author/internal/git"
+	"github.com/trinhminhtriet/git-author/internal/tally"
+)
+
+//go:embed report.html.tmpl
+var reportTemplateSrc string
+
+// Max number of files and directories listed on an author's page
+const reportListLimit = 25
+
+type reportData struct {
+	Title     string
+	Generated string
+	Mode      string
+	DiffMode  bool
+	Authors   []reportAuthor
+	HistSVG   template.HTML
+	Tree      reportTreeNode
+	Colors    map[string]string
+}
+
+type reportAuthor struct {
+	ID        string
+	Name      string
+	Email     string
+	Color     string
+	Commits   string
+	Added     string
+	Removed   string
+	Files     string
+	FirstEdit string
+	LastEdit  string
+	TopFiles  []reportFile
+	OwnedDirs []string
+}
+
+type reportFile struct {
+	Path    string
+	Commits string
+	Added   string
+	Removed string
+}
+
+// Node of the treemap. Serialized to JSON for the script in the page.
+type reportTreeNode struct {
+	Name     string           `json:"name"`
+	Size     int64            `json:"size"`
+	Owner    string           `json:"owner"`
+	Children []reportTreeNode `json:"children,omitempty"`
+}
+
+// The "report" subcommand writes a single HTML file containing the table,
+// tree and hist views of the given commits and paths.
+func report(
+	revs []string,
+	pathspecs []string,
+	mode tally.TallyMode,
+	outPath string,
+	showEmail bool,
+	countMerges bool,
+	includeGenerated bool,
+	since string,
+	until string,
+	authors []string,
+	nauthors []string,
+) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("error running \"report\": %w", err)
+		}
+	}()
+
+	logger().Debug(
+		"called report()",
+		"revs",
+		revs,
+		"pathspecs",
+		pathspecs,
+		"mode",
+		mode,
+		"outPath",
+		outPath,
+		"showEmail",
+		showEmail,
+		"countMerges",
+		countMerges,
+		"includeGenerated",
+		includeGenerated,
+		"since",
+		since,
+		"until",
+		until,
+		"authors",
+		authors,
+		"nauthors",
+		nauthors,
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// We always need diffs, for the treemap and the author pages
+	tallyOpts := tally.TallyOpts{Mode: tally.LinesMode, CountMerges: countMerges}
+	if showEmail {
+		tallyOpts.Key = func(c git.Commit) string { return c.AuthorEmail }
+		tallyOpts.KeyName = "email"
+	} else {
+		tallyOpts.Key = func(c git.Commit) string { return c.AuthorName }
+		tallyOpts.KeyName = "name"
+	}
+
+	if !includeGenerated {
+		excluder, err := newPathExcluder(ctx, rangeTip(revs))
+		if err != nil {
+			return err
+		}
+		defer excluder.Close()
+
+		tallyOpts.ExcludePath = excluder.IsExcluded
+	}
+
+	filters := git.LogFilters{
+		Since:    since,
+		Until:    until,
+		Authors:  authors,
+		Nauthors: nauthors,
+	}
+
+	// -- Tally everything from the same commits --
+	var end time.Time
+	if len(revs) == 1 && revs[0] == "HEAD" && len(until) == 0 {
+		end = time.Now()
+	}
+
+	talliesByPath, buckets, err := tallyByPathAndTimeline(
+		ctx,
+		revs,
+		pathspecs,
+		filters,
+		tallyOpts,
+		end,
+	)
+	if err != nil {
+		return err
+	}
+
+	if len(talliesByPath) == 0 {
+		return errors.New("no commits to report on")
+	}
+
+	rankedTallies := tally.Rank(talliesByPath.Reduce(), mode)
+
+	for i, bucket := range buckets {
+		buckets[i] = bucket.Rank(mode)
+	}
+
+	wtreeset, err := git.TreeFiles(rangeTip(revs))
+	if err != nil {
+		return err
+	}
+
+	prefix, err := git.GetPrefix()
+	if err != nil {
+		return err
+	}
+
+	root, err := tally.TallyCommitsTreeFromPaths(talliesByPath, wtreeset, prefix)
+	if err != nil {
+		return err
+	}
+	root = root.Rank(mode)
+
+	// -- Assemble the page --
+	var histSVG strings.Builder
+	err = writeHistSVG(&histSVG, buckets, svgChartOpts{
+		width:     900,
+		height:    260,
+		mode:      mode,
+		showEmail: showEmail,
+	})
+	if err != nil {
+		return err
+	}
+
+	title := "git-author report"
+	if gitRoot, err := git.GetRoot(); err == nil {
+		title = fmt.Sprintf("%s: %s", title, filepath.Base(gitRoot))
+	}
+
+	data := reportData{
+		Title:     title,
+		Generated: progStart.Format(time.RFC1123),
+		Mode:      modeName(mode),
+		DiffMode:  mode == tally.LinesMode || mode == tally.FilesMode,
+		HistSVG:   template.HTML(histSVG.String()),
+		Tree:      toReportTree(root, ".", mode, showEmail),
+		Colors:    map[string]string{},
+	}
+
+	for i, t := range rankedTallies {
+		key := svgAuthor(t, showEmail)
+		author := reportAuthor{
+			ID:        fmt.Sprintf("author-%d", i+1),
+			Name:      t.AuthorName,
+			Email:     t.AuthorEmail,
+			Color:     authorColor(key),
+			Commits:   format.Number(t.Commits),
+			Added:     format.Number(t.LinesAdded),
+			Removed:   format.Number(t.LinesRemoved),
+			Files:     format.Number(t.FileCount),
+			FirstEdit: format.RelativeTime(progStart, t.FirstCommitTime),
+			LastEdit:  format.RelativeTime(progStart, t.LastCommitTime),
+			TopFiles:  topReportFiles(talliesByPath[key], prefix),
+			OwnedDirs: ownedDirs(root, ".", key, showEmail, []string{}),
+		}
+
+		data.Authors = append(data.Authors, author)
+		data.Colors[key] = author.Color
+	}
+
+	tmpl, err := template.New("report").Parse(reportTemplateSrc)
+	if err != nil {
+		return fmt.Errorf("could not parse report template: %w", err)
+	}
+
+	f, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = tmpl.Execute(f, data)
+	if err != nil {
+		return fmt.Errorf("could not write report: %w", err)
+	}
+
+	return f.Close()
+}
+
+func toReportTree(
+	node *tally.TreeNode,
+	name string,
+	mode tally.TallyMode,
+	showEmail bool,
+) reportTreeNode {
+	reportNode := reportTreeNode{
+		Name:  name,
+		Owner: svgAuthor(node.Tally, showEmail),
+	}
+
+	if len(node.Children) == 0 {
+		reportNode.Size = leafSize(node, mode)
+		return reportNode
+	}
+
+	childPaths := sortChildPaths(
+		node.Children,
+		func(child *tally.TreeNode) bool { return len(child.Children) > 0 },
+	)
+	for _, p := range childPaths {
+		child := node.Children[p]
+		if p == tally.NoDiffPathname || !child.InWorkTree {
+			continue
+		}
+
+		reportChild := toReportTree(child, p, mode, showEmail)
+		reportNode.Size += reportChild.Size
+		reportNode.Children = append(reportNode.Children, reportChild)
+	}
+
+	return reportNode
+}
+
+// Area given to a file in the treemap. Every file gets at least a sliver.
+func leafSize(node *tally.TreeNode, mode tally.TallyMode) int64 {
+	switch mode {
+	case tally.LinesMode:
+		var size int64
+		for _, t := range node.Authors(mode) {
+			size += int64(t.LinesAdded + t.LinesRemoved)
+		}
+		return max(size, 1)
+	case tally.FilesMode:
+		return 1
+	default:
+		return max(int64(node.TotalCommits()), 1)
+	}
+}
+
+// Files the author edited the most, by lines added and removed.
+func topReportFiles(
+	pathTallies map[string]tally.Tally,
+	prefix string,
+) []reportFile {
+	type pathTally struct {
+		path  string
+		tally tally.FinalTally
+	}
+
+	sorted := []pathTally{}
+	for path, t := range pathTallies {
+		if path == tally.NoDiffPathname || !strings.HasPrefix(path, prefix) {
+			continue
+		}
+
+		sorted = append(sorted, pathTally{path, t.Final()})
+	}
+
+	slices.SortFunc(sorted, func(a, b pathTally) int {
+		aLines := a.tally.LinesAdded + a.tally.LinesRemoved
+		bLines := b.tally.LinesAdded + b.tally.LinesRemoved
+		if aLines != bLines {
+			return bLines - aLines
+		}
+
+		return strings.Compare(a.path, b.path)
+	})
+
+	files := []reportFile{}
+	for _, pt := range sorted[:min(len(sorted), reportListLimit)] {
+		files = append(files, reportFile{
+			Path:    strings.TrimPrefix(pt.path, prefix),
+			Commits: format.Number(pt.tally.Commits),
+			Added:   format.Number(pt.tally.LinesAdded),
+			Removed: format.Number(pt.tally.LinesRemoved),
+		})
+	}
+
+	return files
+}
+
+// Directories in the working tree where the author is the top author, in the
+// order they appear in the tree.
+func ownedDirs(
+	node *tally.TreeNode,
+	path string,
+	key string,
+	showEmail bool,
+	dirs []string,
+) []string {
+	if len(node.Children) == 0 || !node.InWorkTree {
+		return dirs
+	}
+
+	if svgAuthor(node.Tally, showEmail) == key {
+		dirs = append(dirs, path+"/")
+	}
+
+	childPaths := sortChildPaths(
+		node.Children,
+		func(child *tally.TreeNode) bool { return len(child.Children) > 0 },
+	)
+	for _, p := range childPaths {
+		if len(dirs) >= reportListLimit {
+			break
+		}
+
+		dirs = ownedDirs(
+			node.Children[p],
+			filepath.ToSlash(filepath.Join(path, p)),
+			key,
+			showEmail,
+			dirs,
+		)
+	}
+
+	return dirs
+}
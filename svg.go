@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/trinhminhtriet/git-author/internal/format"
+	"github.com/trinhminhtriet/git-author/internal/tally"
+)
+
+type svgChartOpts struct {
+	width     int
+	height    int
+	mode      tally.TallyMode
+	showEmail bool
+}
+
+// Space around the plot area for axis labels
+const (
+	svgMarginTop    = 20
+	svgMarginRight  = 20
+	svgMarginBottom = 40
+	svgMarginLeft   = 60
+)
+
+// Parses a chart size given as WIDTHxHEIGHT, e.g. "800x300".
+func parseChartSize(s string) (int, int, error) {
+	before, after, found := strings.Cut(s, "x")
+	if !found {
+		return 0, 0, fmt.Errorf("invalid size \"%s\": expected WIDTHxHEIGHT", s)
+	}
+
+	width, err := strconv.Atoi(before)
+	if err != nil || width <= 0 {
+		return 0, 0, fmt.Errorf("invalid width in size \"%s\"", s)
+	}
+
+	height, err := strconv.Atoi(after)
+	if err != nil || height <= 0 {
+		return 0, 0, fmt.Errorf("invalid height in size \"%s\"", s)
+	}
+
+	return width, height, nil
+}
+
+// Picks a stable color for an author, so that they look the same everywhere in
+// a report.
+func authorColor(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	hue := float64(h.Sum32() % 360)
+
+	// Convert from HSL with a saturation of 55% and a lightness of 50%
+	const chroma = 0.55
+	x := chroma * (1 - math.Abs(math.Mod(hue/60, 2)-1))
+
+	var r, g, b float64
+	switch {
+	case hue < 60:
+		r, g, b = chroma, x, 0
+	case hue < 120:
+		r, g, b = x, chroma, 0
+	case hue < 180:
+		r, g, b = 0, chroma, x
+	case hue < 240:
+		r, g, b = 0, x, chroma
+	case hue < 300:
+		r, g, b = x, 0, chroma
+	default:
+		r, g, b = chroma, 0, x
+	}
+
+	m := 0.5 - chroma/2
+	return fmt.Sprintf(
+		"#%02x%02x%02x",
+		int(math.Round((r+m)*255)),
+		int(math.Round((g+m)*255)),
+		int(math.Round((b+m)*255)),
+	)
+}
+
+func svgAuthor(t tally.FinalTally, showEmail bool) string {
+	if showEmail {
+		return t.AuthorEmail
+	}
+
+	return t.AuthorName
+}
+
+// Authors beyond this many are lumped together as "Other"
+const svgMaxSeries = 8
+
+const svgOtherColor = "#bbb"
+
+// Renders the timeline as a stacked bar chart with a bar for each bucket and a
+// segment in each bar for each of the top authors.
+func writeHistSVG(
+	w io.Writer,
+	buckets []tally.TimeBucket,
+	opts svgChartOpts,
+) error {
+	bw := bufio.NewWriter(w)
+
+	series, hasOther := topSeries(buckets, opts)
+
+	// -- Lay out legend --
+	type legendItem struct {
+		label string
+		color string
+		x     int
+		y     int
+	}
+
+	legend := []legendItem{}
+	for _, key := range series {
+		legend = append(legend, legendItem{key, authorColor(key), 0, 0})
+	}
+	if hasOther {
+		legend = append(legend, legendItem{"Other", svgOtherColor, 0, 0})
+	}
+
+	legendX := svgMarginLeft
+	legendY := 0
+	for i := range legend {
+		width := 16 + 7*utf8.RuneCountInString(legend[i].label) + 16
+		if legendX+width > opts.width-svgMarginRight && legendX > svgMarginLeft {
+			legendX = svgMarginLeft
+			legendY += 16
+		}
+		legend[i].x = legendX
+		legend[i].y = legendY
+		legendX += width
+	}
+	legendHeight := legendY + 16
+
+	plotWidth := opts.width - svgMarginLeft - svgMarginRight
+	plotHeight := opts.height - svgMarginTop - svgMarginBottom - legendHeight
+	if plotWidth <= 0 || plotHeight <= 0 {
+		return fmt.Errorf(
+			"chart size %dx%d is too small",
+			opts.width,
+			opts.height,
+		)
+	}
+
+	// Scale to the tallest stack, which in files mode can be taller than the
+	// bucket total
+	maxVal := 1
+	for _, bucket := range buckets {
+		values, other := barSegments(bucket, series, opts)
+		height := other
+		for _, value := range values {
+			height += value
+		}
+		maxVal = max(maxVal, height)
+	}
+
+	fmt.Fprintf(
+		bw,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" `+
+			`viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`+"\n",
+		opts.width,
+		opts.height,
+		opts.width,
+		opts.height,
+	)
+
+	// -- Axes --
+	bottom := svgMarginTop + plotHeight
+	fmt.Fprintf(
+		bw,
+		`<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#888"/>`+"\n",
+		svgMarginLeft,
+		svgMarginTop,
+		svgMarginLeft,
+		bottom,
+	)
+	fmt.Fprintf(
+		bw,
+		`<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#888"/>`+"\n",
+		svgMarginLeft,
+		bottom,
+		svgMarginLeft+plotWidth,
+		bottom,
+	)
+	fmt.Fprintf(
+		bw,
+		`<text transform="translate(14 %d) rotate(-90)" `+
+			`text-anchor="middle">%s</text>`+"\n",
+		svgMarginTop+plotHeight/2,
+		modeName(opts.mode),
+	)
+
+	for _, frac := range []float64{0, 0.25, 0.5, 0.75, 1} {
+		y := float64(bottom) - frac*float64(plotHeight)
+		fmt.Fprintf(
+			bw,
+			`<text x="%d" y="%.1f" text-anchor="end" `+
+				`dominant-baseline="middle">%s</text>`+"\n",
+			svgMarginLeft-6,
+			y,
+			format.Number(int(math.Round(frac*float64(maxVal)))),
+		)
+	}
+
+	// -- Bars --
+	if len(buckets) > 0 {
+		slot := float64(plotWidth) / float64(len(buckets))
+		barWidth := max(slot*0.8, 1)
+
+		// Leave about 80px between labels on the x axis
+		labelEvery := max(1, int(math.Ceil(80/slot)))
+
+		for i, bucket := range buckets {
+			x := float64(svgMarginLeft) + float64(i)*slot + (slot-barWidth)/2
+			writeSVGBar(
+				bw,
+				bucket,
+				series,
+				x,
+				barWidth,
+				bottom,
+				plotHeight,
+				maxVal,
+				opts,
+			)
+
+			if i%labelEvery == 0 {
+				fmt.Fprintf(
+					bw,
+					`<text x="%.1f" y="%d" text-anchor="middle">%s</text>`+"\n",
+					x+barWidth/2,
+					bottom+16,
+					html.EscapeString(bucket.Name),
+				)
+			}
+		}
+	}
+
+	// -- Legend --
+	legendTop := bottom + svgMarginBottom - 8
+	for _, item := range legend {
+		fmt.Fprintf(
+			bw,
+			`<rect x="%d" y="%d" width="12" height="12" fill="%s"/>`+"\n",
+			item.x,
+			legendTop+item.y,
+			item.color,
+		)
+		fmt.Fprintf(
+			bw,
+			`<text x="%d" y="%d">%s</text>`+"\n",
+			item.x+16,
+			legendTop+item.y+10,
+			html.EscapeString(item.label),
+		)
+	}
+
+	fmt.Fprintln(bw, "</svg>")
+	return bw.Flush()
+}
+
+// Draws one bar, with the segments for the top authors at the bottom in the
+// order of the legend and everyone else at the top.
+func writeSVGBar(
+	w io.Writer,
+	bucket tally.TimeBucket,
+	series []string,
+	x float64,
+	barWidth float64,
+	bottom int,
+	plotHeight int,
+	maxVal int,
+	opts svgChartOpts,
+) {
+	total := bucket.TotalValue(opts.mode)
+	if total == 0 {
+		return
+	}
+
+	values, other := barSegments(bucket, series, opts)
+
+	fmt.Fprintf(
+		w,
+		`<g><title>%s: %s total</title>`+"\n",
+		html.EscapeString(bucket.Name),
+		format.Number(total),
+	)
+
+	y := float64(bottom)
+	for _, key := range series {
+		value := values[key]
+		if value == 0 {
+			continue
+		}
+
+		height := float64(value) / float64(maxVal) * float64(plotHeight)
+		y -= height
+		fmt.Fprintf(
+			w,
+			`<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s">`+
+				`<title>%s: %s (%s)</title></rect>`+"\n",
+			x,
+			y,
+			barWidth,
+			height,
+			authorColor(key),
+			html.EscapeString(bucket.Name),
+			html.EscapeString(key),
+			format.Number(value),
+		)
+	}
+
+	if other > 0 {
+		height := float64(other) / float64(maxVal) * float64(plotHeight)
+		fmt.Fprintf(
+			w,
+			`<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s">`+
+				`<title>%s: Other (%s)</title></rect>`+"\n",
+			x,
+			y-height,
+			barWidth,
+			height,
+			svgOtherColor,
+			html.EscapeString(bucket.Name),
+			format.Number(other),
+		)
+	}
+
+	fmt.Fprintln(w, "</g>")
+}
+
+// Returns the value of each of the top authors in the bucket, and what is left
+// of the bucket total for everyone else.
+//
+// In files mode authors can touch the same files, so the values of the top
+// authors can add up to more than the total. Everyone else then gets nothing.
+func barSegments(
+	bucket tally.TimeBucket,
+	series []string,
+	opts svgChartOpts,
+) (map[string]int, int) {
+	values := map[string]int{}
+	for _, t := range bucket.Authors(opts.mode) {
+		key := svgAuthor(t, opts.showEmail)
+		if slices.Contains(series, key) {
+			values[key] = int(t.SortKey(opts.mode))
+		}
+	}
+
+	other := bucket.TotalValue(opts.mode)
+	for _, value := range values {
+		other -= value
+	}
+
+	return values, max(other, 0)
+}
+
+// Picks the authors who contributed the most over the whole timeline. Also
+// returns whether anyone else contributed.
+func topSeries(
+	buckets []tally.TimeBucket,
+	opts svgChartOpts,
+) ([]string, bool) {
+	totals := map[string]int{}
+	for _, bucket := range buckets {
+		for _, t := range bucket.Authors(opts.mode) {
+			totals[svgAuthor(t, opts.showEmail)] += int(t.SortKey(opts.mode))
+		}
+	}
+
+	keys := slices.SortedFunc(maps.Keys(totals), func(a, b string) int {
+		if totals[a] != totals[b] {
+			return totals[b] - totals[a]
+		}
+
+		return strings.Compare(a, b)
+	})
+
+	if len(keys) > svgMaxSeries {
+		return keys[:svgMaxSeries], true
+	}
+
+	return keys, false
+}
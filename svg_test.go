@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trinhminhtriet/git-author/internal/git"
+	"github.com/trinhminhtriet/git-author/internal/tally"
+	"github.com/trinhminhtriet/git-author/internal/utils/iterutils"
+)
+
+// Makes a commit by author on day, touching each of paths.
+func svgCommit(author string, day int, paths ...string) git.Commit {
+	hash := fmt.Sprintf("%040x", len(author)*1000+day*10+len(paths))
+	commit := git.Commit{
+		Hash:        hash,
+		ShortHash:   hash[:7],
+		AuthorName:  author,
+		AuthorEmail: strings.ToLower(author) + "@mail.com",
+		Date:        time.Date(2025, 1, day, 12, 0, 0, 0, time.UTC),
+	}
+
+	for _, path := range paths {
+		commit.FileDiffs = append(commit.FileDiffs, git.FileDiff{
+			Path:       path,
+			LinesAdded: 2,
+		})
+	}
+
+	return commit
+}
+
+var (
+	svgLinePattern = regexp.MustCompile(
+		`<line x1="\d+" y1="\d+" x2="\d+" y2="(\d+)"`,
+	)
+	svgBarPattern = regexp.MustCompile(
+		`<rect x="[\d.]+" y="(-?[\d.]+)" width="[\d.]+" height="([\d.]+)" ` +
+			`fill="[^"]+"><title>([^<]*)</title>`,
+	)
+)
+
+func TestWriteHistSVGBarsStayInPlot(t *testing.T) {
+	authors := []string{"Alice", "Bob", "Carol", "Dave"}
+
+	// Everyone touches the same two of four files, so in files mode the
+	// authors' counts overlap
+	overlapping := []git.Commit{}
+	for i, author := range authors {
+		overlapping = append(overlapping, svgCommit(author, 1, "a.txt", "b.txt"))
+		overlapping = append(overlapping, svgCommit(author, 2+i, "a.txt"))
+	}
+	overlapping = append(overlapping, svgCommit("Alice", 6, "c.txt", "d.txt"))
+
+	// More authors than get their own series
+	crowded := []git.Commit{}
+	for i := range svgMaxSeries + 3 {
+		author := fmt.Sprintf("Author%02d", i)
+		crowded = append(crowded, svgCommit(author, 1+i%5, "a.txt", "b.txt"))
+	}
+
+	tests := []struct {
+		name    string
+		commits []git.Commit
+		mode    tally.TallyMode
+	}{
+		{"files_overlapping", overlapping, tally.FilesMode},
+		{"lines_overlapping", overlapping, tally.LinesMode},
+		{"commits_overlapping", overlapping, tally.CommitMode},
+		{"files_crowded", crowded, tally.FilesMode},
+		{"commits_crowded", crowded, tally.CommitMode},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := tally.TallyOpts{
+				Mode: test.mode,
+				Key:  func(c git.Commit) string { return c.AuthorName },
+			}
+
+			buckets, err := tally.TallyCommitsTimeline(
+				iterutils.WithoutErrors(slices.Values(test.commits)),
+				opts,
+				time.Time{},
+			)
+			if err != nil {
+				t.Fatalf("TallyCommitsTimeline() returned error: %v", err)
+			}
+			for i, bucket := range buckets {
+				buckets[i] = bucket.Rank(test.mode)
+			}
+
+			var out strings.Builder
+			err = writeHistSVG(&out, buckets, svgChartOpts{
+				width:  400,
+				height: 300,
+				mode:   test.mode,
+			})
+			if err != nil {
+				t.Fatalf("writeHistSVG() returned error: %v", err)
+			}
+			svg := out.String()
+
+			// The y axis runs from the top margin to the x axis
+			axis := svgLinePattern.FindStringSubmatch(svg)
+			if axis == nil {
+				t.Fatalf("no y axis in chart:\n%s", svg)
+			}
+			bottom, _ := strconv.ParseFloat(axis[1], 64)
+
+			bars := svgBarPattern.FindAllStringSubmatch(svg, -1)
+			if len(bars) == 0 {
+				t.Fatalf("no bars in chart:\n%s", svg)
+			}
+
+			top := bottom
+			for _, bar := range bars {
+				y, _ := strconv.ParseFloat(bar[1], 64)
+				height, _ := strconv.ParseFloat(bar[2], 64)
+
+				if height <= 0 {
+					t.Errorf("segment %q has height %.1f", bar[3], height)
+				}
+				if y < svgMarginTop-0.1 || y+height > bottom+0.1 {
+					t.Errorf(
+						"segment %q spans y %.1f to %.1f, outside plot from %d to %.1f",
+						bar[3],
+						y,
+						y+height,
+						svgMarginTop,
+						bottom,
+					)
+				}
+
+				top = min(top, y)
+			}
+
+			// The tallest bar fills the plot
+			if top > svgMarginTop+0.1 {
+				t.Errorf("tallest bar tops out at y %.1f, below plot top", top)
+			}
+		})
+	}
+}
@@ -5,14 +5,14 @@ import (
 	"encoding/csv"
 	"fmt"
 	"os"
-	"runtime"
+	"slices"
 	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
 	runewidth "github.com/mattn/go-runewidth"
 
-	"github.com/trinhminhtriet/git-author/internal/concurrent"
 	"github.com/trinhminhtriet/git-author/internal/format"
 	"github.com/trinhminhtriet/git-author/internal/git"
 	"github.com/trinhminhtriet/git-author/internal/pretty"
@@ -36,10 +36,14 @@ func pickWidth(mode tally.TallyMode, showEmail bool) int {
 func table(
 	revs []string,
 	pathspecs []string,
+	fromPath string,
 	mode tally.TallyMode,
-	useCsv bool,
+	outputFormat string,
+	tmpl *template.Template,
+	renderer *pretty.Renderer,
 	showEmail bool,
 	countMerges bool,
+	includeGenerated bool,
 	limit int,
 	since string,
 	until string,
@@ -58,14 +62,20 @@ func table(
 		revs,
 		"pathspecs",
 		pathspecs,
+		"fromPath",
+		fromPath,
 		"mode",
 		mode,
-		"useCsv",
-		useCsv,
+		"outputFormat",
+		outputFormat,
+		"template",
+		tmpl != nil,
 		"showEmail",
 		showEmail,
 		"countMerges",
 		countMerges,
+		"includeGenerated",
+		includeGenerated,
 		"limit",
 		limit,
 		"since",
@@ -82,13 +92,28 @@ func table(
 	defer cancel()
 
 	tallyOpts := tally.TallyOpts{Mode: mode, CountMerges: countMerges}
+	if outputFormat == "openmetrics" && !tallyOpts.IsDiffMode() {
+		tallyOpts.Mode = tally.LinesMode // Need diffs for line and file gauges
+	}
+
 	if showEmail {
 		tallyOpts.Key = func(c git.Commit) string { return c.AuthorEmail }
+		tallyOpts.KeyName = "email"
 	} else {
 		tallyOpts.Key = func(c git.Commit) string { return c.AuthorName }
+		tallyOpts.KeyName = "name"
+	}
+
+	if !includeGenerated && tallyOpts.IsDiffMode() {
+		excluder, err := excluderFor(ctx, fromPath, rangeTip(revs))
+		if err != nil {
+			return err
+		}
+		defer excluder.Close()
+
+		tallyOpts.ExcludePath = excluder.IsExcluded
 	}
 
-	populateDiffs := tallyOpts.IsDiffMode()
 	filters := git.LogFilters{
 		Since:    since,
 		Until:    until,
@@ -96,63 +121,54 @@ func table(
 		Nauthors: nauthors,
 	}
 
-	var tallies map[string]tally.Tally
-	if populateDiffs && runtime.GOMAXPROCS(0) > 1 {
-		tallies, err = concurrent.TallyCommits(
-			ctx,
-			revs,
-			pathspecs,
-			filters,
-			tallyOpts,
-			getCache(),
-			pretty.AllowDynamic(os.Stdout),
-		)
-		if err != nil {
-			return err
-		}
-	} else {
-		// This is fast in the no-diff case even if we don't parallelize it
-		commits, closer, err := git.CommitsWithOpts(
-			ctx,
-			revs,
-			pathspecs,
-			filters,
-			populateDiffs,
-		)
-		if err != nil {
-			return err
-		}
-
-		tallies, err = tally.TallyCommits(commits, tallyOpts)
-		if err != nil {
-			return fmt.Errorf("failed to tally commits: %w", err)
-		}
-
-		err = closer()
-		if err != nil {
-			return err
-		}
+	tallies, err := tallyAuthors(
+		ctx,
+		fromPath,
+		revs,
+		pathspecs,
+		filters,
+		tallyOpts,
+	)
+	if err != nil {
+		return err
 	}
 
 	rankedTallies := tally.Rank(tallies, mode)
 
+	if outputFormat == "openmetrics" {
+		return writeTableMetrics(rankedTallies, revs, pathspecs)
+	}
+
 	numFilteredOut := 0
 	if limit > 0 && limit < len(rankedTallies) {
 		numFilteredOut = len(rankedTallies) - limit
 		rankedTallies = rankedTallies[:limit]
 	}
 
-	if useCsv {
-		err := writeCsv(rankedTallies, tallyOpts, showEmail)
-		if err != nil {
-			return err
-		}
-	} else {
-		colwidth := pickWidth(mode, showEmail)
-		writeTable(rankedTallies, colwidth, showEmail, mode, numFilteredOut)
+	if tmpl != nil {
+		return writeTemplateRows(tmpl, rankedTallies)
 	}
 
-	return nil
+	switch outputFormat {
+	case "csv":
+		return writeCsv(rankedTallies, tallyOpts, showEmail)
+	case "json":
+		return writeTableJSON(rankedTallies, mode)
+	case "markdown":
+		writeTableMarkdown(rankedTallies, showEmail, mode, numFilteredOut)
+		return nil
+	default:
+		colwidth := pickWidth(mode, showEmail)
+		writeTable(
+			renderer,
+			rankedTallies,
+			colwidth,
+			showEmail,
+			mode,
+			numFilteredOut,
+		)
+		return renderer.Flush()
+	}
 }
 
 func toRecord(
@@ -184,14 +200,8 @@ func toRecord(
 	)
 }
 
-func writeCsv(
-	tallies []tally.FinalTally,
-	opts tally.TallyOpts,
-	showEmail bool,
-) error {
-	w := csv.NewWriter(os.Stdout)
-
-	// Write header
+// Column headers for the fields returned by toRecord().
+func toRecordHeaders(opts tally.TallyOpts, showEmail bool) []string {
 	columnHeaders := []string{"name"}
 	if showEmail {
 		columnHeaders = append(columnHeaders, "email")
@@ -208,8 +218,18 @@ func writeCsv(
 		)
 	}
 
-	columnHeaders = append(columnHeaders, "last commit time", "first commit time")
-	w.Write(columnHeaders)
+	return append(columnHeaders, "last commit time", "first commit time")
+}
+
+func writeCsv(
+	tallies []tally.FinalTally,
+	opts tally.TallyOpts,
+	showEmail bool,
+) error {
+	w := csv.NewWriter(os.Stdout)
+
+	// Write header
+	w.Write(toRecordHeaders(opts, showEmail))
 
 	for _, tally := range tallies {
 		record := toRecord(tally, opts, showEmail)
@@ -232,24 +252,153 @@ func formatAuthor(
 	showEmail bool,
 	width int,
 ) string {
-	var author string
+	author := fmtTableAuthor(t, showEmail)
+	author = format.Abbrev(author, width)
+	return runewidth.FillRight(author, width)
+}
+
+func fmtTableAuthor(t tally.FinalTally, showEmail bool) string {
 	if showEmail {
-		author = fmt.Sprintf(
+		return fmt.Sprintf(
 			"%s %s",
 			t.AuthorName,
 			format.GitEmail(t.AuthorEmail),
 		)
-	} else {
-		author = t.AuthorName
 	}
 
-	author = format.Abbrev(author, width)
-	return runewidth.FillRight(author, width)
+	return t.AuthorName
+}
+
+// A column of the table after the author column.
+type tableColumn struct {
+	header    string
+	width     int
+	gap       int // Spaces before the column
+	alignLeft bool
+	required  bool // Shows the metric we sort by, so never dropped
+	value     func(t tally.FinalTally) string
+}
+
+func (c tableColumn) totalWidth() int {
+	return c.gap + c.width
+}
+
+// Returns the columns shown after the author column for the given mode.
+func tableColumns(r *pretty.Renderer, mode tally.TallyMode) []tableColumn {
+	edit := tableColumn{
+		header:    "Last Edit",
+		width:     11,
+		gap:       1,
+		alignLeft: true,
+		required:  mode == tally.LastModifiedMode,
+		value: func(t tally.FinalTally) string {
+			return format.RelativeTime(progStart, t.LastCommitTime)
+		},
+	}
+	if mode == tally.FirstModifiedMode {
+		edit.header = "First Edit"
+		edit.required = true
+		edit.value = func(t tally.FinalTally) string {
+			return format.RelativeTime(progStart, t.FirstCommitTime)
+		}
+	}
+
+	commits := tableColumn{
+		header:   "Commits",
+		width:    7,
+		gap:      1,
+		required: mode == tally.CommitMode,
+		value: func(t tally.FinalTally) string {
+			return format.Number(t.Commits)
+		},
+	}
+
+	if mode != tally.LinesMode && mode != tally.FilesMode {
+		return []tableColumn{edit, commits}
+	}
+
+	files := tableColumn{
+		header:   "Files",
+		width:    7,
+		gap:      1,
+		required: mode == tally.FilesMode,
+		value: func(t tally.FinalTally) string {
+			return format.Number(t.FileCount)
+		},
+	}
+
+	lines := tableColumn{
+		header:   "Lines (+/-)",
+		width:    17,
+		gap:      2,
+		required: mode == tally.LinesMode,
+		value: func(t tally.FinalTally) string {
+			return fmt.Sprintf(
+				"%s / %s",
+				r.Green(fmt.Sprintf("%7s", format.Number(t.LinesAdded))),
+				r.Red(fmt.Sprintf("%7s", format.Number(t.LinesRemoved))),
+			)
+		},
+	}
+
+	return []tableColumn{edit, commits, files, lines}
+}
+
+// Narrowest the author column gets before we start dropping other columns.
+const minAuthorWidth = 10
+
+// Picks the width of the table and the columns that fit in it.
+//
+// Without a width limit, the table is as wide as it has always been. With
+// one, the author column grows to fit the longest author, and columns that
+// aren't required are dropped if the table doesn't fit otherwise.
+func layoutTable(
+	columns []tableColumn,
+	tallies []tally.FinalTally,
+	defaultWidth int,
+	showEmail bool,
+	limit int,
+) (int, []tableColumn) {
+	fixedWidth := 2 // Borders
+	for _, c := range columns {
+		fixedWidth += c.totalWidth()
+	}
+
+	if limit == 0 {
+		return defaultWidth, columns
+	}
+
+	// Drop columns in this order until the table fits
+	dropOrder := []string{"Files", "Last Edit", "Commits"}
+	for _, header := range dropOrder {
+		if fixedWidth+minAuthorWidth <= limit {
+			break
+		}
+
+		i := slices.IndexFunc(columns, func(c tableColumn) bool {
+			return c.header == header && !c.required
+		})
+		if i >= 0 {
+			fixedWidth -= columns[i].totalWidth()
+			columns = slices.Delete(slices.Clone(columns), i, i+1)
+		}
+	}
+
+	longest := 0
+	for _, t := range tallies {
+		longest = max(longest, runewidth.StringWidth(fmtTableAuthor(t, showEmail)))
+	}
+
+	width := max(defaultWidth, fixedWidth+longest)
+	width = min(width, limit)
+	width = max(width, fixedWidth+minAuthorWidth)
+	return width, columns
 }
 
 func writeTable(
+	r *pretty.Renderer,
 	tallies []tally.FinalTally,
-	colwidth int,
+	defaultWidth int,
 	showEmail bool,
 	mode tally.TallyMode,
 	numFilteredOut int,
@@ -258,86 +407,65 @@ func writeTable(
 		return
 	}
 
-	var build strings.Builder
-	for _ = range colwidth - 2 {
-		build.WriteRune('─')
+	colwidth, columns := layoutTable(
+		tableColumns(r, mode),
+		tallies,
+		defaultWidth,
+		showEmail,
+		r.Width,
+	)
+
+	authorWidth := colwidth - 2
+	for _, c := range columns {
+		authorWidth -= c.totalWidth()
+	}
+
+	g := r.Glyphs
+	rule := strings.Repeat(g.Horizontal, colwidth-2)
+
+	writeRow := func(author string, cells []string) {
+		var b strings.Builder
+		b.WriteString(g.Vertical)
+		b.WriteString(author)
+		for i, c := range columns {
+			b.WriteString(strings.Repeat(" ", c.gap))
+
+			pad := strings.Repeat(" ", max(c.width-visibleLen(cells[i]), 0))
+			if c.alignLeft {
+				b.WriteString(cells[i] + pad)
+			} else {
+				b.WriteString(pad + cells[i])
+			}
+		}
+		b.WriteString(g.Vertical)
+		r.Printf("%s\n", b.String())
 	}
-	rule := build.String()
 
 	// -- Write header --
-	fmt.Printf("┌%s┐\n", rule)
-
-	if mode == tally.LinesMode || mode == tally.FilesMode {
-		fmt.Printf(
-			"│%-*s %-11s %7s %7s  %17s│\n",
-			colwidth-36-13,
-			"Author",
-			"Last Edit",
-			"Commits",
-			"Files",
-			"Lines (+/-)",
-		)
-	} else if mode == tally.FirstModifiedMode {
-		fmt.Printf(
-			"│%-*s %-11s %7s│\n",
-			colwidth-22,
-			"Author",
-			"First Edit",
-			"Commits",
-		)
-	} else {
-		fmt.Printf(
-			"│%-*s %-11s %7s│\n",
-			colwidth-22,
-			"Author",
-			"Last Edit",
-			"Commits",
-		)
+	r.Printf("%s%s%s\n", g.TopLeft, rule, g.TopRight)
+
+	headers := []string{}
+	for _, c := range columns {
+		headers = append(headers, c.header)
 	}
-	fmt.Printf("├%s┤\n", rule)
+	writeRow(runewidth.FillRight("Author", authorWidth), headers)
+
+	r.Printf("%s%s%s\n", g.LeftTee, rule, g.RightTee)
 
 	// -- Write table rows --
 	for _, t := range tallies {
-		lines := fmt.Sprintf(
-			"%s%7s%s / %s%7s%s",
-			pretty.Green,
-			format.Number(t.LinesAdded),
-			pretty.Reset,
-			pretty.Red,
-			format.Number(t.LinesRemoved),
-			pretty.Reset,
-		)
-
-		if mode == tally.LinesMode || mode == tally.FilesMode {
-			fmt.Printf(
-				"│%s %-11s %7s %7s  %17s│\n",
-				formatAuthor(t, showEmail, colwidth-36-13),
-				format.RelativeTime(progStart, t.LastCommitTime),
-				format.Number(t.Commits),
-				format.Number(t.FileCount),
-				lines,
-			)
-		} else if mode == tally.FirstModifiedMode {
-			fmt.Printf(
-				"│%s %-11s %7s│\n",
-				formatAuthor(t, showEmail, colwidth-22),
-				format.RelativeTime(progStart, t.FirstCommitTime),
-				format.Number(t.Commits),
-			)
-		} else {
-			fmt.Printf(
-				"│%s %-11s %7s│\n",
-				formatAuthor(t, showEmail, colwidth-22),
-				format.RelativeTime(progStart, t.LastCommitTime),
-				format.Number(t.Commits),
-			)
+		cells := []string{}
+		for _, c := range columns {
+			cells = append(cells, c.value(t))
 		}
+
+		writeRow(formatAuthor(t, showEmail, authorWidth), cells)
 	}
 
 	if numFilteredOut > 0 {
 		msg := fmt.Sprintf("...%s more...", format.Number(numFilteredOut))
-		fmt.Printf("│%-*s│\n", colwidth-2, msg)
+		r.Printf("%s%-*s%s\n", g.Vertical, colwidth-2, msg, g.Vertical)
 	}
 
-	fmt.Printf("└%s┘\n", rule)
+	r.Printf("%s%s%s\n", g.BottomLeft, rule, g.BottomRight)
 }
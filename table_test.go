@@ -0,0 +1,201 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mattn/go-runewidth"
+
+	"github.com/trinhminhtriet/git-author/internal/pretty"
+	"github.com/trinhminhtriet/git-author/internal/tally"
+)
+
+// 38 columns wide, longer than the author column ever is by default.
+const longAuthor = "Maximilian Alexander Featherstonehaugh"
+
+func TestLayoutTable(t *testing.T) {
+	tallies := []tally.FinalTally{
+		{AuthorName: "Alice"},
+		{AuthorName: longAuthor},
+	}
+
+	all := []string{"Last Edit", "Commits", "Files", "Lines (+/-)"}
+
+	tests := []struct {
+		name       string
+		mode       tally.TallyMode
+		limit      int
+		expWidth   int
+		expHeaders []string
+	}{
+		// Lines mode: 2 for borders and 47 for the other columns
+		{"lines_unlimited", tally.LinesMode, 0, wideWidth, all},
+		{"lines_wide", tally.LinesMode, 120, 87, all},
+		{"lines_exact", tally.LinesMode, 87, 87, all},
+		{"lines_truncated", tally.LinesMode, 86, 86, all},
+		{"lines_min_author", tally.LinesMode, 59, 59, all},
+		{
+			"lines_drop_files",
+			tally.LinesMode,
+			58,
+			58,
+			[]string{"Last Edit", "Commits", "Lines (+/-)"},
+		},
+		{
+			"lines_drop_edit",
+			tally.LinesMode,
+			40,
+			40,
+			[]string{"Commits", "Lines (+/-)"},
+		},
+		{
+			// Lines are what we sort by, so the table overflows instead
+			"lines_keep_required",
+			tally.LinesMode,
+			20,
+			31,
+			[]string{"Lines (+/-)"},
+		},
+
+		// Commit mode: 2 for borders and 20 for the other columns
+		{
+			"commits_unlimited",
+			tally.CommitMode,
+			0,
+			narrowWidth,
+			[]string{"Last Edit", "Commits"},
+		},
+		{
+			"commits_wide",
+			tally.CommitMode,
+			100,
+			60,
+			[]string{"Last Edit", "Commits"},
+		},
+		{
+			"commits_exact",
+			tally.CommitMode,
+			60,
+			60,
+			[]string{"Last Edit", "Commits"},
+		},
+		{
+			"commits_min_author",
+			tally.CommitMode,
+			32,
+			32,
+			[]string{"Last Edit", "Commits"},
+		},
+		{
+			"commits_drop_edit",
+			tally.CommitMode,
+			31,
+			31,
+			[]string{"Commits"},
+		},
+		{
+			"last_modified_keep_edit",
+			tally.LastModifiedMode,
+			25,
+			25,
+			[]string{"Last Edit"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := pretty.NewRenderer(&strings.Builder{}, false, true, test.limit)
+			width, columns := layoutTable(
+				tableColumns(r, test.mode),
+				tallies,
+				pickWidth(test.mode, false),
+				false,
+				test.limit,
+			)
+
+			headers := []string{}
+			for _, c := range columns {
+				headers = append(headers, c.header)
+			}
+
+			if width != test.expWidth {
+				t.Errorf("expected width %d, got %d", test.expWidth, width)
+			}
+			if diff := cmp.Diff(test.expHeaders, headers); diff != "" {
+				t.Errorf("columns are wrong:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteTableWidth(t *testing.T) {
+	now := time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)
+	setProgStart(t, now)
+
+	tallies := []tally.FinalTally{
+		{
+			AuthorName:     longAuthor,
+			Commits:        12,
+			LinesAdded:     300,
+			LinesRemoved:   4,
+			FileCount:      5,
+			LastCommitTime: now.Add(-2 * 24 * time.Hour),
+		},
+	}
+
+	tests := []struct {
+		name  string
+		width int
+		exp   []string
+	}{
+		{
+			name:  "wide",
+			width: 120,
+			exp: []string{
+				"+" + strings.Repeat("-", 85) + "+",
+				"|Author                                 Last Edit   " +
+					"Commits   Files        Lines (+/-)|",
+				"+" + strings.Repeat("-", 85) + "+",
+				"|Maximilian Alexander Featherstonehaugh 2 days ago  " +
+					"     12       5      300 /       4|",
+				"+" + strings.Repeat("-", 85) + "+",
+			},
+		},
+		{
+			name:  "narrow",
+			width: 40,
+			exp: []string{
+				"+" + strings.Repeat("-", 38) + "+",
+				"|Author      Commits        Lines (+/-)|",
+				"+" + strings.Repeat("-", 38) + "+",
+				"|Maximilian…      12      300 /       4|",
+				"+" + strings.Repeat("-", 38) + "+",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out strings.Builder
+			r := pretty.NewRenderer(&out, false, true, test.width)
+			writeTable(r, tallies, wideWidth, false, tally.LinesMode, 0)
+			if err := r.Flush(); err != nil {
+				t.Fatalf("Flush() returned error: %v", err)
+			}
+
+			lines := outputLines(out.String())
+			if diff := cmp.Diff(test.exp, lines); diff != "" {
+				t.Errorf("table is wrong:\n%s", diff)
+			}
+
+			for _, line := range lines {
+				if w := runewidth.StringWidth(line); w > test.width {
+					t.Errorf("line is %d wide, expected at most %d: %q",
+						w, test.width, line)
+				}
+			}
+		})
+	}
+}
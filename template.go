@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/trinhminhtriet/git-author/internal/format"
+	"github.com/trinhminhtriet/git-author/internal/tally"
+)
+
+// Functions available in --template.
+var templateFuncs = template.FuncMap{
+	"number": format.Number,
+	"abbrev": format.Abbrev,
+	"email":  format.GitEmail,
+	"relative": func(t time.Time) string {
+		return format.RelativeTime(progStart, t)
+	},
+}
+
+type templateFlags struct {
+	text *string
+	path *string
+}
+
+func addTemplateFlags(set *flag.FlagSet) *templateFlags {
+	return &templateFlags{
+		text: set.String("template", "", strings.TrimSpace(`
+Go text/template executed once per output row instead of the default output
+		`)),
+		path: set.String("template-file", "", strings.TrimSpace(`
+Like --template, but read the template from this file
+		`)),
+	}
+}
+
+// Parses the template given by --template or --template-file. Returns nil if
+// neither was given.
+func (f *templateFlags) parse() (*template.Template, error) {
+	if *f.text != "" && *f.path != "" {
+		return nil, errors.New(
+			"--template and --template-file are mutually exclusive",
+		)
+	}
+
+	text := *f.text
+	if *f.path != "" {
+		b, err := os.ReadFile(*f.path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read template: %w", err)
+		}
+
+		text = string(b)
+	}
+
+	if text == "" {
+		return nil, nil
+	}
+
+	tmpl, err := template.New("output").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse template: %w", err)
+	}
+
+	return tmpl, nil
+}
+
+// A node of the tree as seen by --template.
+type templateTreeNode struct {
+	Path       string
+	Name       string
+	Depth      int
+	IsDir      bool
+	InWorkTree bool
+	Tally      tally.FinalTally   // Top author
+	Authors    []tally.FinalTally // Every author, ranked
+	Children   []string           // Names of the children, in output order
+}
+
+// A bucket of the timeline as seen by --template.
+type templateBucket struct {
+	Name    string
+	Start   time.Time
+	End     time.Time
+	Tally   tally.FinalTally   // Top author, zero if there were no commits
+	Total   tally.FinalTally   // All authors combined
+	Authors []tally.FinalTally // Every author, ranked
+}
+
+// Executes the template once for each row, ending each with a newline.
+func writeTemplateRows[T any](tmpl *template.Template, rows []T) error {
+	w := bufio.NewWriter(os.Stdout)
+
+	for _, row := range rows {
+		err := tmpl.Execute(w, row)
+		if err != nil {
+			w.Flush()
+			return fmt.Errorf("could not execute template: %w", err)
+		}
+
+		w.WriteString("\n")
+	}
+
+	err := w.Flush()
+	if err != nil {
+		return fmt.Errorf("error writing to stdout: %w", err)
+	}
+
+	return nil
+}
+
+// Rows are the nodes of the tree in the order "tree" prints them, without
+// eliding paths.
+func writeTreeTemplate(
+	tmpl *template.Template,
+	root *tally.TreeNode,
+	opts printTreeOpts,
+) error {
+	nodes := toTemplateTreeNodes(root, ".", 0, opts, []templateTreeNode{})
+	return writeTemplateRows(tmpl, nodes)
+}
+
+func toTemplateTreeNodes(
+	node *tally.TreeNode,
+	path string,
+	depth int,
+	opts printTreeOpts,
+	nodes []templateTreeNode,
+) []templateTreeNode {
+	if !node.InWorkTree && !opts.showHidden {
+		return nodes
+	}
+
+	childPaths := []string{}
+	if depth < opts.maxDepth {
+		for _, p := range sortChildPaths(
+			node.Children,
+			func(child *tally.TreeNode) bool { return len(child.Children) > 0 },
+		) {
+			child := node.Children[p]
+			if p == tally.NoDiffPathname ||
+				(!child.InWorkTree && !opts.showHidden) {
+				continue
+			}
+
+			childPaths = append(childPaths, p)
+		}
+	}
+
+	nodes = append(nodes, templateTreeNode{
+		Path:       filepath.ToSlash(path),
+		Name:       filepath.Base(path),
+		Depth:      depth,
+		IsDir:      len(node.Children) > 0,
+		InWorkTree: node.InWorkTree,
+		Tally:      node.Tally,
+		Authors:    node.Authors(opts.mode),
+		Children:   childPaths,
+	})
+
+	for _, p := range childPaths {
+		nodes = toTemplateTreeNodes(
+			node.Children[p],
+			filepath.Join(path, p),
+			depth+1,
+			opts,
+			nodes,
+		)
+	}
+
+	return nodes
+}
+
+func writeHistTemplate(
+	tmpl *template.Template,
+	buckets []tally.TimeBucket,
+	mode tally.TallyMode,
+) error {
+	rows := []templateBucket{}
+	for _, bucket := range buckets {
+		rows = append(rows, templateBucket{
+			Name:    bucket.Name,
+			Start:   bucket.Time,
+			End:     bucket.End,
+			Tally:   bucket.Tally,
+			Total:   bucket.TotalTally,
+			Authors: bucket.Authors(mode),
+		})
+	}
+
+	return writeTemplateRows(tmpl, rows)
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/trinhminhtriet/git-author/internal/git"
+	"github.com/trinhminhtriet/git-author/internal/tally"
+	"github.com/trinhminhtriet/git-author/internal/utils/iterutils"
+)
+
+func templateCommits() []git.Commit {
+	commit := func(hash string, author string, day int, paths ...string) git.Commit {
+		c := git.Commit{
+			Hash:        hash,
+			ShortHash:   hash[:7],
+			AuthorName:  author,
+			AuthorEmail: strings.ToLower(author) + "@mail.com",
+			Date:        time.Date(2025, 1, day, 12, 0, 0, 0, time.UTC),
+		}
+		for _, path := range paths {
+			c.FileDiffs = append(c.FileDiffs, git.FileDiff{
+				Path:       path,
+				LinesAdded: 1000,
+			})
+		}
+		return c
+	}
+
+	return []git.Commit{
+		commit("1e9ea7662b1001d860471a4cece5e2f1de8062fb", "Alice", 1, "README.md", "src/a.go"),
+		commit("2e9ea7662b1001d860471a4cece5e2f1de8062fb", "Alice", 1, "src/a.go"),
+		commit("3e9ea7662b1001d860471a4cece5e2f1de8062fb", "Bob", 3, "src/b.go", "old.go"),
+	}
+}
+
+func mustParseTemplate(t *testing.T, text string) *template.Template {
+	tmpl, err := template.New("output").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		t.Fatalf("could not parse template: %v", err)
+	}
+
+	return tmpl
+}
+
+func TestTemplateFlags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "row.tmpl")
+	if err := os.WriteFile(path, []byte("{{.AuthorName}}"), 0o644); err != nil {
+		t.Fatalf("could not write template file: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		expNil bool
+		expErr string
+	}{
+		{name: "none", args: []string{}, expNil: true},
+		{name: "inline", args: []string{"--template", "{{.AuthorName}}"}},
+		{name: "file", args: []string{"--template-file", path}},
+		{
+			name:   "both",
+			args:   []string{"--template", "x", "--template-file", path},
+			expErr: "mutually exclusive",
+		},
+		{
+			name:   "missing_file",
+			args:   []string{"--template-file", path + ".missing"},
+			expErr: "could not read template",
+		},
+		{
+			name:   "bad_syntax",
+			args:   []string{"--template", "{{.AuthorName"},
+			expErr: "could not parse template",
+		},
+		{
+			name:   "unknown_function",
+			args:   []string{"--template", "{{shout .AuthorName}}"},
+			expErr: "could not parse template",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			set := flag.NewFlagSet("test", flag.ContinueOnError)
+			flags := addTemplateFlags(set)
+			if err := set.Parse(test.args); err != nil {
+				t.Fatalf("could not parse flags: %v", err)
+			}
+
+			tmpl, err := flags.parse()
+			if test.expErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expErr) {
+					t.Fatalf("expected error containing %q, got %v", test.expErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("parse() returned error: %v", err)
+			}
+			if (tmpl == nil) != test.expNil {
+				t.Errorf("expected nil template: %v, got %v", test.expNil, tmpl)
+			}
+		})
+	}
+}
+
+func TestTableTemplate(t *testing.T) {
+	setProgStart(t, time.Date(2025, 1, 5, 12, 0, 0, 0, time.UTC))
+
+	tallies, err := tally.TallyCommits(
+		iterutils.WithoutErrors(slices.Values(templateCommits())),
+		tally.TallyOpts{
+			Mode: tally.LinesMode,
+			Key:  func(c git.Commit) string { return c.AuthorName },
+		},
+	)
+	if err != nil {
+		t.Fatalf("TallyCommits() returned error: %v", err)
+	}
+
+	tmpl := mustParseTemplate(
+		t,
+		`{{.AuthorName}} {{email .AuthorEmail}} {{.Commits}} `+
+			`+{{number .LinesAdded}} {{relative .LastCommitTime}}`,
+	)
+
+	out := captureStdout(t, func() error {
+		return writeTemplateRows(tmpl, tally.Rank(tallies, tally.LinesMode))
+	})
+
+	expected := []string{
+		"Alice <alice@mail.com> 2 +3,000 4 days ago",
+		"Bob <bob@mail.com> 1 +2,000 2 days ago",
+	}
+	if diff := cmp.Diff(expected, outputLines(out)); diff != "" {
+		t.Errorf("output is wrong:\n%s", diff)
+	}
+}
+
+func TestTreeTemplate(t *testing.T) {
+	opts := tally.TallyOpts{
+		Mode: tally.CommitMode,
+		Key:  func(c git.Commit) string { return c.AuthorName },
+	}
+
+	// old.go is no longer in the working tree
+	wtreeset := map[string]bool{
+		"README.md": true,
+		"src/a.go":  true,
+		"src/b.go":  true,
+	}
+
+	root, err := tally.TallyCommitsTree(
+		iterutils.WithoutErrors(slices.Values(templateCommits())),
+		opts,
+		wtreeset,
+		"",
+	)
+	if err != nil {
+		t.Fatalf("TallyCommitsTree() returned error: %v", err)
+	}
+	root = root.Rank(opts.Mode)
+
+	tmpl := mustParseTemplate(
+		t,
+		`{{.Depth}} {{.Path}} {{if .IsDir}}dir{{else}}file{{end}} `+
+			`{{.Tally.AuthorName}} {{len .Authors}} {{.Children}}`,
+	)
+
+	tests := []struct {
+		name       string
+		maxDepth   int
+		showHidden bool
+		exp        []string
+	}{
+		{
+			name:     "all",
+			maxDepth: 10,
+			exp: []string{
+				"0 . dir Alice 2 [src README.md]",
+				"1 src dir Alice 2 [a.go b.go]",
+				"2 src/a.go file Alice 1 []",
+				"2 src/b.go file Bob 1 []",
+				"1 README.md file Alice 1 []",
+			},
+		},
+		{
+			name:     "shallow",
+			maxDepth: 1,
+			exp: []string{
+				"0 . dir Alice 2 [src README.md]",
+				"1 src dir Alice 2 []",
+				"1 README.md file Alice 1 []",
+			},
+		},
+		{
+			name:       "hidden",
+			maxDepth:   10,
+			showHidden: true,
+			exp: []string{
+				"0 . dir Alice 2 [src README.md old.go]",
+				"1 src dir Alice 2 [a.go b.go]",
+				"2 src/a.go file Alice 1 []",
+				"2 src/b.go file Bob 1 []",
+				"1 README.md file Alice 1 []",
+				"1 old.go file Bob 1 []",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := captureStdout(t, func() error {
+				return writeTreeTemplate(tmpl, root, printTreeOpts{
+					mode:       opts.Mode,
+					maxDepth:   test.maxDepth,
+					showHidden: test.showHidden,
+				})
+			})
+
+			if diff := cmp.Diff(test.exp, outputLines(out)); diff != "" {
+				t.Errorf("output is wrong:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHistTemplate(t *testing.T) {
+	opts := tally.TallyOpts{
+		Mode: tally.CommitMode,
+		Key:  func(c git.Commit) string { return c.AuthorName },
+	}
+
+	buckets, err := tally.TallyCommitsTimeline(
+		iterutils.WithoutErrors(slices.Values(templateCommits())),
+		opts,
+		time.Time{},
+	)
+	if err != nil {
+		t.Fatalf("TallyCommitsTimeline() returned error: %v", err)
+	}
+	for i, bucket := range buckets {
+		buckets[i] = bucket.Rank(opts.Mode)
+	}
+
+	tmpl := mustParseTemplate(
+		t,
+		`{{.Name}} {{.Start.Format "Jan 2"}} {{.Total.Commits}}`+
+			`{{range .Authors}} {{.AuthorName}}={{.Commits}}{{end}}`,
+	)
+
+	out := captureStdout(t, func() error {
+		return writeHistTemplate(tmpl, buckets, opts.Mode)
+	})
+
+	expected := []string{
+		"2025-01-01 Jan 1 2 Alice=2",
+		"2025-01-02 Jan 2 0",
+		"2025-01-03 Jan 3 1 Bob=1",
+	}
+	if diff := cmp.Diff(expected, outputLines(out)); diff != "" {
+		t.Errorf("output is wrong:\n%s", diff)
+	}
+}
+
+func TestTemplateBadField(t *testing.T) {
+	tallies := []tally.FinalTally{{AuthorName: "Alice"}}
+	tmpl := mustParseTemplate(t, "{{.AuthorName}} {{.Nickname}}")
+
+	var err error
+	captureStdout(t, func() error {
+		err = writeTemplateRows(tmpl, tallies)
+		return nil
+	})
+
+	if err == nil {
+		t.Fatal("expected an error for a field that doesn't exist")
+	}
+	if !strings.Contains(err.Error(), "could not execute template") ||
+		!strings.Contains(err.Error(), "Nickname") {
+		t.Errorf("error should name the template and the bad field, got: %v", err)
+	}
+}
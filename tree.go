@@ -2,29 +2,45 @@ package main
 
 import (
 	"context"
+	"encoding/csv"
 	"fmt"
 	"maps"
+	"math"
 	"os"
 	"path/filepath"
-	"runtime"
 	"slices"
+	"strconv"
 	"strings"
+	"text/template"
 	"unicode/utf8"
 
-	"github.com/trinhminhtriet/git-author/internal/concurrent"
+	runewidth "github.com/mattn/go-runewidth"
+
 	"github.com/trinhminhtriet/git-author/internal/format"
 	"github.com/trinhminhtriet/git-author/internal/git"
 	"github.com/trinhminhtriet/git-author/internal/pretty"
 	"github.com/trinhminhtriet/git-author/internal/tally"
+	"github.com/trinhminhtriet/git-author/internal/tui"
 )
 
 const defaultMaxDepth = 100
 
+// Authors are abbreviated to this many columns when we don't know how wide
+// the terminal is.
+const defaultAuthorWidth = 25
+
+// Authors are never abbreviated to fewer columns than this.
+const minAuthorAbbrevWidth = 8
+
 type printTreeOpts struct {
 	mode       tally.TallyMode
 	maxDepth   int
 	showHidden bool
 	key        func(t tally.FinalTally) string
+	columns    []treeColumn
+	showEmail  bool
+	allAuthors bool
+	renderer   *pretty.Renderer
 }
 
 type treeOutputLine struct {
@@ -36,6 +52,37 @@ type treeOutputLine struct {
 	showTally bool
 	dimTally  bool
 	dimPath   bool
+	columns   []string
+	depth     int
+}
+
+// Extra columns that can be shown after the author annotation.
+type treeColumn string
+
+const (
+	contributorsColumn treeColumn = "contributors"
+	lastColumn         treeColumn = "last"
+	totalColumn        treeColumn = "total"
+	shareColumn        treeColumn = "share"
+)
+
+func parseTreeColumns(s string) ([]treeColumn, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	columns := []treeColumn{}
+	for _, name := range strings.Split(s, ",") {
+		column := treeColumn(strings.TrimSpace(name))
+		switch column {
+		case contributorsColumn, lastColumn, totalColumn, shareColumn:
+			columns = append(columns, column)
+		default:
+			return nil, fmt.Errorf("unknown column: \"%s\"", column)
+		}
+	}
+
+	return columns, nil
 }
 
 func tree(
@@ -46,6 +93,17 @@ func tree(
 	showEmail bool,
 	showHidden bool,
 	countMerges bool,
+	includeGenerated bool,
+	interactive bool,
+	columns []treeColumn,
+	allAuthors bool,
+	compareRevs []string,
+	at string,
+	fromPath string,
+	filesPath string,
+	outputFormat string,
+	tmpl *template.Template,
+	renderer *pretty.Renderer,
 	since string,
 	until string,
 	authors []string,
@@ -73,6 +131,24 @@ func tree(
 		showHidden,
 		"countMerges",
 		countMerges,
+		"includeGenerated",
+		includeGenerated,
+		"interactive",
+		interactive,
+		"allAuthors",
+		allAuthors,
+		"compareRevs",
+		compareRevs,
+		"at",
+		at,
+		"fromPath",
+		fromPath,
+		"filesPath",
+		filesPath,
+		"outputFormat",
+		outputFormat,
+		"template",
+		tmpl != nil,
 		"since",
 		since,
 		"until",
@@ -83,17 +159,40 @@ func tree(
 		nauthors,
 	)
 
-	wtreeset, err := git.WorkingTreeFiles(pathspecs)
-	if err != nil {
-		return err
-	}
-
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	gitRootPath, err := git.GetRoot()
-	if err != nil {
-		return err
+	var wtreeset map[string]bool
+	var prefix string
+	if fromPath != "" {
+		// Without a repository, only a saved file list can tell us which
+		// paths still exist. If there isn't one, every path is shown
+		if filesPath != "" {
+			wtreeset, err = savedFileList(filesPath)
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		// Decide which paths still exist using the tip of the range by
+		// default, so that we never depend on what is checked out. When
+		// comparing, that is the tip of the later range, so that paths it
+		// added still count as existing
+		if at == "" && len(compareRevs) > 0 {
+			at = rangeTip(compareRevs)
+		} else if at == "" {
+			at = rangeTip(revs)
+		}
+
+		wtreeset, err = git.TreeFiles(at)
+		if err != nil {
+			return err
+		}
+
+		prefix, err = git.GetPrefix()
+		if err != nil {
+			return err
+		}
 	}
 
 	filters := git.LogFilters{
@@ -104,90 +203,215 @@ func tree(
 	}
 
 	tallyOpts := tally.TallyOpts{Mode: mode, CountMerges: countMerges}
+	if outputFormat == "openmetrics" && !tallyOpts.IsDiffMode() {
+		tallyOpts.Mode = tally.LinesMode // Need diffs for line and file gauges
+	}
 	if showEmail {
 		tallyOpts.Key = func(c git.Commit) string { return c.AuthorEmail }
+		tallyOpts.KeyName = "email"
 	} else {
 		tallyOpts.Key = func(c git.Commit) string { return c.AuthorName }
+		tallyOpts.KeyName = "name"
+	}
+
+	// The interactive browser can switch to lines or files mode later, and JSON
+	// output always includes lines and files
+	needsExcluder := tallyOpts.IsDiffMode() || interactive || outputFormat == "json"
+	if !includeGenerated && needsExcluder {
+		excluder, err := excluderFor(ctx, fromPath, at)
+		if err != nil {
+			return err
+		}
+		defer excluder.Close()
+
+		tallyOpts.ExcludePath = excluder.IsExcluded
 	}
 
-	var root *tally.TreeNode
-	if runtime.GOMAXPROCS(0) > 1 {
-		root, err = concurrent.TallyCommitsTree(
+	maxDepth := depth
+	if depth == 0 {
+		maxDepth = defaultMaxDepth
+	}
+
+	opts := printTreeOpts{
+		maxDepth:   maxDepth,
+		mode:       mode,
+		showHidden: showHidden,
+		columns:    columns,
+		showEmail:  showEmail,
+		allAuthors: allAuthors,
+		renderer:   renderer,
+	}
+	if showEmail {
+		opts.key = func(t tally.FinalTally) string { return t.AuthorEmail }
+	} else {
+		opts.key = func(t tally.FinalTally) string { return t.AuthorName }
+	}
+
+	if len(compareRevs) > 0 {
+		return treeCompare(
 			ctx,
 			revs,
+			compareRevs,
 			pathspecs,
 			filters,
 			tallyOpts,
 			wtreeset,
-			gitRootPath,
-			getCache(),
-			pretty.AllowDynamic(os.Stdout),
+			prefix,
+			opts,
+			showEmail,
+			outputFormat,
 		)
+	}
 
-		if err == tally.EmptyTreeErr {
-			logger().Debug("Tree was empty.")
+	root, err := tallyTree(
+		ctx,
+		fromPath,
+		revs,
+		pathspecs,
+		filters,
+		tallyOpts,
+		wtreeset,
+		prefix,
+	)
+	if err == tally.EmptyTreeErr {
+		logger().Debug("Tree was empty.")
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	root = root.Rank(mode)
+
+	if tmpl != nil {
+		return writeTreeTemplate(tmpl, root, opts)
+	}
+
+	if interactive {
+		browser := tui.NewBrowser(root, tui.BrowserOpts{
+			Mode:       mode,
+			ShowEmail:  showEmail,
+			ShowHidden: showHidden,
+			Now:        progStart,
+			ASCII:      renderer.ASCII(),
+		})
+		return tui.RunTerminal(browser)
+	}
+
+	switch outputFormat {
+	case "csv":
+		return writeTreeCsv(root, opts, tallyOpts)
+	case "json":
+		return writeTreeJSON(root, opts)
+	case "openmetrics":
+		return writeTreeMetrics(root, opts, revs, pathspecs)
+	}
+
+	lines := toLines(root, ".", 0, "", []bool{}, opts, []treeOutputLine{})
+	if outputFormat == "markdown" {
+		writeTreeMarkdown(lines, showEmail, mode)
+		return nil
+	}
+
+	printTree(renderer, lines, showEmail)
+	return renderer.Flush()
+}
+
+// Writes one row per path with its top author, or with every author if
+// opts.allAuthors is set.
+func writeTreeCsv(
+	root *tally.TreeNode,
+	opts printTreeOpts,
+	tallyOpts tally.TallyOpts,
+) error {
+	w := csv.NewWriter(os.Stdout)
+
+	// Write header
+	columnHeaders := []string{"depth", "path", "in work tree"}
+	if opts.allAuthors {
+		columnHeaders = append(columnHeaders, "rank")
+	}
+	columnHeaders = append(
+		columnHeaders,
+		toRecordHeaders(tallyOpts, opts.showEmail)...,
+	)
+	w.Write(columnHeaders)
+
+	var writeNode func(node *tally.TreeNode, path string, depth int) error
+	writeNode = func(node *tally.TreeNode, path string, depth int) error {
+		if !node.InWorkTree && !opts.showHidden {
 			return nil
 		}
 
-		if err != nil {
-			return err
-		}
-	} else {
-		commits, closer, innererr := git.CommitsWithOpts(
-			ctx,
-			revs,
-			pathspecs,
-			filters,
-			true,
-		)
-		if innererr != nil {
-			return innererr
+		prefix := []string{
+			strconv.Itoa(depth),
+			filepath.ToSlash(path),
+			strconv.FormatBool(node.InWorkTree),
 		}
 
-		root, innererr = tally.TallyCommitsTree(
-			commits,
-			tallyOpts,
-			wtreeset,
-			gitRootPath,
-		)
-		if innererr == tally.EmptyTreeErr {
-			logger().Debug("Tree was empty.")
-			return nil
+		authors := []tally.FinalTally{node.Tally}
+		if opts.allAuthors {
+			authors = node.Authors(opts.mode)
 		}
 
-		if innererr != nil {
-			return fmt.Errorf("failed to tally commits: %w", innererr)
+		for i, t := range authors {
+			record := slices.Clone(prefix)
+			if opts.allAuthors {
+				record = append(record, strconv.Itoa(i+1))
+			}
+			record = append(record, toRecord(t, tallyOpts, opts.showEmail)...)
+
+			if err := w.Write(record); err != nil {
+				return fmt.Errorf("error writing CSV record to stdout: %w", err)
+			}
 		}
 
-		innererr = closer()
-		if innererr != nil {
-			return innererr
+		if depth >= opts.maxDepth {
+			return nil
 		}
-	}
 
-	root = root.Rank(mode)
+		childPaths := sortChildPaths(
+			node.Children,
+			func(child *tally.TreeNode) bool { return len(child.Children) > 0 },
+		)
+		for _, p := range childPaths {
+			if p == tally.NoDiffPathname {
+				continue
+			}
 
-	maxDepth := depth
-	if depth == 0 {
-		maxDepth = defaultMaxDepth
+			err := writeNode(node.Children[p], filepath.Join(path, p), depth+1)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
 	}
 
-	opts := printTreeOpts{
-		maxDepth:   maxDepth,
-		mode:       mode,
-		showHidden: showHidden,
+	if err := writeNode(root, ".", 0); err != nil {
+		return err
 	}
-	if showEmail {
-		opts.key = func(t tally.FinalTally) string { return t.AuthorEmail }
-	} else {
-		opts.key = func(t tally.FinalTally) string { return t.AuthorName }
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("error flushing CSV writer: %w", err)
 	}
 
-	lines := toLines(root, ".", 0, "", []bool{}, opts, []treeOutputLine{})
-	printTree(lines, showEmail)
 	return nil
 }
 
+// Returns the first revision included by the given revisions.
+func rangeTip(revs []string) string {
+	for _, rev := range revs {
+		if !strings.HasPrefix(rev, "^") {
+			return rev
+		}
+	}
+
+	return "HEAD"
+}
+
 // Recursively descend tree, turning tree nodes into output lines.
 func toLines(
 	node *tally.TreeNode,
@@ -224,23 +448,8 @@ func toLines(
 
 	var line treeOutputLine
 
-	var indentBuilder strings.Builder
-	for i, isFinal := range isFinalChild {
-		if i < len(isFinalChild)-1 {
-			if isFinal {
-				fmt.Fprintf(&indentBuilder, "    ")
-			} else {
-				fmt.Fprintf(&indentBuilder, "│   ")
-			}
-		} else {
-			if isFinal {
-				fmt.Fprintf(&indentBuilder, "└── ")
-			} else {
-				fmt.Fprintf(&indentBuilder, "├── ")
-			}
-		}
-	}
-	line.indent = indentBuilder.String()
+	line.indent = treeIndent(isFinalChild, opts.renderer.Glyphs)
+	line.depth = len(isFinalChild)
 
 	line.path = path
 	if len(node.Children) > 0 {
@@ -254,26 +463,22 @@ func toLines(
 	line.dimTally = len(node.Children) > 0
 	line.dimPath = !node.InWorkTree
 
+	// Extra columns differ from node to node, so always show them
 	newAuthor := opts.key(node.Tally) != lastAuthor
-	line.showTally = opts.showHidden || newAuthor || len(node.Children) > 0
+	line.showTally = opts.showHidden ||
+		newAuthor ||
+		len(node.Children) > 0 ||
+		len(opts.columns) > 0
 
-	lines = append(lines, line)
+	for _, column := range opts.columns {
+		line.columns = append(line.columns, fmtTreeColumn(node, column, opts))
+	}
 
-	childPaths := slices.SortedFunc(
-		maps.Keys(node.Children),
-		func(a, b string) int {
-			// Show directories first
-			aHasChildren := len(node.Children[a].Children) > 0
-			bHasChildren := len(node.Children[b].Children) > 0
+	lines = append(lines, line)
 
-			if aHasChildren == bHasChildren {
-				return strings.Compare(a, b) // Sort alphabetically
-			} else if aHasChildren {
-				return -1
-			} else {
-				return 1
-			}
-		},
+	childPaths := sortChildPaths(
+		node.Children,
+		func(child *tally.TreeNode) bool { return len(child.Children) > 0 },
 	)
 
 	// Find last non-hidden child
@@ -301,6 +506,87 @@ func toLines(
 	return lines
 }
 
+// Returns the box-drawing prefix for a line in the tree.
+func treeIndent(isFinalChild []bool, g pretty.Glyphs) string {
+	var indentBuilder strings.Builder
+	for i, isFinal := range isFinalChild {
+		if i < len(isFinalChild)-1 {
+			if isFinal {
+				indentBuilder.WriteString("    ")
+			} else {
+				indentBuilder.WriteString(g.TreePipe)
+			}
+		} else {
+			if isFinal {
+				indentBuilder.WriteString(g.TreeLast)
+			} else {
+				indentBuilder.WriteString(g.TreeBranch)
+			}
+		}
+	}
+
+	return indentBuilder.String()
+}
+
+// Returns the names of the given child nodes in the order we print them.
+func sortChildPaths[N any](
+	children map[string]N,
+	isDir func(child N) bool,
+) []string {
+	return slices.SortedFunc(
+		maps.Keys(children),
+		func(a, b string) int {
+			// Show directories first
+			aIsDir := isDir(children[a])
+			bIsDir := isDir(children[b])
+
+			if aIsDir == bIsDir {
+				return strings.Compare(a, b) // Sort alphabetically
+			} else if aIsDir {
+				return -1
+			} else {
+				return 1
+			}
+		},
+	)
+}
+
+func fmtTreeColumn(
+	node *tally.TreeNode,
+	column treeColumn,
+	opts printTreeOpts,
+) string {
+	switch column {
+	case contributorsColumn:
+		n := node.Contributors()
+		if n == 1 {
+			return "1 author"
+		}
+		return fmt.Sprintf("%s authors", format.Number(n))
+	case lastColumn:
+		last := node.Authors(tally.LastModifiedMode)[0]
+		return fmt.Sprintf(
+			"%s by %s",
+			format.RelativeTime(progStart, last.LastCommitTime),
+			fmtTreeAuthor(last, opts.showEmail, defaultAuthorWidth),
+		)
+	case totalColumn:
+		n := node.TotalCommits()
+		if n == 1 {
+			return "1 commit"
+		}
+		return fmt.Sprintf("%s commits", format.Number(n))
+	case shareColumn:
+		share, ok := node.Share(opts.mode)
+		if !ok {
+			return "-"
+		}
+		return fmt.Sprintf("%.0f%%", share*100)
+	default:
+		panic("unrecognized column in switch")
+	}
+}
+
 func fmtTallyMetric(t tally.FinalTally, opts printTreeOpts) string {
 	switch opts.mode {
 	case tally.CommitMode:
@@ -309,13 +595,9 @@ func fmtTallyMetric(t tally.FinalTally, opts printTreeOpts) string {
 		return fmt.Sprintf("(%s)", format.Number(t.FileCount))
 	case tally.LinesMode:
 		return fmt.Sprintf(
-			"(%s%s%s / %s%s%s)",
-			pretty.Green,
-			format.Number(t.LinesAdded),
-			pretty.DefaultColor,
-			pretty.Red,
-			format.Number(t.LinesRemoved),
-			pretty.DefaultColor,
+			"(%s / %s)",
+			opts.renderer.Green(format.Number(t.LinesAdded)),
+			opts.renderer.Red(format.Number(t.LinesRemoved)),
 		)
 	case tally.LastModifiedMode:
 		return fmt.Sprintf(
@@ -332,7 +614,7 @@ func fmtTallyMetric(t tally.FinalTally, opts printTreeOpts) string {
 	}
 }
 
-func printTree(lines []treeOutputLine, showEmail bool) {
+func printTree(r *pretty.Renderer, lines []treeOutputLine, showEmail bool) {
 	longest := 0
 	for _, line := range lines {
 		indentLen := utf8.RuneCountInString(line.indent)
@@ -344,56 +626,164 @@ func printTree(lines []treeOutputLine, showEmail bool) {
 
 	tallyStart := longest + 4 // Use at least 4 "." to separate path from tally
 
+	// Widths of each extra column, for alignment
+	columnWidths := []int{}
+	metricWidth := 0
+	longestAuthor := 0
+	for _, line := range lines {
+		if !line.showLine || !line.showTally {
+			continue
+		}
+
+		metricWidth = max(metricWidth, visibleLen(line.metric))
+		longestAuthor = max(
+			longestAuthor,
+			runewidth.StringWidth(fmtTreeAuthor(line.tally, showEmail, math.MaxInt)),
+		)
+
+		for i, column := range line.columns {
+			if i >= len(columnWidths) {
+				columnWidths = append(columnWidths, 0)
+			}
+			columnWidths[i] = max(
+				columnWidths[i],
+				utf8.RuneCountInString(column),
+			)
+		}
+	}
+
+	authorWidth := defaultAuthorWidth
+	if r.Width > 0 {
+		extraWidth := 0
+		for _, width := range columnWidths {
+			extraWidth += 2 + width
+		}
+
+		// Move the annotations left if they would not fit otherwise, and
+		// give the authors whatever space is left
+		annotationSpace := minAuthorAbbrevWidth + 1 + metricWidth + extraWidth
+		tallyStart = max(min(tallyStart, r.Width-annotationSpace), 1)
+		authorWidth = r.Width - tallyStart - 1 - metricWidth - extraWidth
+		authorWidth = max(min(authorWidth, longestAuthor), minAuthorAbbrevWidth)
+	}
+
+	// Width of the annotation, for alignment
+	annotationWidth := 0
+	for _, line := range lines {
+		if !line.showLine || !line.showTally {
+			continue
+		}
+
+		width := fmtAnnotationWidth(line, showEmail, authorWidth)
+		annotationWidth = max(annotationWidth, width)
+	}
+
 	for _, line := range lines {
 		if !line.showLine {
 			continue
 		}
 
-		var path string
+		path := line.path
 		if line.dimPath {
-			path = fmt.Sprintf("%s%s%s", pretty.Dim, line.path, pretty.Reset)
-		} else {
-			path = line.path
+			path = r.Dim(line.path)
 		}
 
 		if !line.showTally {
-			fmt.Printf("%s%s\n", line.indent, path)
+			r.Printf("%s%s\n", line.indent, path)
 			continue
 		}
 
-		var author string
-		if showEmail {
-			author = format.Abbrev(format.GitEmail(line.tally.AuthorEmail), 25)
-		} else {
-			author = format.Abbrev(line.tally.AuthorName, 25)
-		}
+		author := fmtTreeAuthor(line.tally, showEmail, authorWidth)
 
 		indentLen := utf8.RuneCountInString(line.indent)
 		pathLen := utf8.RuneCountInString(line.path)
-		separator := strings.Repeat(".", tallyStart-indentLen-pathLen)
+		separator := strings.Repeat(".", max(tallyStart-indentLen-pathLen, 1))
+		extra := fmtTreeColumns(
+			line,
+			annotationWidth-fmtAnnotationWidth(line, showEmail, authorWidth),
+			columnWidths,
+		)
 
 		if line.dimTally {
-			fmt.Printf(
-				"%s%s%s%s%s%s %s\n",
+			r.Printf(
+				"%s%s%s%s %s%s\n",
 				line.indent,
 				path,
-				pretty.Dim,
-				separator,
-				pretty.Reset,
+				r.Dim(separator),
 				author,
 				line.metric,
+				extra,
 			)
 		} else {
-			fmt.Printf(
-				"%s%s%s%s%s %s%s\n",
+			r.Printf(
+				"%s%s%s%s\n",
 				line.indent,
 				path,
-				pretty.Dim,
-				separator,
-				author,
-				line.metric,
-				pretty.Reset,
+				r.Dim(separator+author+" "+line.metric),
+				extra,
 			)
 		}
 	}
 }
+
+// Number of columns taken up by the author and metric on screen.
+func fmtAnnotationWidth(
+	line treeOutputLine,
+	showEmail bool,
+	authorWidth int,
+) int {
+	author := fmtTreeAuthor(line.tally, showEmail, authorWidth)
+	return runewidth.StringWidth(author) + 1 + visibleLen(line.metric)
+}
+
+// Pads out the annotation and lays out the extra columns after it.
+func fmtTreeColumns(
+	line treeOutputLine,
+	padding int,
+	columnWidths []int,
+) string {
+	if len(line.columns) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.Repeat(" ", padding))
+	for i, column := range line.columns {
+		b.WriteString("  ")
+		b.WriteString(column)
+
+		if i < len(line.columns)-1 {
+			pad := columnWidths[i] - utf8.RuneCountInString(column)
+			b.WriteString(strings.Repeat(" ", pad))
+		}
+	}
+
+	return b.String()
+}
+
+// Length of the string on screen, ignoring ANSI escape codes.
+func visibleLen(s string) int {
+	n := 0
+	inEscape := false
+	for _, r := range s {
+		switch {
+		case inEscape:
+			inEscape = !(r >= 0x40 && r <= 0x7e && r != '[')
+		case r == 0x1b:
+			inEscape = true
+		default:
+			n++
+		}
+	}
+
+	return n
+}
+
+// Returns the author to annotate a tree node with, abbreviated to width.
+func fmtTreeAuthor(t tally.FinalTally, showEmail bool, width int) string {
+	if showEmail {
+		return format.Abbrev(format.GitEmail(t.AuthorEmail), width)
+	}
+
+	return format.Abbrev(t.AuthorName, width)
+}
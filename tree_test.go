@@ -0,0 +1,126 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/trinhminhtriet/git-author/internal/pretty"
+	"github.com/trinhminhtriet/git-author/internal/tally"
+)
+
+func TestPrintTreeWidth(t *testing.T) {
+	alice := tally.FinalTally{AuthorName: "Alice", Commits: 3}
+	long := tally.FinalTally{AuthorName: longAuthor, Commits: 1}
+
+	// The longest path takes 18 columns, so tallies start at column 22
+	lines := []treeOutputLine{
+		{path: "./", metric: "(3)", tally: alice, showLine: true, showTally: true},
+		{
+			indent:    "|-- ",
+			path:      "internal/",
+			metric:    "(3)",
+			tally:     alice,
+			showLine:  true,
+			showTally: true,
+		},
+		{
+			indent:    "|   `-- ",
+			path:      "handler.go",
+			metric:    "(1)",
+			tally:     long,
+			showLine:  true,
+			showTally: true,
+		},
+	}
+
+	withColumns := slices.Clone(lines)
+	withColumns[0].columns = []string{"2 authors"}
+	withColumns[1].columns = []string{"2 authors"}
+	withColumns[2].columns = []string{"1 author"}
+
+	tests := []struct {
+		name  string
+		lines []treeOutputLine
+		width int
+		exp   []string
+	}{
+		{
+			name:  "unlimited",
+			lines: lines,
+			exp: []string{
+				"./....................Alice (3)",
+				"|-- internal/.........Alice (3)",
+				"|   `-- handler.go....Maximilian Alexander Fea… (1)",
+			},
+		},
+		{
+			name:  "wide",
+			lines: lines,
+			width: 200,
+			exp: []string{
+				"./....................Alice (3)",
+				"|-- internal/.........Alice (3)",
+				"|   `-- handler.go....Maximilian Alexander Featherstonehaugh (1)",
+			},
+		},
+		{
+			name:  "exact",
+			lines: lines,
+			width: 64,
+			exp: []string{
+				"./....................Alice (3)",
+				"|-- internal/.........Alice (3)",
+				"|   `-- handler.go....Maximilian Alexander Featherstonehaugh (1)",
+			},
+		},
+		{
+			name:  "truncated",
+			lines: lines,
+			width: 63,
+			exp: []string{
+				"./....................Alice (3)",
+				"|-- internal/.........Alice (3)",
+				"|   `-- handler.go....Maximilian Alexander Featherstonehau… (1)",
+			},
+		},
+		{
+			// The annotations move left, over the end of the longest path
+			name:  "narrow",
+			lines: lines,
+			width: 30,
+			exp: []string{
+				"./................Alice (3)",
+				"|-- internal/.....Alice (3)",
+				"|   `-- handler.go.Maximil… (1)",
+			},
+		},
+		{
+			name:  "columns",
+			lines: withColumns,
+			width: 64,
+			exp: []string{
+				"./....................Alice (3)                        2 authors",
+				"|-- internal/.........Alice (3)                        2 authors",
+				"|   `-- handler.go....Maximilian Alexander Feath… (1)  1 author",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out strings.Builder
+			r := pretty.NewRenderer(&out, false, true, test.width)
+			printTree(r, test.lines, false)
+			if err := r.Flush(); err != nil {
+				t.Fatalf("Flush() returned error: %v", err)
+			}
+
+			if diff := cmp.Diff(test.exp, outputLines(out.String())); diff != "" {
+				t.Errorf("tree is wrong:\n%s", diff)
+			}
+		})
+	}
+}